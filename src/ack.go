@@ -0,0 +1,143 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/satori/go.uuid"
+	"github.com/tidwall/sjson"
+	"sync"
+)
+
+const deliveryIDField = "delivery_id"
+
+// AckJournal persists the messages delivered to the service until they are
+// acknowledged, so that they can be redelivered after a restart.
+type AckJournal struct {
+	mu      sync.Mutex
+	journal *journal
+	pending map[string]string
+	order   []string
+}
+
+type journalEntry struct {
+	ID      string `json:"id"`
+	Message string `json:"message,omitempty"`
+	Ack     bool   `json:"ack,omitempty"`
+}
+
+// OpenAckJournal reads the unacknowledged messages of an existing journal
+// and compacts it.
+func OpenAckJournal(path string) (*AckJournal, error) {
+	j := &AckJournal{pending: make(map[string]string)}
+
+	var err error
+	j.journal, err = openJournal(path, "journal", func(line []byte) error {
+		var entry journalEntry
+		err := json.Unmarshal(line, &entry)
+		if err != nil {
+			return err
+		}
+		if entry.Ack {
+			j.remove(entry.ID)
+		} else {
+			j.pending[entry.ID] = entry.Message
+			j.order = append(j.order, entry.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = j.journal.compact(j.entries())
+	if err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// entries returns the journal entries of the pending messages. The caller
+// holds the lock.
+func (j *AckJournal) entries() []interface{} {
+	entries := make([]interface{}, 0, len(j.order))
+	for _, id := range j.order {
+		entries = append(entries, journalEntry{ID: id, Message: j.pending[id]})
+	}
+	return entries
+}
+
+// Add sets the "delivery_id" field of the message to a new id and stores the
+// message until it is acknowledged.
+func (j *AckJournal) Add(msg string) (string, error) {
+	id := uuid.NewV4().String()
+	msg, err := sjson.Set(msg, deliveryIDField, id)
+	if err != nil {
+		return "", fmt.Errorf("can't set delivery id: %s", err)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	err = j.journal.write(journalEntry{ID: id, Message: msg})
+	if err != nil {
+		return "", err
+	}
+	j.pending[id] = msg
+	j.order = append(j.order, id)
+	return msg, nil
+}
+
+// Ack removes the message with the given delivery id and reports whether it
+// was pending. The journal is compacted once it holds mostly acknowledged
+// messages.
+func (j *AckJournal) Ack(id string) (bool, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if _, ok := j.pending[id]; !ok {
+		return false, nil
+	}
+
+	err := j.journal.write(journalEntry{ID: id, Ack: true})
+	if err != nil {
+		return false, err
+	}
+	j.remove(id)
+
+	if j.journal.needsCompaction(len(j.order)) {
+		return true, j.journal.compact(j.entries())
+	}
+	return true, nil
+}
+
+// Pending returns the unacknowledged messages in delivery order.
+func (j *AckJournal) Pending() []string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	messages := make([]string, 0, len(j.order))
+	for _, id := range j.order {
+		messages = append(messages, j.pending[id])
+	}
+	return messages
+}
+
+func (j *AckJournal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.journal.close()
+}
+
+func (j *AckJournal) remove(id string) {
+	if _, ok := j.pending[id]; !ok {
+		return
+	}
+	delete(j.pending, id)
+	for i, pendingID := range j.order {
+		if pendingID == id {
+			j.order = append(j.order[:i], j.order[i+1:]...)
+			break
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package core_test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+	"gitlab.com/flaneurtv/samm/core"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAckJournal(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "journal")
+
+	journal, err := core.OpenAckJournal(path)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(journal.Pending()))
+
+	msg1, err := journal.Add(`{"topic": "tick", "payload": 1}`)
+	assert.Nil(t, err)
+	msg2, err := journal.Add(`{"topic": "tick", "payload": 2}`)
+	assert.Nil(t, err)
+	msg3, err := journal.Add(`{"topic": "tick", "payload": 3}`)
+	assert.Nil(t, err)
+
+	id2 := gjson.Get(msg2, "delivery_id").String()
+	assert.NotEmpty(t, id2)
+	assert.NotEqual(t, gjson.Get(msg1, "delivery_id").String(), id2)
+
+	ok, err := journal.Ack(id2)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	ok, err = journal.Ack(id2)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	assert.Equal(t, []string{msg1, msg3}, journal.Pending())
+	journal.Close()
+
+	// a truncated entry written during a crash is ignored
+	file, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	file.WriteString(`{"id": "trunc`)
+	file.Close()
+
+	journal, err = core.OpenAckJournal(path)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{msg1, msg3}, journal.Pending())
+	journal.Close()
+
+	content, _ := ioutil.ReadFile(path)
+	assert.Equal(t, 2, len(gjson.Parse("["+string(content[:len(content)-1])+"]").Array()))
+}
+
+func TestAckJournalCompaction(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "journal")
+
+	journal, err := core.OpenAckJournal(path)
+	assert.Nil(t, err)
+
+	var ids []string
+	for i := 0; i < 600; i++ {
+		msg, err := journal.Add(`{"topic": "tick"}`)
+		assert.Nil(t, err)
+		ids = append(ids, gjson.Get(msg, "delivery_id").String())
+	}
+	for _, id := range ids[:599] {
+		ok, err := journal.Ack(id)
+		assert.Nil(t, err)
+		assert.True(t, ok)
+	}
+	journal.Close()
+
+	// compacted after 400 acks to the 200 pending messages, 199 acks were added since
+	content, _ := ioutil.ReadFile(path)
+	assert.Equal(t, 399, strings.Count(string(content), "\n"))
+
+	journal, err = core.OpenAckJournal(path)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(journal.Pending()))
+	journal.Close()
+}
+
+func TestAckJournalError(t *testing.T) {
+	_, err := core.OpenAckJournal("/dummy/journal")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "can't compact journal")
+}
+
+func TestAdapterAck(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "journal")
+
+	journal, _ := core.OpenAckJournal(path)
+	journal.Add(`{"topic": "root/tick", "payload": "a"}`)
+	journal.Close()
+
+	bus := NewMockBus()
+	client := NewMockClient(bus)
+
+	outputs := make(chan string)
+	errors := make(chan string)
+	service := NewMockServiceProducer(outputs, errors)
+
+	journal, _ = core.OpenAckJournal(path)
+	log := &mockLogger{}
+	adapter := core.NewAdapter(client, client, []string{"root/tick"}, service, log)
+	adapter.SetAckJournal(journal)
+
+	started := make(chan struct{})
+	go func() {
+		_, err := adapter.Start()
+		assert.Nil(t, err)
+		close(started)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	redelivered := <-service.getInput()
+	assert.Equal(t, "a", gjson.Get(redelivered, "payload").String())
+	<-started
+
+	go client.Publish("root/tick", `{"topic": "root/tick", "payload": "b"}`)
+	delivered := <-service.getInput()
+	assert.Equal(t, "b", gjson.Get(delivered, "payload").String())
+	assert.Equal(t, 2, len(journal.Pending()))
+
+	outputs <- `{"topic": "$samm/ack", "payload": {"delivery_ids": ["` + gjson.Get(redelivered, "delivery_id").String() + `", "unknown"]}}`
+	time.Sleep(50 * time.Millisecond)
+
+	assert.Equal(t, []string{delivered}, journal.Pending())
+}
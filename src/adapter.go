@@ -1,9 +1,20 @@
 package core
 
 import (
+	"errors"
 	"fmt"
 	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	readinessPollInterval = 100 * time.Millisecond
+	// readyLine is accepted from the service like the ready control message.
+	readyLine = "ready"
 )
 
 type Adapter struct {
@@ -12,18 +23,162 @@ type Adapter struct {
 	subscriptions []string
 	service       Service
 	logger        Logger
+
+	readinessEnabled bool
+	readinessProbe   ReadinessProbe
+	readinessTimeout time.Duration
+	ready            chan struct{}
+	readyOnce        sync.Once
+
+	envelope *envelope
+
+	publishPolicy *PublishPolicy
+	rateLimiter   *RateLimiter
+	deduplicator  *Deduplicator
+	journal       *AckJournal
+
+	validator      MessageValidator
+	validationMode ValidationMode
+	validateInput  bool
+
+	batchSize    int
+	batchTimeout time.Duration
+
+	logControl        *LogLevelControl
+	logControlForward bool
+
+	delays       *DelayQueue
+	schedules    []Schedule
+	templateVars map[string]string
+
+	metrics *Metrics
+	stats   *Stats
+
+	input           chan string
+	queue           chan string
+	current         delivery
+	sinceOutput     int
+	currentMu       sync.Mutex
+	deliverMu       sync.Mutex
+	queued          int32
+	queueMu         sync.RWMutex
+	queueClosing    chan struct{}
+	queueCloseOnce  sync.Once
+	done            chan struct{}
+	subscriptionsMu sync.Mutex
+
+	subscriptionChanges   []subscriptionChange
+	subscriptionChangesMu sync.Mutex
+	subscriptionChanged   chan struct{}
+}
+
+// delivery is a message delivered to the service, so that its output can be
+// attributed to it. It is empty for timer messages.
+type delivery struct {
+	messageUUID string
+	at          time.Time
+}
+
+// subscriptionChange is a subscribe or unsubscribe control message of the
+// service, applied outside of the output loop.
+type subscriptionChange struct {
+	subscribe bool
+	topics    []string
 }
 
 func NewAdapter(listener, publisher MessageBusClient, subscriptions []string, service Service, logger Logger) *Adapter {
 	return &Adapter{
-		listener:      listener,
-		publisher:     publisher,
-		subscriptions: subscriptions,
-		service:       service,
-		logger:        logger,
+		listener:            listener,
+		publisher:           publisher,
+		subscriptions:       subscriptions,
+		service:             service,
+		logger:              logger,
+		ready:               make(chan struct{}),
+		queueClosing:        make(chan struct{}),
+		subscriptionChanged: make(chan struct{}, 1),
+		publishPolicy:       NewPublishPolicy("", NamespaceModeOff, nil),
 	}
 }
 
+func (a *Adapter) SetPublishPolicy(policy *PublishPolicy) {
+	a.publishPolicy = policy
+}
+
+func (a *Adapter) SetRateLimiter(limiter *RateLimiter) {
+	a.rateLimiter = limiter
+}
+
+// SetDeduplicator drops incoming messages the deduplicator has already seen.
+func (a *Adapter) SetDeduplicator(deduplicator *Deduplicator) {
+	a.deduplicator = deduplicator
+}
+
+// SetAckJournal adds a delivery id to every incoming message and keeps it in
+// the journal until the service acknowledges it. Unacknowledged messages of
+// the journal are redelivered on start.
+func (a *Adapter) SetAckJournal(journal *AckJournal) {
+	a.journal = journal
+}
+
+// SetLogLevelControl subscribes to the log level control topics on start. With
+// forward, the service receives the new levels as a control message.
+func (a *Adapter) SetLogLevelControl(control *LogLevelControl, forward bool) {
+	a.logControl = control
+	a.logControlForward = forward
+}
+
+// SetDelayQueue replaces the in-memory queue holding messages published with
+// a publish_at or delay_ms directive, e.g. by one persisted to disk.
+func (a *Adapter) SetDelayQueue(delays *DelayQueue) {
+	a.delays = delays
+}
+
+// SetSchedules starts the schedules once the adapter subscribed. Publish
+// templates are expanded with vars, UUID and CREATED_AT.
+func (a *Adapter) SetSchedules(schedules []Schedule, vars map[string]string) {
+	a.schedules = schedules
+	a.templateVars = vars
+}
+
+// SetMetrics counts received, published and dropped messages and observes the
+// time from delivering a message to the service until publishing its output.
+func (a *Adapter) SetMetrics(metrics *Metrics) {
+	a.metrics = metrics
+}
+
+// SetStats publishes the stats periodically while the service is running.
+func (a *Adapter) SetStats(stats *Stats) {
+	a.stats = stats
+}
+
+// SetBatching delivers incoming messages to the service as JSON arrays of up
+// to size messages, waiting at most timeout for a batch to fill up.
+func (a *Adapter) SetBatching(size int, timeout time.Duration) {
+	a.batchSize = size
+	a.batchTimeout = timeout
+}
+
+// SetReadiness delays subscribing until the service sends the ready control message or the probe (if any) succeeds.
+func (a *Adapter) SetReadiness(probe ReadinessProbe, timeout time.Duration) {
+	a.readinessEnabled = true
+	a.readinessProbe = probe
+	a.readinessTimeout = timeout
+}
+
+// SetEnvelope fills missing envelope fields and a message_uuid into published messages.
+// With causation id, the message_uuid of the message the service processes is added as causation_id.
+func (a *Adapter) SetEnvelope(serviceName, serviceUUID, serviceHost string, withCausationID bool) {
+	a.envelope = newEnvelope(serviceName, serviceUUID, serviceHost, withCausationID)
+}
+
+// SetValidator validates published messages and, with validateInput, messages delivered to the service.
+// Invalid messages are dropped or, in tag mode, passed on with a validation_error field.
+func (a *Adapter) SetValidator(validator MessageValidator, mode ValidationMode, validateInput bool) {
+	a.validator = validator
+	a.validationMode = mode
+	a.validateInput = validateInput
+}
+
 func (a *Adapter) Start() (<-chan struct{}, error) {
 	err := a.listener.Connect()
 	if err != nil {
@@ -39,22 +194,22 @@ func (a *Adapter) Start() (<-chan struct{}, error) {
 		a.logger.Log(LogLevelDebug, "MQTT connection: listener and publisher are equal")
 	}
 
-	var inputMessages <-chan string
-	if len(a.subscriptions) > 0 {
-		inputMessages, err = a.listener.Subscribe(a.subscriptions)
-		if err != nil {
-			return nil, fmt.Errorf("can't subscribe: %s", err)
-		} else {
-			a.logger.Log(LogLevelInfo, fmt.Sprintf("Topics subscribed: %s", strings.Join(a.subscriptions, ", ")))
-		}
-	}
-
-	outputMessages, errorMessages, err := a.service.Start(inputMessages)
+	a.input = make(chan string)
+	outputMessages, errorMessages, err := a.service.Start(a.input)
 	if err != nil {
 		return nil, fmt.Errorf("can't start a service: %s", err)
 	}
+	a.metrics.Inc(MetricProcessorStarts)
 
 	done := make(chan struct{})
+	a.done = done
+
+	a.queue = a.input
+	if a.batchSize > 0 {
+		a.queue = make(chan string)
+		go a.batch(done)
+	}
+
 	go func() {
 		defer close(done)
 
@@ -66,40 +221,587 @@ func (a *Adapter) Start() (<-chan struct{}, error) {
 					break LOOP
 				}
 
-				if gjson.Valid(msg) {
-					topic := gjson.Get(msg, "topic").String()
-					if topic != "" {
-						err := a.publisher.Publish(topic, msg)
-						if err != nil {
-							a.logger.Log(LogLevelError, fmt.Sprintf("can't publish: %s", err))
-						} else {
-							a.logger.Log(LogLevelDebug, fmt.Sprintf("published: %s", msg))
-						}
-					} else {
-						a.logger.Log(LogLevelError, fmt.Sprintf("missing topic: %s", msg))
+				cause := a.outputCause()
+				if gjson.Valid(msg) && gjson.Parse(msg).IsArray() {
+					for _, item := range gjson.Parse(msg).Array() {
+						a.handleOutputMessage(item.Raw, cause)
 					}
 				} else {
-					a.logger.Log(LogLevelError, fmt.Sprintf("invalid json: %s", msg))
+					a.handleOutputMessage(msg, cause)
 				}
 			case msg, ok := <-errorMessages:
 				if !ok {
 					break LOOP
 				}
 
-				logLevel := LogLevelError
-				message := msg
-				if gjson.Valid(msg) {
-					message = gjson.Get(msg, "log_message").String()
-					if message == "" {
-						message = msg
-					} else {
-						logLevel, _ = ParseLogLevel(gjson.Get(msg, "log_level").String())
-					}
-				}
-				a.logger.Log(logLevel, message)
+				a.handleErrorMessage(msg)
 			}
 		}
 	}()
 
+	if a.readinessEnabled {
+		err := a.waitReady(done)
+		if err != nil {
+			return nil, fmt.Errorf("service not ready: %s", err)
+		}
+		a.logger.Log(LogLevelInfo, "Service ready")
+	}
+
+	if a.journal != nil {
+		a.metrics.SetGaugeFunc(MetricUnackedMessages, func() float64 {
+			return float64(len(a.journal.Pending()))
+		})
+
+		pending := a.journal.Pending()
+		if len(pending) > 0 {
+			a.logger.Log(LogLevelInfo, fmt.Sprintf("Redelivering %d unacknowledged messages", len(pending)))
+		}
+		for _, msg := range pending {
+			a.deliver(msg, delivery{messageUUID: gjson.Get(msg, "message_uuid").String(), at: time.Now()})
+		}
+	}
+
+	subscriptions := a.subscriptions
+	a.subscriptions = nil
+	err = a.subscribe(subscriptions)
+	if err != nil {
+		return nil, fmt.Errorf("can't subscribe: %s", err)
+	}
+	go a.changeSubscriptions(done)
+
+	if a.logControl != nil {
+		var changed func(levelConsole, levelRemote LogLevel)
+		if a.logControlForward {
+			changed = func(levelConsole, levelRemote LogLevel) {
+				msg := fmt.Sprintf(`{"topic":"%s","payload":{"log_level_console":"%s","log_level_mqtt":"%s"}}`, ControlTopicLogLevel, levelConsole, levelRemote)
+				a.deliverControl(msg)
+			}
+		}
+		err = a.logControl.Start(a.listener, changed)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if a.delays == nil {
+		a.delays = NewDelayQueue()
+	}
+	a.metrics.SetGaugeFunc(MetricQueuedMessages, func() float64 {
+		return float64(atomic.LoadInt32(&a.queued))
+	})
+	a.metrics.SetGaugeFunc(MetricDelayedMessages, func() float64 {
+		return float64(a.delays.Len())
+	})
+	if n := a.delays.Len(); n > 0 {
+		a.logger.Log(LogLevelInfo, fmt.Sprintf("Restored %d delayed messages", n))
+	}
+	go a.delays.Run(done, func(msg string) {
+		a.handleOutputMessage(msg, delivery{})
+	}, func(err error) {
+		a.logger.Log(LogLevelError, fmt.Sprintf("delayed messages: %s", err))
+	})
+
+	for _, schedule := range a.schedules {
+		go a.runSchedule(schedule, done)
+	}
+
+	if a.stats != nil {
+		go a.stats.run(a.service, done)
+	}
+
 	return done, nil
 }
+
+func (a *Adapter) handleErrorMessage(msg string) {
+	entry := LogEntry{Level: LogLevelError, Message: msg}
+	if gjson.Valid(msg) {
+		message := gjson.Get(msg, "log_message").String()
+		if message != "" {
+			entry.Message = message
+			entry.Level, _ = ParseLogLevel(gjson.Get(msg, "log_level").String())
+			entry.Fields = logFields(msg)
+			if createdAt := gjson.Get(msg, "created_at"); createdAt.Exists() {
+				entry.CreatedAt, _ = time.Parse(time.RFC3339Nano, createdAt.String())
+			}
+		}
+	}
+	a.logger.LogEntry(entry)
+}
+
+// logFields returns the custom fields of a log message written by the service.
+func logFields(msg string) map[string]interface{} {
+	var fields map[string]interface{}
+	gjson.Parse(msg).ForEach(func(key, value gjson.Result) bool {
+		switch key.String() {
+		case "log_message", "log_level", "created_at":
+		default:
+			if fields == nil {
+				fields = make(map[string]interface{})
+			}
+			fields[key.String()] = value.Value()
+		}
+		return true
+	})
+	return fields
+}
+
+// handleOutputMessage publishes a message caused by the delivery, which is
+// empty for delayed and scheduled messages.
+func (a *Adapter) handleOutputMessage(msg string, cause delivery) {
+	if a.readinessEnabled && strings.TrimSpace(msg) == readyLine {
+		a.setReady()
+		return
+	}
+
+	if !gjson.Valid(msg) {
+		a.metrics.Inc(MetricInvalidJSON)
+		a.logger.Log(LogLevelError, fmt.Sprintf("invalid json: %s", msg))
+		return
+	}
+
+	topic := gjson.Get(msg, "topic").String()
+	if IsControlTopic(topic) {
+		a.handleControlMessage(topic, msg)
+		return
+	}
+	if topic == "" {
+		a.metrics.Inc(MetricMissingTopic)
+		a.logger.Log(LogLevelError, fmt.Sprintf("missing topic: %s", msg))
+		return
+	}
+
+	at, msg, err := publishTime(msg, time.Now())
+	if err != nil {
+		a.logger.Log(LogLevelError, fmt.Sprintf("%s: %s", err, msg))
+		return
+	}
+	if at.After(time.Now()) {
+		if a.envelope != nil && a.envelope.withCausationID && cause.messageUUID != "" {
+			msg = setMissing(msg, "causation_id", cause.messageUUID)
+		}
+		err = a.delays.Add(at, msg)
+		if err != nil {
+			a.logger.Log(LogLevelError, fmt.Sprintf("can't delay message: %s: %s", err, msg))
+		} else {
+			a.logger.Log(LogLevelDebug, fmt.Sprintf("delayed until %s: %s", at.UTC().Format(createdAtFormat), msg))
+		}
+		return
+	}
+
+	policyTopic, err := a.publishPolicy.Apply(topic)
+	if err != nil {
+		a.metrics.Inc(MetricMessagesDropped, "reason", DropReasonPolicy)
+		a.logger.Log(LogLevelError, fmt.Sprintf("publish policy violation: %s: %s", err, msg))
+		return
+	}
+	if policyTopic != topic {
+		topic = policyTopic
+		msg, _ = sjson.Set(msg, "topic", topic)
+	}
+
+	if a.envelope != nil {
+		msg = a.envelope.enrich(msg, cause.messageUUID)
+	}
+
+	msg, ok := a.validate(topic, msg, "outgoing")
+	if !ok {
+		a.metrics.Inc(MetricMessagesDropped, "reason", DropReasonInvalid)
+		return
+	}
+
+	if a.rateLimiter != nil && !a.rateLimiter.Wait(topic) {
+		a.metrics.Inc(MetricMessagesDropped, "reason", DropReasonRateLimit)
+		a.logger.Log(LogLevelDebug, fmt.Sprintf("rate limit exceeded, dropped: %s", msg))
+		return
+	}
+
+	err = a.publisher.Publish(topic, msg)
+	if err != nil {
+		a.metrics.Inc(MetricPublishErrors)
+		a.logger.Log(LogLevelError, fmt.Sprintf("can't publish: %s", err))
+	} else {
+		a.metrics.Inc(MetricMessagesPublished, "topic", a.metrics.TopicLabel(topic))
+		if !cause.at.IsZero() {
+			a.metrics.Observe(MetricProcessingLatency, time.Since(cause.at).Seconds())
+		}
+		a.logger.Log(LogLevelDebug, fmt.Sprintf("published: %s", msg))
+	}
+}
+
+func (a *Adapter) validate(topic, msg, direction string) (string, bool) {
+	if a.validator == nil {
+		return msg, true
+	}
+
+	err := a.validator.Validate(topic, msg)
+	if err == nil {
+		return msg, true
+	}
+
+	a.logger.Log(LogLevelError, fmt.Sprintf("invalid %s message: %s: %s", direction, err, msg))
+	if a.validationMode != ValidationModeTag {
+		return msg, false
+	}
+
+	pointer, reason := "", err.Error()
+	if validationErr, ok := err.(*ValidationError); ok {
+		pointer, reason = validationErr.Pointer, validationErr.Reason
+	}
+	msg, _ = sjson.Set(msg, "validation_error.pointer", pointer)
+	msg, _ = sjson.Set(msg, "validation_error.reason", reason)
+	return msg, true
+}
+
+func (a *Adapter) setReady() {
+	a.readyOnce.Do(func() {
+		close(a.ready)
+	})
+}
+
+func (a *Adapter) waitReady(done <-chan struct{}) error {
+	var timeout <-chan time.Time
+	if a.readinessTimeout > 0 {
+		timeout = time.After(a.readinessTimeout)
+	}
+
+	ticker := time.NewTicker(readinessPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.ready:
+			return nil
+		case <-done:
+			return errors.New("service stopped")
+		case <-timeout:
+			return fmt.Errorf("timeout after %s", a.readinessTimeout)
+		case <-ticker.C:
+			if a.readinessProbe != nil && a.readinessProbe.IsReady() {
+				return nil
+			}
+		}
+	}
+}
+
+func (a *Adapter) forward(topics []string, messages <-chan string) {
+	go func() {
+		for msg := range messages {
+			a.metrics.Inc(MetricMessagesReceived, "subscription", matchingSubscription(topics, gjson.Get(msg, "topic").String()))
+
+			if a.deduplicator != nil && a.deduplicator.IsDuplicate(msg) {
+				a.metrics.Inc(MetricMessagesDropped, "reason", DropReasonDuplicate)
+				a.logger.Log(LogLevelDebug, fmt.Sprintf("duplicate message dropped: %s", msg))
+				continue
+			}
+
+			if a.validateInput {
+				var ok bool
+				msg, ok = a.validate(gjson.Get(msg, "topic").String(), msg, "incoming")
+				if !ok {
+					a.metrics.Inc(MetricMessagesDropped, "reason", DropReasonInvalid)
+					continue
+				}
+			}
+
+			if a.journal != nil {
+				var err error
+				msg, err = a.journal.Add(msg)
+				if err != nil {
+					a.metrics.Inc(MetricMessagesDropped, "reason", DropReasonJournal)
+					a.logger.Log(LogLevelError, fmt.Sprintf("message dropped: %s: %s", err, msg))
+					continue
+				}
+			}
+
+			a.deliver(msg, delivery{messageUUID: gjson.Get(msg, "message_uuid").String(), at: time.Now()})
+		}
+
+		// The listener closes subscriptions when they are unsubscribed. If it
+		// closes one that is still subscribed, no more messages will arrive.
+		if a.isSubscribed(topics) {
+			a.closeQueue()
+		}
+	}()
+}
+
+// deliver queues a message for the service. Its output is attributed to d
+// while no other message was delivered since. It returns false if the queue is
+// closed or the service stopped.
+func (a *Adapter) deliver(msg string, d delivery) bool {
+	return a.enqueue(msg, &d)
+}
+
+// deliverControl queues a control message the service doesn't answer, so it
+// doesn't affect the attribution of output.
+func (a *Adapter) deliverControl(msg string) bool {
+	return a.enqueue(msg, nil)
+}
+
+func (a *Adapter) enqueue(msg string, d *delivery) bool {
+	atomic.AddInt32(&a.queued, 1)
+	defer atomic.AddInt32(&a.queued, -1)
+
+	a.deliverMu.Lock()
+	defer a.deliverMu.Unlock()
+
+	a.queueMu.RLock()
+	defer a.queueMu.RUnlock()
+
+	select {
+	case <-a.queueClosing:
+		return false
+	default:
+	}
+
+	if d != nil {
+		a.delivered(*d)
+	}
+	select {
+	case a.queue <- msg:
+		return true
+	case <-a.queueClosing:
+		return false
+	case <-a.done:
+		return false
+	}
+}
+
+// closeQueue closes the input of the service once all deliveries in progress
+// returned.
+func (a *Adapter) closeQueue() {
+	a.queueCloseOnce.Do(func() {
+		close(a.queueClosing)
+
+		a.queueMu.Lock()
+		defer a.queueMu.Unlock()
+		close(a.queue)
+	})
+}
+
+func (a *Adapter) isSubscribed(topics []string) bool {
+	a.subscriptionsMu.Lock()
+	defer a.subscriptionsMu.Unlock()
+
+	for _, topic := range topics {
+		if containsTopic(a.subscriptions, topic) {
+			return true
+		}
+	}
+	return false
+}
+
+// batch collects the queued messages into batches until the queue is closed
+// or the service stopped.
+func (a *Adapter) batch(done <-chan struct{}) {
+	var batch []string
+	var timeout <-chan time.Time
+
+	// flush returns false if the service stopped.
+	flush := func() bool {
+		select {
+		case a.input <- "[" + strings.Join(batch, ",") + "]":
+		case <-done:
+			return false
+		}
+		batch = nil
+		timeout = nil
+		return true
+	}
+
+	for {
+		select {
+		case <-done:
+			return
+		case msg, ok := <-a.queue:
+			if !ok {
+				if len(batch) > 0 {
+					flush()
+				}
+				close(a.input)
+				return
+			}
+			if !gjson.Valid(msg) {
+				a.metrics.Inc(MetricMessagesDropped, "reason", DropReasonInvalidJSON)
+				a.logger.Log(LogLevelError, fmt.Sprintf("invalid json, not added to batch: %s", msg))
+				continue
+			}
+
+			batch = append(batch, msg)
+			if len(batch) >= a.batchSize {
+				if !flush() {
+					return
+				}
+			} else if len(batch) == 1 {
+				timeout = time.After(a.batchTimeout)
+			}
+		case <-timeout:
+			if !flush() {
+				return
+			}
+		}
+	}
+}
+
+func (a *Adapter) delivered(d delivery) {
+	a.currentMu.Lock()
+	defer a.currentMu.Unlock()
+	a.current = d
+	a.sinceOutput++
+}
+
+// outputCause returns the delivery an output line is attributed to. The
+// service may still be processing earlier messages when several were
+// delivered since its last output, so none is attributed then.
+func (a *Adapter) outputCause() delivery {
+	a.currentMu.Lock()
+	defer a.currentMu.Unlock()
+	if a.sinceOutput > 1 {
+		a.current = delivery{}
+	}
+	a.sinceOutput = 0
+	return a.current
+}
+
+func (a *Adapter) handleControlMessage(topic, msg string) {
+	switch topic {
+	case ControlTopicSubscribe:
+		a.addSubscriptionChange(subscriptionChange{subscribe: true, topics: controlTopics(msg)})
+	case ControlTopicUnsubscribe:
+		a.addSubscriptionChange(subscriptionChange{subscribe: false, topics: controlTopics(msg)})
+	case ControlTopicReady:
+		a.setReady()
+	case ControlTopicHeartbeat:
+	case ControlTopicAck:
+		if a.journal == nil {
+			a.logger.Log(LogLevelWarning, fmt.Sprintf("ack mode disabled, ack ignored: %s", msg))
+			return
+		}
+		for _, id := range controlDeliveryIDs(msg) {
+			ok, err := a.journal.Ack(id)
+			if err != nil && ok {
+				a.logger.Log(LogLevelError, fmt.Sprintf("delivery '%s' acknowledged, but %s", id, err))
+			} else if err != nil {
+				a.logger.Log(LogLevelError, fmt.Sprintf("can't acknowledge delivery '%s': %s", id, err))
+			} else if !ok {
+				a.logger.Log(LogLevelWarning, fmt.Sprintf("unknown delivery id: %s", id))
+			}
+		}
+	default:
+		a.logger.Log(LogLevelError, fmt.Sprintf("unknown control topic: %s", msg))
+	}
+}
+
+// addSubscriptionChange queues a change without blocking, as subscribing waits
+// for the listener, which may wait for the service to read its input.
+func (a *Adapter) addSubscriptionChange(change subscriptionChange) {
+	a.subscriptionChangesMu.Lock()
+	a.subscriptionChanges = append(a.subscriptionChanges, change)
+	a.subscriptionChangesMu.Unlock()
+
+	select {
+	case a.subscriptionChanged <- struct{}{}:
+	default:
+	}
+}
+
+// changeSubscriptions applies the queued subscription changes in order until
+// done is closed.
+func (a *Adapter) changeSubscriptions(done <-chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		case <-a.subscriptionChanged:
+		}
+
+		a.subscriptionChangesMu.Lock()
+		changes := a.subscriptionChanges
+		a.subscriptionChanges = nil
+		a.subscriptionChangesMu.Unlock()
+
+		for _, change := range changes {
+			if change.subscribe {
+				err := a.subscribe(change.topics)
+				if err != nil {
+					a.logger.Log(LogLevelError, fmt.Sprintf("can't subscribe: %s", err))
+				}
+			} else {
+				err := a.unsubscribe(change.topics)
+				if err != nil {
+					a.logger.Log(LogLevelError, fmt.Sprintf("can't unsubscribe: %s", err))
+				}
+			}
+		}
+	}
+}
+
+func (a *Adapter) subscribe(topics []string) error {
+	a.subscriptionsMu.Lock()
+	defer a.subscriptionsMu.Unlock()
+
+	var added []string
+	for _, topic := range topics {
+		if !containsTopic(a.subscriptions, topic) && !containsTopic(added, topic) {
+			added = append(added, topic)
+		}
+	}
+	if len(added) == 0 {
+		return nil
+	}
+
+	inputMessages, err := a.listener.Subscribe(added)
+	if err != nil {
+		return err
+	}
+	a.forward(added, inputMessages)
+
+	a.subscriptions = append(a.subscriptions[:len(a.subscriptions):len(a.subscriptions)], added...)
+	a.logger.Log(LogLevelInfo, fmt.Sprintf("Topics subscribed: %s", strings.Join(added, ", ")))
+	return nil
+}
+
+func (a *Adapter) unsubscribe(topics []string) error {
+	a.subscriptionsMu.Lock()
+	defer a.subscriptionsMu.Unlock()
+
+	var removed, remaining []string
+	for _, topic := range a.subscriptions {
+		if containsTopic(topics, topic) {
+			removed = append(removed, topic)
+		} else {
+			remaining = append(remaining, topic)
+		}
+	}
+	if len(removed) == 0 {
+		return nil
+	}
+
+	err := a.listener.Unsubscribe(removed)
+	if err != nil {
+		return err
+	}
+
+	a.subscriptions = remaining
+	a.logger.Log(LogLevelInfo, fmt.Sprintf("Topics unsubscribed: %s", strings.Join(removed, ", ")))
+	return nil
+}
+
+// matchingSubscription returns the first of the topics matching the topic of a
+// received message, or all of them if none matches.
+func matchingSubscription(topics []string, topic string) string {
+	for _, t := range topics {
+		if MatchTopic(t, topic) {
+			return t
+		}
+	}
+	return strings.Join(topics, ",")
+}
+
+func containsTopic(topics []string, topic string) bool {
+	for _, t := range topics {
+		if t == topic {
+			return true
+		}
+	}
+	return false
+}
@@ -8,6 +8,7 @@ import (
 	"gitlab.com/flaneurtv/samm/core"
 	"gitlab.com/flaneurtv/samm/core/logger"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -47,15 +48,15 @@ func TestAdapter(t *testing.T) {
 	<-done1
 	<-done2
 
-	assert.Equal(t, 3, len(service2.inputMessages))
-	assert.Equal(t, `{"topic": "tick", "payload": "a"}`, service2.inputMessages[0])
-	assert.Equal(t, `{"topic": "tick", "payload": "b"}`, service2.inputMessages[1])
-	assert.Equal(t, `{"topic": "tick", "payload": "d"}`, service2.inputMessages[2])
+	assert.Equal(t, 3, len(service2.getInputMessages()))
+	assert.Equal(t, `{"topic": "tick", "payload": "a"}`, service2.getInputMessages()[0])
+	assert.Equal(t, `{"topic": "tick", "payload": "b"}`, service2.getInputMessages()[1])
+	assert.Equal(t, `{"topic": "tick", "payload": "d"}`, service2.getInputMessages()[2])
 
-	assert.Equal(t, 3, len(service2.outputMessages))
-	assert.Equal(t, `{"topic": "tick-response", "payload": 1}`, service2.outputMessages[0])
-	assert.Equal(t, `{"topic": "tick-response", "payload": 2}`, service2.outputMessages[1])
-	assert.Equal(t, `{"topic": "tick-response", "payload": 3}`, service2.outputMessages[2])
+	assert.Equal(t, 3, len(service2.getOutputMessages()))
+	assert.Equal(t, `{"topic": "tick-response", "payload": 1}`, service2.getOutputMessages()[0])
+	assert.Equal(t, `{"topic": "tick-response", "payload": 2}`, service2.getOutputMessages()[1])
+	assert.Equal(t, `{"topic": "tick-response", "payload": 3}`, service2.getOutputMessages()[2])
 }
 
 func TestAdapterConnectError(t *testing.T) {
@@ -123,25 +124,32 @@ func TestAdapterLogging(t *testing.T) {
 	errors <- `plain`
 	errors <- `{"log_level": "warning", "log_message": "test"`
 	errors <- `{"log_level": "warning"}`
+	errors <- `{"log_level": "info", "log_message": "fields", "created_at": "2018-10-09T10:11:12.345Z", "request_id": "r1", "attempt": 2}`
 	close(errors)
 
 	<-done
 
 	time.Sleep(time.Microsecond * 300)
 
-	assert.Equal(t, 4, len(log.messages))
+	assert.Equal(t, 5, len(log.getMessages()))
 
-	assert.Equal(t, core.LogLevelWarning, log.messages[0].level)
-	assert.Equal(t, "test", log.messages[0].message)
+	assert.Equal(t, core.LogLevelWarning, log.getMessages()[0].level)
+	assert.Equal(t, "test", log.getMessages()[0].message)
+	assert.Nil(t, log.getMessages()[0].fields)
 
-	assert.Equal(t, core.LogLevelError, log.messages[1].level)
-	assert.Equal(t, "plain", log.messages[1].message)
+	assert.Equal(t, core.LogLevelError, log.getMessages()[1].level)
+	assert.Equal(t, "plain", log.getMessages()[1].message)
 
-	assert.Equal(t, core.LogLevelError, log.messages[2].level)
-	assert.Equal(t, `{"log_level": "warning", "log_message": "test"`, log.messages[2].message)
+	assert.Equal(t, core.LogLevelError, log.getMessages()[2].level)
+	assert.Equal(t, `{"log_level": "warning", "log_message": "test"`, log.getMessages()[2].message)
 
-	assert.Equal(t, core.LogLevelError, log.messages[3].level)
-	assert.Equal(t, `{"log_level": "warning"}`, log.messages[3].message)
+	assert.Equal(t, core.LogLevelError, log.getMessages()[3].level)
+	assert.Equal(t, `{"log_level": "warning"}`, log.getMessages()[3].message)
+
+	assert.Equal(t, core.LogLevelInfo, log.getMessages()[4].level)
+	assert.Equal(t, "fields", log.getMessages()[4].message)
+	assert.Equal(t, time.Date(2018, 10, 9, 10, 11, 12, 345000000, time.UTC), log.getMessages()[4].createdAt)
+	assert.Equal(t, map[string]interface{}{"request_id": "r1", "attempt": float64(2)}, log.getMessages()[4].fields)
 }
 
 func TestAdapterInvalidMessages(t *testing.T) {
@@ -165,45 +173,469 @@ func TestAdapterInvalidMessages(t *testing.T) {
 
 	time.Sleep(time.Microsecond * 300)
 
-	assert.Equal(t, 2, len(log.messages))
+	assert.Equal(t, 2, len(log.getMessages()))
 
-	assert.Equal(t, core.LogLevelError, log.messages[0].level)
-	assert.Equal(t, `invalid json: {"a": 123`, log.messages[0].message)
+	assert.Equal(t, core.LogLevelError, log.getMessages()[0].level)
+	assert.Equal(t, `invalid json: {"a": 123`, log.getMessages()[0].message)
 
-	assert.Equal(t, core.LogLevelError, log.messages[1].level)
-	assert.Equal(t, `missing topic: {"a": "123"}`, log.messages[1].message)
+	assert.Equal(t, core.LogLevelError, log.getMessages()[1].level)
+	assert.Equal(t, `missing topic: {"a": "123"}`, log.getMessages()[1].message)
+}
+
+func TestAdapterDynamicSubscriptions(t *testing.T) {
+	bus := NewMockBus()
+	client := NewMockClient(bus)
+	output := make(chan string)
+	errors := make(chan string)
+	service := NewMockServiceProducer(output, errors)
+
+	log := &mockLogger{}
+	adapter := core.NewAdapter(client, client, nil, service, log)
+	done, err := adapter.Start()
+	assert.Nil(t, err)
+
+	log.clear()
+	output <- `{"topic": "$samm/subscribe", "payload": {"topics": ["tick", "tack"]}}`
+	output <- `{"topic": "$samm/subscribe", "payload": {"topics": ["tick"]}}`
+	time.Sleep(50 * time.Millisecond)
+
+	go client.Publish("tick", `{"topic": "tick", "payload": "a"}`)
+	assert.Equal(t, `{"topic": "tick", "payload": "a"}`, <-service.getInput())
+
+	output <- `{"topic": "$samm/unsubscribe", "payload": {"topics": ["tick"]}}`
+	output <- `{"topic": "$samm/unsubscribe", "payload": {"topics": ["tick"]}}`
+	time.Sleep(50 * time.Millisecond)
+
+	client.Publish("tick", `{"topic": "tick", "payload": "b"}`)
+	go client.Publish("tack", `{"topic": "tack", "payload": "c"}`)
+	assert.Equal(t, `{"topic": "tack", "payload": "c"}`, <-service.getInput())
+
+	output <- `{"topic": "$samm/unknown"}`
+	close(output)
+
+	<-done
+
+	assert.Equal(t, 3, len(log.getMessages()))
+	assert.Equal(t, "Topics subscribed: tick, tack", log.getMessages()[0].message)
+	assert.Equal(t, "Topics unsubscribed: tick", log.getMessages()[1].message)
+	assert.Equal(t, core.LogLevelError, log.getMessages()[2].level)
+	assert.Equal(t, `unknown control topic: {"topic": "$samm/unknown"}`, log.getMessages()[2].message)
+}
+
+func TestAdapterInputClosed(t *testing.T) {
+	bus := NewMockBus()
+	client := NewMockClient(bus)
+	output := make(chan string)
+	errors := make(chan string)
+	service := NewMockServiceProducer(output, errors)
+
+	adapter := core.NewAdapter(client, client, []string{"tick"}, service, logger.NewNoOpLogger())
+	done, err := adapter.Start()
+	assert.Nil(t, err)
+
+	output <- `{"topic": "$samm/subscribe", "payload": {"topics": ["tack"]}}`
+	output <- `{"topic": "$samm/unsubscribe", "payload": {"topics": ["tack"]}}`
+	time.Sleep(50 * time.Millisecond)
+
+	go client.Publish("tick", `{"topic": "tick", "payload": "a"}`)
+	assert.Equal(t, `{"topic": "tick", "payload": "a"}`, <-service.getInput())
+
+	bus.close()
+	_, ok := <-service.getInput()
+	assert.False(t, ok)
+
+	close(output)
+	<-done
+}
+
+func TestAdapterReadiness(t *testing.T) {
+	bus := NewMockBus()
+	client := NewMockClient(bus)
+	output := make(chan string)
+	errors := make(chan string)
+	service := NewMockServiceProducer(output, errors)
+
+	adapter := core.NewAdapter(client, client, []string{"tick"}, service, logger.NewNoOpLogger())
+	adapter.SetReadiness(nil, time.Second)
+
+	go func() {
+		time.Sleep(time.Millisecond * 100)
+		client.Publish("tick", `{"topic": "tick", "payload": "early"}`)
+		output <- `{"topic": "$samm/ready"}`
+	}()
+
+	done, err := adapter.Start()
+	assert.Nil(t, err)
+
+	go client.Publish("tick", `{"topic": "tick", "payload": "a"}`)
+	assert.Equal(t, `{"topic": "tick", "payload": "a"}`, <-service.getInput())
+
+	close(output)
+	<-done
+}
+
+func TestAdapterReadinessLine(t *testing.T) {
+	bus := NewMockBus()
+	client := NewMockClient(bus)
+	output := make(chan string)
+	errors := make(chan string)
+	service := NewMockServiceProducer(output, errors)
+
+	log := &mockLogger{}
+	adapter := core.NewAdapter(client, client, []string{"tick"}, service, log)
+	adapter.SetReadiness(nil, time.Second)
+
+	go func() {
+		output <- "ready"
+	}()
+
+	done, err := adapter.Start()
+	assert.Nil(t, err)
+
+	go client.Publish("tick", `{"topic": "tick", "payload": "a"}`)
+	assert.Equal(t, `{"topic": "tick", "payload": "a"}`, <-service.getInput())
+
+	close(output)
+	<-done
+
+	for _, msg := range log.getMessages() {
+		assert.NotEqual(t, core.LogLevelError, msg.level, msg.message)
+	}
+}
+
+func TestAdapterReadinessProbe(t *testing.T) {
+	bus := NewMockBus()
+	client := NewMockClient(bus)
+	service := NewMockServiceProducer(make(chan string), make(chan string))
+
+	probe := &mockReadinessProbe{}
+	adapter := core.NewAdapter(client, client, nil, service, logger.NewNoOpLogger())
+	adapter.SetReadiness(probe, time.Second)
+
+	go func() {
+		time.Sleep(time.Millisecond * 200)
+		probe.setReady()
+	}()
+
+	_, err := adapter.Start()
+	assert.Nil(t, err)
+}
+
+func TestAdapterReadinessTimeout(t *testing.T) {
+	bus := NewMockBus()
+	client := NewMockClient(bus)
+	service := NewMockServiceProducer(make(chan string), make(chan string))
+
+	adapter := core.NewAdapter(client, client, []string{"tick"}, service, logger.NewNoOpLogger())
+	adapter.SetReadiness(&mockReadinessProbe{}, time.Millisecond*300)
+
+	_, err := adapter.Start()
+	assert.NotNil(t, err)
+	assert.Equal(t, "service not ready: timeout after 300ms", err.Error())
+}
+
+func TestAdapterEnvelope(t *testing.T) {
+	bus := NewMockBus()
+	client := NewMockClient(bus)
+	output := make(chan string)
+	service := NewMockServiceProducer(output, make(chan string))
+
+	adapter := core.NewAdapter(client, client, []string{"tick"}, service, logger.NewNoOpLogger())
+	adapter.SetEnvelope("first", "id1", "host.com", true)
+	done, err := adapter.Start()
+	assert.Nil(t, err)
+
+	responses, err := client.Subscribe([]string{"tick-response"})
+	assert.Nil(t, err)
+
+	go client.Publish("tick", `{"topic": "tick", "message_uuid": "input1"}`)
+	<-service.getInput()
+
+	go func() {
+		output <- `{"topic": "tick-response", "payload": 1}`
+		output <- `{"topic": "tick-response", "service_name": "other", "created_at": "2018-10-09T10:11:12.345Z", "causation_id": "cause"}`
+		output <- `{"topic": "tick-response", "payload": "delayed", "delay_ms": 100}`
+	}()
+
+	msg := <-responses
+	assert.Equal(t, "first", gjson.Get(msg, "service_name").String())
+	assert.Equal(t, "id1", gjson.Get(msg, "service_uuid").String())
+	assert.Equal(t, "host.com", gjson.Get(msg, "service_host").String())
+	assert.Equal(t, "input1", gjson.Get(msg, "causation_id").String())
+	assert.Equal(t, int64(1), gjson.Get(msg, "payload").Int())
+	assert.Len(t, gjson.Get(msg, "message_uuid").String(), 36)
+	_, err = time.Parse("2006-01-02T15:04:05.000Z", gjson.Get(msg, "created_at").String())
+	assert.Nil(t, err)
+
+	msg = <-responses
+	assert.Equal(t, "other", gjson.Get(msg, "service_name").String())
+	assert.Equal(t, "2018-10-09T10:11:12.345Z", gjson.Get(msg, "created_at").String())
+	assert.Equal(t, "cause", gjson.Get(msg, "causation_id").String())
+
+	time.Sleep(20 * time.Millisecond)
+	go client.Publish("tick", `{"topic": "tick", "message_uuid": "input2"}`)
+	<-service.getInput()
+
+	msg = <-responses
+	assert.Equal(t, "delayed", gjson.Get(msg, "payload").String())
+	assert.Equal(t, "input1", gjson.Get(msg, "causation_id").String())
+
+	close(output)
+	<-done
+}
+
+func TestAdapterCausationPending(t *testing.T) {
+	bus := NewMockBus()
+	client := NewMockClient(bus)
+	output := make(chan string)
+	service := NewMockServiceProducer(output, make(chan string))
+
+	adapter := core.NewAdapter(client, client, []string{"tick"}, service, logger.NewNoOpLogger())
+	adapter.SetEnvelope("first", "id1", "host.com", true)
+	done, err := adapter.Start()
+	assert.Nil(t, err)
+
+	responses, err := client.Subscribe([]string{"tick-response"})
+	assert.Nil(t, err)
+
+	go client.Publish("tick", `{"topic": "tick", "message_uuid": "input1"}`)
+	<-service.getInput()
+	go client.Publish("tick", `{"topic": "tick", "message_uuid": "input2"}`)
+	<-service.getInput()
+
+	go func() {
+		output <- `{"topic": "tick-response", "payload": 1}`
+		output <- `{"topic": "tick-response", "payload": 2}`
+	}()
+
+	msg := <-responses
+	assert.False(t, gjson.Get(msg, "causation_id").Exists())
+	msg = <-responses
+	assert.False(t, gjson.Get(msg, "causation_id").Exists())
+
+	go client.Publish("tick", `{"topic": "tick", "message_uuid": "input3"}`)
+	<-service.getInput()
+
+	go func() {
+		output <- `{"topic": "tick-response", "payload": 3}`
+		output <- `{"topic": "tick-response", "payload": 4}`
+	}()
+
+	msg = <-responses
+	assert.Equal(t, "input3", gjson.Get(msg, "causation_id").String())
+	msg = <-responses
+	assert.Equal(t, "input3", gjson.Get(msg, "causation_id").String())
+
+	close(output)
+	<-done
+}
+
+func TestAdapterValidation(t *testing.T) {
+	bus := NewMockBus()
+	client := NewMockClient(bus)
+	output := make(chan string)
+	service := NewMockServiceProducer(output, make(chan string))
+
+	log := &mockLogger{}
+	validator := &mockValidator{}
+	adapter := core.NewAdapter(client, client, []string{"tick"}, service, log)
+	adapter.SetValidator(validator, core.ValidationModeReject, true)
+	done, err := adapter.Start()
+	assert.Nil(t, err)
+
+	responses, err := client.Subscribe([]string{"tick-response"})
+	assert.Nil(t, err)
+
+	log.clear()
+	go func() {
+		client.Publish("tick", `{"topic": "tick", "payload": "invalid"}`)
+		client.Publish("tick", `{"topic": "tick", "payload": "a"}`)
+	}()
+	assert.Equal(t, `{"topic": "tick", "payload": "a"}`, <-service.getInput())
+
+	go func() {
+		output <- `{"topic": "tick-response", "payload": "invalid"}`
+		output <- `{"topic": "tick-response", "payload": "b"}`
+		close(output)
+	}()
+	assert.Equal(t, `{"topic": "tick-response", "payload": "b"}`, <-responses)
+
+	<-done
+
+	assert.Equal(t, 3, len(log.getMessages()))
+	assert.Equal(t, core.LogLevelError, log.getMessages()[0].level)
+	assert.Equal(t, `invalid incoming message: invalid payload at '/payload': {"topic": "tick", "payload": "invalid"}`, log.getMessages()[0].message)
+	assert.Equal(t, `invalid outgoing message: invalid payload at '/payload': {"topic": "tick-response", "payload": "invalid"}`, log.getMessages()[1].message)
+}
+
+func TestAdapterValidationTag(t *testing.T) {
+	bus := NewMockBus()
+	client := NewMockClient(bus)
+	output := make(chan string)
+	service := NewMockServiceProducer(output, make(chan string))
+
+	adapter := core.NewAdapter(client, client, nil, service, logger.NewNoOpLogger())
+	adapter.SetValidator(&mockValidator{}, core.ValidationModeTag, false)
+	done, err := adapter.Start()
+	assert.Nil(t, err)
+
+	responses, err := client.Subscribe([]string{"tick-response"})
+	assert.Nil(t, err)
+
+	go func() {
+		output <- `{"topic": "tick-response", "payload": "invalid"}`
+		close(output)
+	}()
+	msg := <-responses
+	assert.Equal(t, "invalid", gjson.Get(msg, "payload").String())
+	assert.Equal(t, "/payload", gjson.Get(msg, "validation_error.pointer").String())
+	assert.Equal(t, "invalid payload", gjson.Get(msg, "validation_error.reason").String())
+
+	<-done
+}
+
+func TestAdapterPublishPolicy(t *testing.T) {
+	bus := NewMockBus()
+	client := NewMockClient(bus)
+	output := make(chan string)
+	service := NewMockServiceProducer(output, make(chan string))
+
+	log := &mockLogger{}
+	adapter := core.NewAdapter(client, client, nil, service, log)
+	adapter.SetPublishPolicy(core.NewPublishPolicy("root", core.NamespaceModePrefix, []string{"root/tick"}))
+	done, err := adapter.Start()
+	assert.Nil(t, err)
+
+	responses, err := client.Subscribe([]string{"root/tick"})
+	assert.Nil(t, err)
+
+	log.clear()
+	go func() {
+		output <- `{"topic": "root/#"}`
+		output <- `{"topic": "tock"}`
+		output <- `{"topic": "tick", "payload": "a"}`
+		close(output)
+	}()
+	assert.Equal(t, `{"topic": "root/tick", "payload": "a"}`, <-responses)
+
+	<-done
+
+	assert.Equal(t, 3, len(log.getMessages()))
+	assert.Equal(t, core.LogLevelError, log.getMessages()[0].level)
+	assert.Equal(t, `publish policy violation: topic 'root/#' contains wildcards: {"topic": "root/#"}`, log.getMessages()[0].message)
+	assert.Equal(t, core.LogLevelError, log.getMessages()[1].level)
+	assert.Equal(t, `publish policy violation: topic 'root/tock' is not allowed: {"topic": "tock"}`, log.getMessages()[1].message)
 }
 
 type mockBus struct {
-	subscribers map[string]chan<- string
+	mu          sync.Mutex
+	subscribers map[string]*mockSubscriber
+	closed      bool
+}
+
+// mockSubscriber guards closing its channel against deliveries in progress.
+type mockSubscriber struct {
+	mu       sync.Mutex
+	messages chan<- string
+	closed   bool
+}
+
+func (s *mockSubscriber) deliver(message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.messages <- message
+	}
+}
+
+func (s *mockSubscriber) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.messages)
+	}
 }
 
 func NewMockBus() *mockBus {
-	return &mockBus{subscribers: make(map[string]chan<- string)}
+	return &mockBus{subscribers: make(map[string]*mockSubscriber)}
 }
 
 func (b *mockBus) Subscribe(topics []string, messages chan<- string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
 	key := "|" + strings.Join(topics, "|") + "|"
-	b.subscribers[key] = messages
+	b.subscribers[key] = &mockSubscriber{messages: messages}
+}
+
+// Unsubscribe closes the channels of subscriptions without remaining topics.
+func (b *mockBus) Unsubscribe(topics []string) {
+	var closed []*mockSubscriber
+
+	b.mu.Lock()
+	for key, subscriber := range b.subscribers {
+		newKey := key
+		for _, topic := range topics {
+			newKey = strings.Replace(newKey, "|"+topic+"|", "|", 1)
+		}
+		if newKey != key {
+			delete(b.subscribers, key)
+			if newKey == "|" {
+				closed = append(closed, subscriber)
+			} else {
+				b.subscribers[newKey] = subscriber
+			}
+		}
+	}
+	b.mu.Unlock()
+
+	for _, subscriber := range closed {
+		subscriber.close()
+	}
 }
 
+// Publish delivers synchronously. Messages published after close are dropped.
 func (b *mockBus) Publish(topic, message string) {
-	key := "|" + topic + "|"
-	for topics, messages := range b.subscribers {
-		if strings.Contains(topics, key) {
-			messages <- message
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return
+	}
+	var subscribers []*mockSubscriber
+	for key, subscriber := range b.subscribers {
+		for _, pattern := range strings.Split(strings.Trim(key, "|"), "|") {
+			if pattern != "" && core.MatchTopic(pattern, topic) {
+				subscribers = append(subscribers, subscriber)
+				break
+			}
 		}
 	}
+	b.mu.Unlock()
+
+	for _, subscriber := range subscribers {
+		subscriber.deliver(message)
+	}
 }
 
+// close closes the subscriptions once the deliveries in progress returned.
 func (b *mockBus) close() {
-	for _, messages := range b.subscribers {
-		close(messages)
+	b.mu.Lock()
+	b.closed = true
+	var subscribers []*mockSubscriber
+	for _, subscriber := range b.subscribers {
+		subscribers = append(subscribers, subscriber)
+	}
+	b.mu.Unlock()
+
+	for _, subscriber := range subscribers {
+		subscriber.close()
 	}
 }
 
 type mockClient struct {
 	bus                 *mockBus
+	connects            int
 	forceConnectError   bool
 	forceSubscribeError bool
 }
@@ -213,6 +645,7 @@ func NewMockClient(bus *mockBus) *mockClient {
 }
 
 func (c *mockClient) Connect() error {
+	c.connects++
 	if c.forceConnectError {
 		return errors.New("connect error")
 	}
@@ -230,6 +663,11 @@ func (c *mockClient) Subscribe(topics []string) (<-chan string, error) {
 	return messages, nil
 }
 
+func (c *mockClient) Unsubscribe(topics []string) error {
+	c.bus.Unsubscribe(topics)
+	return nil
+}
+
 func (c *mockClient) Publish(topic, message string) error {
 	c.bus.Publish(topic, message)
 	return nil
@@ -237,9 +675,10 @@ func (c *mockClient) Publish(topic, message string) error {
 
 type mockService struct {
 	getOutputMessage func(msg string) string
-	inputMessages    []string
-	outputMessages   []string
-	errorMessages    []string
+
+	mu             sync.Mutex
+	inputMessages  []string
+	outputMessages []string
 }
 
 func NewMockService(getOutputMessage func(msg string) string) *mockService {
@@ -256,16 +695,33 @@ func (sp *mockService) Start(input <-chan string) (output <-chan string, errs <-
 				break
 			}
 			outMsg := sp.getOutputMessage(msg)
-			out <- outMsg
 
+			sp.mu.Lock()
 			sp.inputMessages = append(sp.inputMessages, msg)
 			sp.outputMessages = append(sp.outputMessages, outMsg)
+			sp.mu.Unlock()
+
+			out <- outMsg
 		}
 	}()
 	return out, errs, nil
 }
 
+func (sp *mockService) getInputMessages() []string {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	return append([]string(nil), sp.inputMessages...)
+}
+
+func (sp *mockService) getOutputMessages() []string {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	return append([]string(nil), sp.outputMessages...)
+}
+
 type mockServiceProducer struct {
+	mu              sync.Mutex
+	input           <-chan string
 	output          <-chan string
 	errors          <-chan string
 	forceStartError bool
@@ -280,31 +736,108 @@ func (sp *mockServiceProducer) Start(input <-chan string) (output <-chan string,
 		return nil, nil, fmt.Errorf("start error")
 	}
 
+	sp.mu.Lock()
+	sp.input = input
+	sp.mu.Unlock()
 	return sp.output, sp.errors, nil
 }
 
+// getInput returns the channel of messages delivered to the service.
+func (sp *mockServiceProducer) getInput() <-chan string {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	return sp.input
+}
+
+type mockReadinessProbe struct {
+	mu    sync.Mutex
+	ready bool
+}
+
+func (p *mockReadinessProbe) IsReady() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.ready
+}
+
+func (p *mockReadinessProbe) setReady() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ready = true
+}
+
+type mockValidator struct {
+}
+
+func (*mockValidator) Validate(topic, message string) error {
+	if gjson.Get(message, "payload").String() == "invalid" {
+		return &core.ValidationError{Pointer: "/payload", Reason: "invalid payload"}
+	}
+	return nil
+}
+
 type mockLogger struct {
-	messages []mockLoggerMessage
+	mu           sync.Mutex
+	messages     []mockLoggerMessage
+	levelConsole core.LogLevel
+	levelRemote  core.LogLevel
 }
 
 func (*mockLogger) SetClient(client core.MessageBusClient, namespace, serviceName, serviceUUID, serviceHost string) {
 }
 
-func (*mockLogger) SetLevels(levelConsole, levelRemote core.LogLevel) {
+func (log *mockLogger) SetLevels(levelConsole, levelRemote core.LogLevel) {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	log.levelConsole = levelConsole
+	log.levelRemote = levelRemote
 }
 
 func (*mockLogger) SetCreatedAtGetter(getCreatedAt func() time.Time) {
 }
 
+func (*mockLogger) SetConsoleFormat(format core.ConsoleFormat) {
+}
+
 func (log *mockLogger) Log(level core.LogLevel, message string) {
+	log.mu.Lock()
+	defer log.mu.Unlock()
 	log.messages = append(log.messages, mockLoggerMessage{level: level, message: message})
 }
 
+func (log *mockLogger) LogEntry(entry core.LogEntry) {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	log.messages = append(log.messages, mockLoggerMessage{level: entry.Level, message: entry.Message, createdAt: entry.CreatedAt, fields: entry.Fields})
+}
+
+func (*mockLogger) AddSink(sink core.LogSink) {
+}
+
+func (*mockLogger) SetRemoteLimits(limits core.LogLimits) {
+}
+
 func (log *mockLogger) clear() {
+	log.mu.Lock()
+	defer log.mu.Unlock()
 	log.messages = nil
 }
 
+func (log *mockLogger) getMessages() []mockLoggerMessage {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	return append([]mockLoggerMessage(nil), log.messages...)
+}
+
+func (log *mockLogger) getLevels() (core.LogLevel, core.LogLevel) {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	return log.levelConsole, log.levelRemote
+}
+
 type mockLoggerMessage struct {
-	level   core.LogLevel
-	message string
+	level     core.LogLevel
+	message   string
+	createdAt time.Time
+	fields    map[string]interface{}
 }
@@ -0,0 +1,83 @@
+package core_test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/flaneurtv/samm/core"
+	"testing"
+	"time"
+)
+
+func TestAdapterBatching(t *testing.T) {
+	bus := NewMockBus()
+	client := NewMockClient(bus)
+
+	outputs := make(chan string)
+	errors := make(chan string)
+	service := NewMockServiceProducer(outputs, errors)
+
+	log := &mockLogger{}
+	metrics := core.NewMetrics()
+	adapter := core.NewAdapter(client, client, []string{"root/tick"}, service, log)
+	adapter.SetBatching(2, 100*time.Millisecond)
+	adapter.SetMetrics(metrics)
+	done, err := adapter.Start()
+	assert.Nil(t, err)
+
+	go func() {
+		client.Publish("root/tick", `{"topic": "root/tick", "payload": "a"}`)
+		client.Publish("root/tick", `invalid`)
+		client.Publish("root/tick", `{"topic": "root/tick", "payload": "b"}`)
+		client.Publish("root/tick", `{"topic": "root/tick", "payload": "c"}`)
+	}()
+
+	start := time.Now()
+	assert.Equal(t, `[{"topic": "root/tick", "payload": "a"},{"topic": "root/tick", "payload": "b"}]`, <-service.getInput())
+	assert.Equal(t, `[{"topic": "root/tick", "payload": "c"}]`, <-service.getInput())
+	assert.True(t, time.Since(start) >= 100*time.Millisecond)
+	assert.Equal(t, float64(1), metrics.Sum(core.MetricMessagesDropped))
+
+	go client.Publish("root/tick", `{"topic": "root/tick", "payload": "d"}`)
+	close(outputs)
+	<-done
+
+	// the batch isn't flushed once the service stopped
+	time.Sleep(150 * time.Millisecond)
+	select {
+	case msg := <-service.getInput():
+		t.Errorf("unexpected batch: %s", msg)
+	default:
+	}
+}
+
+func TestAdapterOutputArray(t *testing.T) {
+	bus := NewMockBus()
+	client := NewMockClient(bus)
+
+	outputs := make(chan string)
+	errors := make(chan string)
+	service := NewMockServiceProducer(outputs, errors)
+
+	log := &mockLogger{}
+	adapter := core.NewAdapter(client, client, nil, service, log)
+	_, err := adapter.Start()
+	assert.Nil(t, err)
+
+	messages := collect(client, []string{"root/+"})
+
+	outputs <- `[{"topic": "root/tick", "payload": "a"}, {"payload": "b"}, {"topic": "root/tock", "payload": "c"}]`
+	time.Sleep(100 * time.Millisecond)
+	bus.close()
+
+	assert.Equal(t, []string{
+		`{"topic": "root/tick", "payload": "a"}`,
+		`{"topic": "root/tock", "payload": "c"}`,
+	}, messages())
+
+	var errs []string
+	for _, msg := range log.getMessages() {
+		if msg.level == core.LogLevelError {
+			errs = append(errs, msg.message)
+		}
+	}
+	assert.Equal(t, []string{`missing topic: {"payload": "b"}`}, errs)
+}
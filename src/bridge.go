@@ -1,10 +1,13 @@
 package core
 
 import (
+	"errors"
 	"fmt"
 	"github.com/tidwall/gjson"
 	"github.com/tidwall/sjson"
 	"strings"
+	"sync"
+	"time"
 )
 
 type Bridge struct {
@@ -13,9 +16,33 @@ type Bridge struct {
 	namespaceListener  string
 	namespacePublisher string
 	subscriptions      []string
+	routes             []BridgeRoute
+	bidirectional      bool
+	raw                bool
+	bridgeID           string
+	maxHops            int
+	rateLimiter        *RateLimiter
+	metrics            *Metrics
+	stats              *Stats
 	logger             Logger
 }
 
+// bridgeLeg forwards the messages of one direction.
+type bridgeLeg struct {
+	direction BridgeDirection
+	source    MessageBusClient
+	target    MessageBusClient
+	topics    []string
+	resolve   func(topic, msg string) []bridgeTarget
+}
+
+type bridgeTarget struct {
+	topic string
+	route *BridgeRoute
+}
+
+const bridgeViaField = "bridge_via"
+
 func NewBridge(listener, publisher MessageBusClient, namespaceListener, namespacePublisher string, subscriptions []string, logger Logger) *Bridge {
 	return &Bridge{
 		listener:           listener,
@@ -27,7 +54,76 @@ func NewBridge(listener, publisher MessageBusClient, namespaceListener, namespac
 	}
 }
 
+// SetRoutes replaces the namespace rewriting and subscriptions of the bridge
+// with the given routes.
+func (b *Bridge) SetRoutes(routes []BridgeRoute) {
+	b.routes = routes
+}
+
+// SetBidirectional additionally bridges the subscriptions, rewritten to the
+// publisher namespace, from the publisher back to the listener.
+func (b *Bridge) SetBidirectional(bidirectional bool) {
+	b.bidirectional = bidirectional
+}
+
+// SetRaw forwards payloads of any format byte by byte using the topic they
+// were published to. Retain flag and QoS are preserved. Both clients have to
+// implement RawMessageBusClient.
+func (b *Bridge) SetRaw(raw bool) {
+	b.raw = raw
+}
+
+// SetLoopPrevention adds the bridge id to the "bridge_via" list of every
+// forwarded message and drops messages that already passed this bridge or
+// more than maxHops bridges. A maxHops of 0 disables the hop limit.
+func (b *Bridge) SetLoopPrevention(bridgeID string, maxHops int) {
+	b.bridgeID = bridgeID
+	b.maxHops = maxHops
+}
+
+func (b *Bridge) SetRateLimiter(limiter *RateLimiter) {
+	b.rateLimiter = limiter
+}
+
+// SetMetrics counts received, relayed and dropped messages and observes the
+// time from receiving a message until it's relayed.
+func (b *Bridge) SetMetrics(metrics *Metrics) {
+	b.metrics = metrics
+}
+
+// SetStats publishes the stats periodically while the bridge is running.
+func (b *Bridge) SetStats(stats *Stats) {
+	b.stats = stats
+}
+
 func (b *Bridge) Start() (<-chan struct{}, error) {
+	if b.raw {
+		if b.bridgeID != "" {
+			return nil, errors.New("loop prevention can't be used with raw messages")
+		}
+		if b.bidirectional {
+			return nil, errors.New("raw messages can't be bridged bidirectionally without loop prevention")
+		}
+		if _, ok := b.listener.(RawMessageBusClient); !ok {
+			return nil, errors.New("listener doesn't support raw messages")
+		}
+		if _, ok := b.publisher.(RawMessageBusClient); !ok {
+			return nil, errors.New("publisher doesn't support raw messages")
+		}
+		for _, route := range b.routes {
+			if len(route.Transforms) > 0 {
+				return nil, fmt.Errorf("route '%s': transforms can't be used with raw messages", route.Name)
+			}
+		}
+	}
+
+	legs := b.legs()
+	for _, leg := range legs {
+		if leg.direction == BridgeDirectionReverse && b.bridgeID == "" {
+			return nil, errors.New("messages can't be bridged in reverse without loop prevention")
+		}
+	}
+
 	err := b.listener.Connect()
 	if err != nil {
 		return nil, fmt.Errorf("can't connect: %s", err)
@@ -42,41 +138,247 @@ func (b *Bridge) Start() (<-chan struct{}, error) {
 		b.logger.Log(LogLevelDebug, "MQTT connection: listener and publisher are equal")
 	}
 
-	inputMessages, err := b.listener.Subscribe(b.subscriptions)
-	if err != nil {
-		return nil, fmt.Errorf("can't subscribe: %s", err)
-	} else {
-		b.logger.Log(LogLevelInfo, fmt.Sprintf("Topics subscribed: %s", strings.Join(b.subscriptions, ", ")))
+	var wg sync.WaitGroup
+	for _, leg := range legs {
+		var forward func()
+		if b.raw {
+			inputMessages, err := leg.source.(RawMessageBusClient).SubscribeRaw(leg.topics)
+			if err != nil {
+				return nil, fmt.Errorf("can't subscribe: %s", err)
+			}
+			forward = func() { b.forwardRaw(leg, inputMessages) }
+		} else {
+			inputMessages, err := leg.source.Subscribe(leg.topics)
+			if err != nil {
+				return nil, fmt.Errorf("can't subscribe: %s", err)
+			}
+			forward = func() { b.forward(leg, inputMessages) }
+		}
+
+		if leg.direction == BridgeDirectionForward {
+			b.logger.Log(LogLevelInfo, fmt.Sprintf("Topics subscribed: %s", strings.Join(leg.topics, ", ")))
+		} else {
+			b.logger.Log(LogLevelInfo, fmt.Sprintf("Topics subscribed (%s): %s", leg.direction, strings.Join(leg.topics, ", ")))
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			forward()
+		}()
 	}
 
 	done := make(chan struct{})
 	go func() {
-		defer close(done)
-
-		for inpMsg := range inputMessages {
-			if gjson.Valid(inpMsg) {
-				inpTopic := gjson.Get(inpMsg, "topic").String()
-				if inpTopic != "" {
-					topic, msg := inpTopic, inpMsg
-					if b.namespacePublisher != b.namespaceListener {
-						topic = strings.Replace(inpTopic, b.namespaceListener+"/", b.namespacePublisher+"/", 1)
-						msg, _ = sjson.Set(msg, "topic", topic)
-					}
-
-					err := b.publisher.Publish(topic, msg)
-					if err != nil {
-						b.logger.Log(LogLevelError, fmt.Sprintf("MQTT message for bridge dropped: %s, error=%s", msg, err))
-					} else {
-						b.logger.Log(LogLevelDebug, fmt.Sprintf("MQTT message relayed through bridge: %s => %s", inpTopic, topic))
-					}
-				} else {
-					b.logger.Log(LogLevelError, fmt.Sprintf("missing topic: %s", inpMsg))
+		wg.Wait()
+		close(done)
+	}()
+
+	if b.stats != nil {
+		go b.stats.run(nil, done)
+	}
+
+	return done, nil
+}
+
+func (b *Bridge) legs() []*bridgeLeg {
+	if len(b.routes) == 0 {
+		legs := []*bridgeLeg{{
+			direction: BridgeDirectionForward,
+			source:    b.listener,
+			target:    b.publisher,
+			topics:    b.subscriptions,
+			resolve:   namespaceResolver(b.namespaceListener, b.namespacePublisher),
+		}}
+
+		if b.bidirectional {
+			subscriptions := make([]string, 0, len(b.subscriptions))
+			for _, topic := range b.subscriptions {
+				subscriptions = append(subscriptions, strings.Replace(topic, b.namespaceListener+"/", b.namespacePublisher+"/", 1))
+			}
+
+			legs = append(legs, &bridgeLeg{
+				direction: BridgeDirectionReverse,
+				source:    b.publisher,
+				target:    b.listener,
+				topics:    subscriptions,
+				resolve:   namespaceResolver(b.namespacePublisher, b.namespaceListener),
+			})
+		}
+		return legs
+	}
+
+	var legs []*bridgeLeg
+	for _, direction := range []BridgeDirection{BridgeDirectionForward, BridgeDirectionReverse} {
+		var routes []BridgeRoute
+		var topics []string
+		for _, route := range b.routes {
+			if route.Direction != direction {
+				continue
+			}
+			routes = append(routes, route)
+			for _, source := range route.Sources {
+				if !containsTopic(topics, source) {
+					topics = append(topics, source)
 				}
+			}
+		}
+		if len(routes) == 0 {
+			continue
+		}
+
+		leg := &bridgeLeg{
+			direction: direction,
+			source:    b.listener,
+			target:    b.publisher,
+			topics:    topics,
+			resolve:   routesResolver(routes),
+		}
+		if direction == BridgeDirectionReverse {
+			leg.source, leg.target = b.publisher, b.listener
+		}
+		legs = append(legs, leg)
+	}
+	return legs
+}
+
+func namespaceResolver(namespaceSource, namespaceTarget string) func(topic, msg string) []bridgeTarget {
+	return func(topic, msg string) []bridgeTarget {
+		if namespaceTarget != namespaceSource {
+			topic = strings.Replace(topic, namespaceSource+"/", namespaceTarget+"/", 1)
+		}
+		return []bridgeTarget{{topic: topic}}
+	}
+}
+
+func routesResolver(routes []BridgeRoute) func(topic, msg string) []bridgeTarget {
+	return func(topic, msg string) []bridgeTarget {
+		var targets []bridgeTarget
+		for i := range routes {
+			if target, ok := routes[i].Apply(topic, msg); ok {
+				targets = append(targets, bridgeTarget{topic: target, route: &routes[i]})
+			}
+		}
+		return targets
+	}
+}
+
+func (b *Bridge) forward(leg *bridgeLeg, inputMessages <-chan string) {
+	for inpMsg := range inputMessages {
+		receivedAt := time.Now()
+		if !gjson.Valid(inpMsg) {
+			b.metrics.Inc(MetricMessagesReceived, "subscription", strings.Join(leg.topics, ","))
+			b.metrics.Inc(MetricInvalidJSON)
+			b.logger.Log(LogLevelError, fmt.Sprintf("invalid json: %s", inpMsg))
+			continue
+		}
+
+		inpTopic := gjson.Get(inpMsg, "topic").String()
+		b.metrics.Inc(MetricMessagesReceived, "subscription", matchingSubscription(leg.topics, inpTopic))
+		if inpTopic == "" {
+			b.metrics.Inc(MetricMissingTopic)
+			b.logger.Log(LogLevelError, fmt.Sprintf("missing topic: %s", inpMsg))
+			continue
+		}
+
+		// checked before transforms, which may change the bridge_via list
+		var via []string
+		if b.bridgeID != "" {
+			var ok bool
+			via, ok = b.checkVia(inpMsg)
+			if !ok {
+				continue
+			}
+		}
+
+		for _, target := range leg.resolve(inpTopic, inpMsg) {
+			msg := inpMsg
+			if target.route != nil && len(target.route.Transforms) > 0 {
+				var err error
+				msg, err = ApplyTransforms(target.route.Transforms, msg)
+				if err != nil {
+					b.metrics.Inc(MetricMessagesDropped, "reason", DropReasonTransform)
+					b.logger.Log(LogLevelError, fmt.Sprintf("can't transform message for route '%s': %s: %s", target.route.Name, err, inpMsg))
+					continue
+				}
+			}
+			if target.topic != gjson.Get(msg, "topic").String() {
+				msg, _ = sjson.Set(msg, "topic", target.topic)
+			}
+			if b.bridgeID != "" {
+				msg, _ = sjson.Set(msg, bridgeViaField, append(via, b.bridgeID))
+			}
+			b.relay(leg.target, inpTopic, target.topic, msg, receivedAt)
+		}
+	}
+}
+
+func (b *Bridge) forwardRaw(leg *bridgeLeg, inputMessages <-chan RawMessage) {
+	publisher := leg.target.(RawMessageBusClient)
+	for inpMsg := range inputMessages {
+		receivedAt := time.Now()
+		b.metrics.Inc(MetricMessagesReceived, "subscription", matchingSubscription(leg.topics, inpMsg.Topic))
+		for _, target := range leg.resolve(inpMsg.Topic, string(inpMsg.Payload)) {
+			topic := target.topic
+			if b.rateLimiter != nil && !b.rateLimiter.Wait(topic) {
+				b.metrics.Inc(MetricMessagesDropped, "reason", DropReasonRateLimit)
+				b.logger.Log(LogLevelDebug, fmt.Sprintf("rate limit exceeded, MQTT message for bridge dropped: %s", topic))
+				continue
+			}
+
+			msg := inpMsg
+			msg.Topic = topic
+
+			err := publisher.PublishRaw(msg)
+			if err != nil {
+				b.metrics.Inc(MetricPublishErrors)
+				b.logger.Log(LogLevelError, fmt.Sprintf("MQTT message for bridge dropped: %s, error=%s", inpMsg.Topic, err))
 			} else {
-				b.logger.Log(LogLevelError, fmt.Sprintf("invalid json: %s", inpMsg))
+				b.published(topic, receivedAt)
+				b.logger.Log(LogLevelDebug, fmt.Sprintf("MQTT message relayed through bridge: %s => %s", inpMsg.Topic, topic))
 			}
 		}
-	}()
+	}
+}
 
-	return done, nil
+// checkVia returns the bridges a received message passed. It is false if the
+// message passed this bridge or too many bridges already.
+func (b *Bridge) checkVia(msg string) ([]string, bool) {
+	var via []string
+	for _, id := range gjson.Get(msg, bridgeViaField).Array() {
+		if id.String() == b.bridgeID {
+			b.metrics.Inc(MetricMessagesDropped, "reason", DropReasonLoop)
+			b.logger.Log(LogLevelDebug, fmt.Sprintf("MQTT message already passed bridge '%s', dropped: %s", b.bridgeID, msg))
+			return nil, false
+		}
+		via = append(via, id.String())
+	}
+	if b.maxHops > 0 && len(via) >= b.maxHops {
+		b.metrics.Inc(MetricMessagesDropped, "reason", DropReasonLoop)
+		b.logger.Log(LogLevelWarning, fmt.Sprintf("MQTT message exceeds %d bridge hops, dropped: %s", b.maxHops, msg))
+		return nil, false
+	}
+	return via, true
+}
+
+func (b *Bridge) relay(target MessageBusClient, inpTopic, topic, msg string, receivedAt time.Time) {
+	if b.rateLimiter != nil && !b.rateLimiter.Wait(topic) {
+		b.metrics.Inc(MetricMessagesDropped, "reason", DropReasonRateLimit)
+		b.logger.Log(LogLevelDebug, fmt.Sprintf("rate limit exceeded, MQTT message for bridge dropped: %s", msg))
+		return
+	}
+
+	err := target.Publish(topic, msg)
+	if err != nil {
+		b.metrics.Inc(MetricPublishErrors)
+		b.logger.Log(LogLevelError, fmt.Sprintf("MQTT message for bridge dropped: %s, error=%s", msg, err))
+	} else {
+		b.published(topic, receivedAt)
+		b.logger.Log(LogLevelDebug, fmt.Sprintf("MQTT message relayed through bridge: %s => %s", inpTopic, topic))
+	}
+}
+
+func (b *Bridge) published(topic string, receivedAt time.Time) {
+	b.metrics.Inc(MetricMessagesPublished, "topic", b.metrics.TopicLabel(topic))
+	b.metrics.Observe(MetricProcessingLatency, time.Since(receivedAt).Seconds())
 }
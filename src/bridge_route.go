@@ -0,0 +1,120 @@
+package core
+
+import (
+	"fmt"
+	"github.com/tidwall/gjson"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type BridgeDirection string
+
+const (
+	BridgeDirectionForward BridgeDirection = "forward"
+	BridgeDirectionReverse BridgeDirection = "reverse"
+)
+
+func ParseBridgeDirection(s string) (BridgeDirection, bool) {
+	switch BridgeDirection(s) {
+	case "", BridgeDirectionForward:
+		return BridgeDirectionForward, true
+	case BridgeDirectionReverse:
+		return BridgeDirectionReverse, true
+	}
+	return "", false
+}
+
+type BridgeRoute struct {
+	Name       string
+	Sources    []string
+	Target     string
+	Direction  BridgeDirection
+	Filters    []BridgeFilter
+	Transforms []Transform
+}
+
+type BridgeFilter struct {
+	Path    string
+	Exists  *bool
+	Equals  string
+	Matches *regexp.Regexp
+}
+
+var targetPlaceholder = regexp.MustCompile(`\{(\d+)\}`)
+
+func (r *BridgeRoute) Validate() error {
+	if len(r.Sources) == 0 {
+		return fmt.Errorf("route '%s': sources can't be empty", r.Name)
+	}
+	if r.Target == "" {
+		return fmt.Errorf("route '%s': target can't be empty", r.Name)
+	}
+
+	required := 0
+	for _, match := range targetPlaceholder.FindAllStringSubmatch(r.Target, -1) {
+		index, _ := strconv.Atoi(match[1])
+		if index < 1 {
+			return fmt.Errorf("route '%s': placeholder '%s' should start at {1}", r.Name, match[0])
+		}
+		if index > required {
+			required = index
+		}
+	}
+	for _, source := range r.Sources {
+		if count := CountTopicWildcards(source); count < required {
+			return fmt.Errorf("route '%s': source '%s' has %d wildcards, target '%s' uses {%d}", r.Name, source, count, r.Target, required)
+		}
+	}
+
+	for _, filter := range r.Filters {
+		if filter.Path == "" {
+			return fmt.Errorf("route '%s': filter path can't be empty", r.Name)
+		}
+	}
+	return nil
+}
+
+// Apply returns the target topic of a message received on the given topic,
+// or false if the route doesn't accept the message.
+func (r *BridgeRoute) Apply(topic, msg string) (string, bool) {
+	for _, source := range r.Sources {
+		captures, ok := MatchTopicCaptures(source, topic)
+		if !ok {
+			continue
+		}
+		for _, filter := range r.Filters {
+			if !filter.Match(msg) {
+				return "", false
+			}
+		}
+		return expandTarget(r.Target, captures), true
+	}
+	return "", false
+}
+
+func (f *BridgeFilter) Match(msg string) bool {
+	value := gjson.Get(msg, f.Path)
+	if f.Exists != nil && value.Exists() != *f.Exists {
+		return false
+	}
+	if f.Equals != "" {
+		if !value.Exists() || !reflect.DeepEqual(value.Value(), gjson.Parse(f.Equals).Value()) {
+			return false
+		}
+	}
+	if f.Matches != nil {
+		if !value.Exists() || !f.Matches.MatchString(value.String()) {
+			return false
+		}
+	}
+	return true
+}
+
+func expandTarget(target string, captures []string) string {
+	return targetPlaceholder.ReplaceAllStringFunc(target, func(placeholder string) string {
+		index, _ := strconv.Atoi(strings.Trim(placeholder, "{}"))
+		return captures[index-1]
+	})
+}
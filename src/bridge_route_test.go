@@ -0,0 +1,52 @@
+package core_test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/flaneurtv/samm/core"
+	"regexp"
+	"testing"
+)
+
+func TestBridgeRouteApply(t *testing.T) {
+	route := core.BridgeRoute{
+		Sources: []string{"tick/+/status", "tock/#"},
+		Target:  "tack/{1}",
+	}
+
+	topic, ok := route.Apply("tick/first/status", `{}`)
+	assert.True(t, ok)
+	assert.Equal(t, "tack/first", topic)
+
+	topic, ok = route.Apply("tock/second/status", `{}`)
+	assert.True(t, ok)
+	assert.Equal(t, "tack/second/status", topic)
+
+	_, ok = route.Apply("tick/first/config", `{}`)
+	assert.False(t, ok)
+}
+
+func TestBridgeFilter(t *testing.T) {
+	exists, missing := true, false
+	msg := `{"payload": {"level": "error", "count": 2, "tags": ["a"]}}`
+
+	assert.True(t, (&core.BridgeFilter{Path: "payload.level", Exists: &exists}).Match(msg))
+	assert.False(t, (&core.BridgeFilter{Path: "payload.level", Exists: &missing}).Match(msg))
+	assert.True(t, (&core.BridgeFilter{Path: "payload.other", Exists: &missing}).Match(msg))
+	assert.True(t, (&core.BridgeFilter{Path: "payload.level", Equals: `"error"`}).Match(msg))
+	assert.True(t, (&core.BridgeFilter{Path: "payload.count", Equals: `2.0`}).Match(msg))
+	assert.True(t, (&core.BridgeFilter{Path: "payload.tags", Equals: `["a"]`}).Match(msg))
+	assert.False(t, (&core.BridgeFilter{Path: "payload.count", Equals: `"2"`}).Match(msg))
+	assert.False(t, (&core.BridgeFilter{Path: "payload.other", Equals: `null`}).Match(msg))
+	assert.True(t, (&core.BridgeFilter{Path: "payload.level", Matches: regexp.MustCompile("^err")}).Match(msg))
+	assert.False(t, (&core.BridgeFilter{Path: "payload.other", Matches: regexp.MustCompile(".*")}).Match(msg))
+}
+
+func TestBridgeRouteValidate(t *testing.T) {
+	route := core.BridgeRoute{Name: "ticks", Sources: []string{"tick/+", "tock/#"}, Target: "tack/{1}"}
+	assert.Nil(t, route.Validate())
+
+	route.Target = "tack/{1}/{2}"
+	err := route.Validate()
+	assert.NotNil(t, err)
+	assert.Equal(t, "route 'ticks': source 'tick/+' has 1 wildcards, target 'tack/{1}/{2}' uses {2}", err.Error())
+}
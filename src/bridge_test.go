@@ -2,6 +2,7 @@ package core_test
 
 import (
 	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
 	"gitlab.com/flaneurtv/samm/core"
 	"gitlab.com/flaneurtv/samm/core/logger"
 	"sync"
@@ -82,3 +83,316 @@ func TestBridgeSubscribeError(t *testing.T) {
 	assert.NotNil(t, err)
 	assert.Equal(t, "can't subscribe: subscribe error", err.Error())
 }
+
+func TestBridgeRoutes(t *testing.T) {
+	listenerBus := NewMockBus()
+	publisherBus := NewMockBus()
+	listenerClient := NewMockClient(listenerBus)
+	publisherClient := NewMockClient(publisherBus)
+
+	enabled := true
+	bridge := core.NewBridge(NewMockClient(listenerBus), NewMockClient(publisherBus), "tick", "tack", nil, logger.NewNoOpLogger())
+	bridge.SetRoutes([]core.BridgeRoute{
+		{Name: "status", Sources: []string{"tick/+/status"}, Target: "tack/{1}/state", Direction: core.BridgeDirectionForward},
+		{Name: "enabled", Sources: []string{"tick/+/config"}, Target: "tack/config/{1}", Direction: core.BridgeDirectionForward,
+			Filters: []core.BridgeFilter{{Path: "payload.enabled", Equals: "true"}, {Path: "payload.name", Exists: &enabled}}},
+		{Name: "commands", Sources: []string{"tack/command/#"}, Target: "tick/{1}/command", Direction: core.BridgeDirectionReverse},
+	})
+	bridge.SetLoopPrevention("bridge-1", 0)
+	done, err := bridge.Start()
+	assert.Nil(t, err)
+
+	forwarded := collect(publisherClient, []string{"tack/+/state", "tack/config/+"})
+	reversed := collect(listenerClient, []string{"tick/+/command"})
+
+	listenerClient.Publish("tick/first/status", `{"topic": "tick/first/status", "payload": "a"}`)
+	listenerClient.Publish("tick/first/config", `{"topic": "tick/first/config", "payload": {"enabled": true, "name": "b"}}`)
+	listenerClient.Publish("tick/first/config", `{"topic": "tick/first/config", "payload": {"enabled": false, "name": "c"}}`)
+	listenerClient.Publish("tick/first/config", `{"topic": "tick/first/config", "payload": {"enabled": true}}`)
+	publisherClient.Publish("tack/command/second", `{"topic": "tack/command/second", "payload": "d"}`)
+
+	time.Sleep(time.Millisecond * 500)
+	listenerBus.close()
+	publisherBus.close()
+	<-done
+
+	assert.Equal(t, []string{
+		`{"bridge_via":["bridge-1"],"topic": "tack/first/state", "payload": "a"}`,
+		`{"bridge_via":["bridge-1"],"topic": "tack/config/first", "payload": {"enabled": true, "name": "b"}}`,
+	}, forwarded())
+	assert.Equal(t, []string{`{"bridge_via":["bridge-1"],"topic": "tick/second/command", "payload": "d"}`}, reversed())
+}
+
+func collect(client core.MessageBusClient, topics []string) func() []string {
+	output, _ := client.Subscribe(topics)
+
+	var messages []string
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		for msg := range output {
+			messages = append(messages, msg)
+		}
+		wg.Done()
+	}()
+
+	return func() []string {
+		wg.Wait()
+		return messages
+	}
+}
+
+func TestBridgeLoopPrevention(t *testing.T) {
+	bus := NewMockBus()
+	client := NewMockClient(bus)
+
+	bridge := core.NewBridge(NewMockClient(bus), NewMockClient(bus), "tick", "tack", []string{"tick/+"}, logger.NewNoOpLogger())
+	bridge.SetBidirectional(true)
+	bridge.SetLoopPrevention("bridge-1", 2)
+	done, err := bridge.Start()
+	assert.Nil(t, err)
+
+	ticks := collect(client, []string{"tick/#"})
+	tacks := collect(client, []string{"tack/#"})
+
+	// the mock bus delivers synchronously, so both directions must not relay at the same time
+	for _, msg := range []string{
+		`{"topic":"tick/first","payload":"a"}`,
+		`{"topic":"tack/second","payload":"b"}`,
+		`{"topic":"tick/third","payload":"c","bridge_via":["bridge-2","bridge-3"]}`,
+		`{"topic":"tick/fourth","payload":"d","bridge_via":["bridge-2"]}`,
+	} {
+		client.Publish(gjson.Get(msg, "topic").String(), msg)
+		time.Sleep(time.Millisecond * 100)
+	}
+	bus.close()
+	<-done
+
+	assert.Equal(t, []string{
+		`{"topic":"tick/first","payload":"a"}`,
+		`{"bridge_via":["bridge-1"],"topic":"tick/second","payload":"b"}`,
+		`{"topic":"tick/third","payload":"c","bridge_via":["bridge-2","bridge-3"]}`,
+		`{"topic":"tick/fourth","payload":"d","bridge_via":["bridge-2"]}`,
+	}, ticks())
+	assert.Equal(t, []string{
+		`{"bridge_via":["bridge-1"],"topic":"tack/first","payload":"a"}`,
+		`{"topic":"tack/second","payload":"b"}`,
+		`{"topic":"tack/fourth","payload":"d","bridge_via":["bridge-2","bridge-1"]}`,
+	}, tacks())
+}
+
+func TestBridgeRaw(t *testing.T) {
+	bus := NewMockRawBus()
+	client := NewMockRawClient(bus)
+
+	bridge := core.NewBridge(NewMockRawClient(bus), NewMockRawClient(bus), "tick", "tack", []string{"tick/+"}, logger.NewNoOpLogger())
+	bridge.SetRaw(true)
+	done, err := bridge.Start()
+	assert.Nil(t, err)
+
+	output, err := client.SubscribeRaw([]string{"tack/+"})
+	assert.Nil(t, err)
+
+	var messages []core.RawMessage
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		for msg := range output {
+			messages = append(messages, msg)
+		}
+		wg.Done()
+	}()
+
+	client.PublishRaw(core.RawMessage{Topic: "tick/first", Payload: []byte{0x00, 0xff}, QoS: 1, Retained: true})
+	client.PublishRaw(core.RawMessage{Topic: "tick/second", Payload: []byte(`{"topic": "tick/other"}`)})
+
+	time.Sleep(time.Millisecond * 500)
+	bus.close()
+	<-done
+	wg.Wait()
+
+	assert.Equal(t, []core.RawMessage{
+		{Topic: "tack/first", Payload: []byte{0x00, 0xff}, QoS: 1, Retained: true},
+		{Topic: "tack/second", Payload: []byte(`{"topic": "tick/other"}`)},
+	}, messages)
+}
+
+func TestBridgeRawErrors(t *testing.T) {
+	bus := NewMockBus()
+	client := NewMockClient(bus)
+	bridge := core.NewBridge(client, client, "tick", "tack", []string{"tick/first"}, logger.NewNoOpLogger())
+	bridge.SetRaw(true)
+	_, err := bridge.Start()
+	assert.NotNil(t, err)
+	assert.Equal(t, "listener doesn't support raw messages", err.Error())
+
+	rawClient := NewMockRawClient(NewMockRawBus())
+	bridge = core.NewBridge(rawClient, rawClient, "tick", "tack", []string{"tick/first"}, logger.NewNoOpLogger())
+	bridge.SetRaw(true)
+	bridge.SetLoopPrevention("bridge-1", 0)
+	_, err = bridge.Start()
+	assert.NotNil(t, err)
+	assert.Equal(t, "loop prevention can't be used with raw messages", err.Error())
+
+	bridge = core.NewBridge(rawClient, rawClient, "tick", "tack", []string{"tick/first"}, logger.NewNoOpLogger())
+	bridge.SetRaw(true)
+	bridge.SetBidirectional(true)
+	_, err = bridge.Start()
+	assert.NotNil(t, err)
+	assert.Equal(t, "raw messages can't be bridged bidirectionally without loop prevention", err.Error())
+}
+
+func TestBridgeReverseWithoutLoopPrevention(t *testing.T) {
+	client := NewMockClient(NewMockBus())
+	bridge := core.NewBridge(client, client, "tick", "tack", []string{"tick/first"}, logger.NewNoOpLogger())
+	bridge.SetBidirectional(true)
+	_, err := bridge.Start()
+	assert.NotNil(t, err)
+	assert.Equal(t, "messages can't be bridged in reverse without loop prevention", err.Error())
+
+	bridge = core.NewBridge(client, client, "tick", "tack", nil, logger.NewNoOpLogger())
+	bridge.SetRoutes([]core.BridgeRoute{
+		{Name: "commands", Sources: []string{"tack/command/#"}, Target: "tick/{1}/command", Direction: core.BridgeDirectionReverse},
+	})
+	_, err = bridge.Start()
+	assert.NotNil(t, err)
+	assert.Equal(t, "messages can't be bridged in reverse without loop prevention", err.Error())
+	assert.Equal(t, 0, client.connects)
+}
+
+type mockRawBus struct {
+	mu          sync.Mutex
+	subscribers map[*[]string]chan<- core.RawMessage
+	closed      bool
+	sending     sync.WaitGroup
+}
+
+func NewMockRawBus() *mockRawBus {
+	return &mockRawBus{subscribers: make(map[*[]string]chan<- core.RawMessage)}
+}
+
+func (b *mockRawBus) Publish(msg core.RawMessage) {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return
+	}
+	var subscribers []chan<- core.RawMessage
+	for topics, messages := range b.subscribers {
+		for _, pattern := range *topics {
+			if core.MatchTopic(pattern, msg.Topic) {
+				subscribers = append(subscribers, messages)
+				break
+			}
+		}
+	}
+	b.sending.Add(1)
+	b.mu.Unlock()
+	defer b.sending.Done()
+
+	for _, messages := range subscribers {
+		messages <- msg
+	}
+}
+
+func (b *mockRawBus) close() {
+	b.mu.Lock()
+	b.closed = true
+	b.mu.Unlock()
+
+	b.sending.Wait()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, messages := range b.subscribers {
+		close(messages)
+	}
+}
+
+type mockRawClient struct {
+	*mockClient
+	rawBus *mockRawBus
+}
+
+func NewMockRawClient(bus *mockRawBus) *mockRawClient {
+	return &mockRawClient{mockClient: NewMockClient(NewMockBus()), rawBus: bus}
+}
+
+func (c *mockRawClient) SubscribeRaw(topics []string) (<-chan core.RawMessage, error) {
+	messages := make(chan core.RawMessage)
+	c.rawBus.mu.Lock()
+	c.rawBus.subscribers[&topics] = messages
+	c.rawBus.mu.Unlock()
+	return messages, nil
+}
+
+func (c *mockRawClient) PublishRaw(msg core.RawMessage) error {
+	c.rawBus.Publish(msg)
+	return nil
+}
+
+func TestBridgeTransformsLoopPrevention(t *testing.T) {
+	bus := NewMockBus()
+	client := NewMockClient(bus)
+
+	del, _ := core.ParseTransform("del(bridge_via)")
+	bridge := core.NewBridge(NewMockClient(bus), NewMockClient(bus), "tick", "tack", nil, logger.NewNoOpLogger())
+	bridge.SetRoutes([]core.BridgeRoute{
+		{Name: "users", Sources: []string{"tick/users"}, Target: "tack/users", Direction: core.BridgeDirectionForward, Transforms: []core.Transform{del}},
+	})
+	bridge.SetLoopPrevention("bridge-1", 0)
+	done, err := bridge.Start()
+	assert.Nil(t, err)
+
+	users := collect(client, []string{"tack/users"})
+
+	client.Publish("tick/users", `{"topic":"tick/users","payload":"a","bridge_via":["bridge-1"]}`)
+	client.Publish("tick/users", `{"topic":"tick/users","payload":"b","bridge_via":["bridge-2"]}`)
+
+	time.Sleep(time.Millisecond * 100)
+	bus.close()
+	<-done
+
+	messages := users()
+	if assert.Equal(t, 1, len(messages)) {
+		assert.JSONEq(t, `{"topic":"tack/users","payload":"b","bridge_via":["bridge-2","bridge-1"]}`, messages[0])
+	}
+}
+
+func TestBridgeTransforms(t *testing.T) {
+	bus := NewMockBus()
+	client := NewMockClient(bus)
+
+	redact, _ := core.ParseTransform("redact(payload.email)")
+	rename, _ := core.ParseTransform("rename(payload.id, payload.user_id)")
+	log := &mockLogger{}
+	bridge := core.NewBridge(NewMockClient(bus), NewMockClient(bus), "tick", "tack", nil, log)
+	bridge.SetRoutes([]core.BridgeRoute{
+		{Name: "users", Sources: []string{"tick/users"}, Target: "tack/users", Direction: core.BridgeDirectionForward, Transforms: []core.Transform{redact, rename}},
+	})
+	done, err := bridge.Start()
+	assert.Nil(t, err)
+
+	users := collect(client, []string{"tack/users"})
+
+	client.Publish("tick/users", `{"topic":"tick/users","payload":{"id":1,"email":"a@example.com"}}`)
+	client.Publish("tick/users", `{"topic":"tick/users","payload":{"email":"b@example.com"}}`)
+
+	time.Sleep(time.Millisecond * 500)
+	bus.close()
+	<-done
+
+	messages := users()
+	if assert.Equal(t, 1, len(messages)) {
+		assert.JSONEq(t, `{"topic":"tack/users","payload":{"email":"***","user_id":1}}`, messages[0])
+	}
+
+	var errs []string
+	for _, msg := range log.getMessages() {
+		if msg.level == core.LogLevelError {
+			errs = append(errs, msg.message)
+		}
+	}
+	assert.Equal(t, []string{`can't transform message for route 'users': rename(payload.id, payload.user_id): path 'payload.id' doesn't exist: {"topic":"tick/users","payload":{"email":"b@example.com"}}`}, errs)
+}
@@ -7,6 +7,7 @@ import (
 	"gitlab.com/flaneurtv/samm/core/logger"
 	"gitlab.com/flaneurtv/samm/core/mqtt"
 	"gitlab.com/flaneurtv/samm/core/process"
+	"gitlab.com/flaneurtv/samm/core/schema"
 	"os"
 )
 
@@ -32,28 +33,187 @@ func main() {
 	logLevelConsole, _ := core.ParseLogLevel(cfg.LogLevelConsole())
 	logLevelRemote, _ := core.ParseLogLevel(cfg.LogLevelRemote())
 	log.SetLevels(logLevelConsole, logLevelRemote)
+	consoleFormat, _ := core.ParseConsoleFormat(cfg.LogFormat())
+	log.SetConsoleFormat(consoleFormat)
+	sinks, err := logger.NewSinks(cfg)
+	if err != nil {
+		log.Log(core.LogLevelCritical, fmt.Sprintf("can't create log sinks: %s", err))
+		os.Exit(1)
+	}
+	for _, sink := range sinks {
+		log.AddSink(sink)
+	}
+	log.SetRemoteLimits(cfg.LogLimits())
+
+	var metrics *core.Metrics
+	if cfg.MetricsAddress() != "" || cfg.StatsInterval() > 0 {
+		metrics = core.NewMetrics()
+	}
+	if cfg.MetricsAddress() != "" {
+		err = core.ServeMetrics(cfg.MetricsAddress(), cfg.MetricsPath(), metrics)
+		if err != nil {
+			log.Log(core.LogLevelCritical, err.Error())
+			os.Exit(1)
+		}
+	}
 
 	listenerClientID := fmt.Sprintf("%s_%s_%s_listener", cfg.ServiceName(), cfg.ServiceHost(), cfg.ServiceUUID())
-	listener := mqtt.NewMQTTClient(cfg.ListenerURL(), listenerClientID, cfg.ListenerCredentials(), log, nil)
+	listener := mqtt.NewMQTTClient(cfg.ListenerURL(), listenerClientID, cfg.ListenerCredentials(), log, func(err error) {
+		metrics.Inc(core.MetricConnectionLost, "client", "listener")
+	})
 
 	var publisher core.MessageBusClient
 	if cfg.ListenerURL() != cfg.PublisherURL() || cfg.ListenerCredentials() != cfg.PublisherCredentials() {
 		publisherClientID := fmt.Sprintf("%s_%s_%s_publisher", cfg.ServiceName(), cfg.ServiceHost(), cfg.ServiceUUID())
-		publisher = mqtt.NewMQTTClient(cfg.PublisherURL(), publisherClientID, cfg.PublisherCredentials(), log, nil)
+		publisher = mqtt.NewMQTTClient(cfg.PublisherURL(), publisherClientID, cfg.PublisherCredentials(), log, func(err error) {
+			metrics.Inc(core.MetricConnectionLost, "client", "publisher")
+		})
 	} else {
 		publisher = listener
 	}
 
 	log.SetClient(publisher, cfg.NamespacePublisher(), cfg.ServiceName(), cfg.ServiceUUID(), cfg.ServiceHost())
 
-	service := process.NewService(cfg.ServiceName(), cfg.ServiceUUID(), cfg.ServiceHost(), cfg.NamespaceListener(), cfg.NamespacePublisher(), cfg.ServiceCmdLine(), log)
+	var rateLimiter *core.RateLimiter
+	if len(cfg.RateLimits()) > 0 {
+		rateLimiter = core.NewRateLimiter(cfg.RateLimits(), log)
+		rateLimiter.StartSummaries(cfg.RateLimitSummaryInterval())
+	}
 
-	adapter := core.NewAdapter(listener, publisher, cfg.Subscriptions(), service, log)
-	done, err := adapter.Start()
-	if err != nil {
-		log.Log(core.LogLevelCritical, fmt.Sprintf("can't start adapter: %s", err))
-		os.Exit(1)
+	var dones []<-chan struct{}
+	if len(cfg.Services()) == 0 {
+		service := core.ServiceConfiguration{
+			Name:            cfg.ServiceName(),
+			UUID:            cfg.ServiceUUID(),
+			CmdLine:         cfg.ServiceCmdLine(),
+			Subscriptions:   cfg.Subscriptions(),
+			Schedules:       cfg.Schedules(),
+			LogLevelConsole: cfg.LogLevelConsole(),
+			LogLevelRemote:  cfg.LogLevelRemote(),
+		}
+		done, err := startAdapter(cfg, service, listener, publisher, rateLimiter, metrics, log)
+		if err != nil {
+			log.Log(core.LogLevelCritical, fmt.Sprintf("can't start adapter: %s", err))
+			os.Exit(1)
+		}
+		dones = append(dones, done)
+	} else {
+		router := core.NewRouter(listener, publisher)
+		for _, service := range cfg.Services() {
+			serviceLog := logger.NewMQTTLogger(os.Stdout, os.Stderr)
+			logLevelConsole, _ := core.ParseLogLevel(service.LogLevelConsole)
+			logLevelRemote, _ := core.ParseLogLevel(service.LogLevelRemote)
+			serviceLog.SetLevels(logLevelConsole, logLevelRemote)
+			serviceLog.SetConsoleFormat(consoleFormat)
+			for _, sink := range sinks {
+				serviceLog.AddSink(sink)
+			}
+			serviceLog.SetRemoteLimits(cfg.LogLimits())
+			serviceLog.SetClient(publisher, cfg.NamespacePublisher(), service.Name, service.UUID, cfg.ServiceHost())
+
+			client := router.Client(serviceLog, metrics.With("service", service.Name))
+			done, err := startAdapter(cfg, service, client, client, rateLimiter, metrics, serviceLog)
+			if err != nil {
+				log.Log(core.LogLevelCritical, fmt.Sprintf("can't start adapter for service '%s': %s", service.Name, err))
+				os.Exit(1)
+			}
+			dones = append(dones, done)
+		}
 	}
 
-	<-done
+	waitAny(dones)
+}
+
+func startAdapter(cfg core.Configuration, service core.ServiceConfiguration, listener, publisher core.MessageBusClient, rateLimiter *core.RateLimiter, metrics *core.Metrics, log core.Logger) (<-chan struct{}, error) {
+	processor := process.NewService(service.Name, service.UUID, cfg.ServiceHost(), cfg.NamespaceListener(), cfg.NamespacePublisher(), service.CmdLine, cfg.ServiceWatchdogTimeout(), log)
+
+	adapter := core.NewAdapter(listener, publisher, service.Subscriptions, processor, log)
+	if cfg.ServiceReadiness() != "" {
+		probe, err := process.NewReadinessProbe(cfg.ServiceReadiness())
+		if err != nil {
+			return nil, fmt.Errorf("can't create readiness probe: %s", err)
+		}
+		adapter.SetReadiness(probe, cfg.ServiceReadinessTimeout())
+	}
+	namespaceMode, _ := core.ParseNamespaceMode(cfg.PublishNamespace())
+	adapter.SetPublishPolicy(core.NewPublishPolicy(cfg.NamespacePublisher(), namespaceMode, cfg.Publications()))
+	if cfg.SchemaDir() != "" {
+		validator, err := schema.NewRegistry(cfg.SchemaDir(), log)
+		if err != nil {
+			return nil, fmt.Errorf("can't load schemas: %s", err)
+		}
+		validationMode, _ := core.ParseValidationMode(cfg.SchemaValidation())
+		adapter.SetValidator(validator, validationMode, cfg.SchemaValidateInput())
+	}
+	if rateLimiter != nil {
+		adapter.SetRateLimiter(rateLimiter)
+	}
+	if cfg.AckJournal() != "" {
+		path := cfg.AckJournal()
+		if len(cfg.Services()) > 0 {
+			path = fmt.Sprintf("%s-%s", path, service.Name)
+		}
+		journal, err := core.OpenAckJournal(path)
+		if err != nil {
+			return nil, err
+		}
+		adapter.SetAckJournal(journal)
+	}
+	if cfg.LogLevelControl() {
+		logLevelConsole, _ := core.ParseLogLevel(service.LogLevelConsole)
+		logLevelRemote, _ := core.ParseLogLevel(service.LogLevelRemote)
+		control := core.NewLogLevelControl(cfg.NamespaceListener(), service.Name, service.UUID, logLevelConsole, logLevelRemote, log)
+		adapter.SetLogLevelControl(control, cfg.LogLevelForward())
+	}
+	if cfg.DelayJournal() != "" {
+		path := cfg.DelayJournal()
+		if len(cfg.Services()) > 0 {
+			path = fmt.Sprintf("%s-%s", path, service.Name)
+		}
+		delays, err := core.OpenDelayQueue(path)
+		if err != nil {
+			return nil, err
+		}
+		adapter.SetDelayQueue(delays)
+	}
+	if len(service.Schedules) > 0 {
+		adapter.SetSchedules(service.Schedules, map[string]string{
+			"NAMESPACE_LISTENER":  cfg.NamespaceListener(),
+			"NAMESPACE_PUBLISHER": cfg.NamespacePublisher(),
+			"SERVICE_NAME":        service.Name,
+			"SERVICE_UUID":        service.UUID,
+			"SERVICE_HOST":        cfg.ServiceHost(),
+		})
+	}
+	if cfg.BatchSize() > 0 {
+		adapter.SetBatching(cfg.BatchSize(), cfg.BatchTimeout())
+	}
+	if cfg.DedupKey() != "" {
+		deduplicator := core.NewDeduplicator(cfg.DedupKey(), cfg.DedupWindow(), cfg.DedupWindowSize(), log)
+		deduplicator.StartSummaries(cfg.DedupSummaryInterval())
+		adapter.SetDeduplicator(deduplicator)
+	}
+	if metrics != nil {
+		serviceMetrics := metrics.With("service", service.Name)
+		adapter.SetMetrics(serviceMetrics)
+		if cfg.StatsInterval() > 0 {
+			adapter.SetStats(core.NewStats(publisher, cfg.NamespacePublisher(), service.Name, service.UUID, cfg.ServiceHost(), cfg.StatsInterval(), serviceMetrics, log))
+		}
+	}
+	if cfg.MessageEnvelope() {
+		adapter.SetEnvelope(service.Name, service.UUID, cfg.ServiceHost(), cfg.MessageCausationID())
+	}
+
+	return adapter.Start()
+}
+
+func waitAny(dones []<-chan struct{}) {
+	finished := make(chan struct{}, len(dones))
+	for _, done := range dones {
+		go func(done <-chan struct{}) {
+			<-done
+			finished <- struct{}{}
+		}(done)
+	}
+	<-finished
 }
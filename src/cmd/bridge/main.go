@@ -31,6 +31,29 @@ func main() {
 	logLevelConsole, _ := core.ParseLogLevel(cfg.LogLevelConsole())
 	logLevelRemote, _ := core.ParseLogLevel(cfg.LogLevelRemote())
 	log.SetLevels(logLevelConsole, logLevelRemote)
+	consoleFormat, _ := core.ParseConsoleFormat(cfg.LogFormat())
+	log.SetConsoleFormat(consoleFormat)
+	sinks, err := logger.NewSinks(cfg)
+	if err != nil {
+		log.Log(core.LogLevelCritical, fmt.Sprintf("can't create log sinks: %s", err))
+		os.Exit(1)
+	}
+	for _, sink := range sinks {
+		log.AddSink(sink)
+	}
+	log.SetRemoteLimits(cfg.LogLimits())
+
+	var metrics *core.Metrics
+	if cfg.MetricsAddress() != "" || cfg.StatsInterval() > 0 {
+		metrics = core.NewMetrics()
+	}
+	if cfg.MetricsAddress() != "" {
+		err = core.ServeMetrics(cfg.MetricsAddress(), cfg.MetricsPath(), metrics)
+		if err != nil {
+			log.Log(core.LogLevelCritical, err.Error())
+			os.Exit(1)
+		}
+	}
 
 	listenerClientID := fmt.Sprintf("%s_%s_%s_listener", cfg.ServiceName(), cfg.ServiceHost(), cfg.ServiceUUID())
 	listener := mqtt.NewMQTTClient(cfg.ListenerURL(), listenerClientID, cfg.ListenerCredentials(), log, func(err error) {
@@ -50,11 +73,36 @@ func main() {
 	log.SetClient(publisher, cfg.NamespacePublisher(), cfg.ServiceName(), cfg.ServiceUUID(), cfg.ServiceHost())
 
 	bridge := core.NewBridge(listener, publisher, cfg.NamespaceListener(), cfg.NamespacePublisher(), cfg.Subscriptions(), log)
+	if routes := cfg.BridgeRoutes(); len(routes) > 0 {
+		bridge.SetRoutes(routes)
+	}
+	bridge.SetBidirectional(cfg.BridgeBidirectional())
+	bridge.SetRaw(cfg.BridgeRaw())
+	if cfg.BridgeID() != "" {
+		bridge.SetLoopPrevention(cfg.BridgeID(), cfg.BridgeMaxHops())
+	}
+	if len(cfg.RateLimits()) > 0 {
+		rateLimiter := core.NewRateLimiter(cfg.RateLimits(), log)
+		rateLimiter.StartSummaries(cfg.RateLimitSummaryInterval())
+		bridge.SetRateLimiter(rateLimiter)
+	}
+	bridge.SetMetrics(metrics)
+	if cfg.StatsInterval() > 0 {
+		bridge.SetStats(core.NewStats(publisher, cfg.NamespacePublisher(), cfg.ServiceName(), cfg.ServiceUUID(), cfg.ServiceHost(), cfg.StatsInterval(), metrics, log))
+	}
 	done, err := bridge.Start()
 	if err != nil {
 		log.Log(core.LogLevelCritical, fmt.Sprintf("can't start bridge: %s", err))
 		os.Exit(1)
 	}
+	if cfg.LogLevelControl() {
+		control := core.NewLogLevelControl(cfg.NamespaceListener(), cfg.ServiceName(), cfg.ServiceUUID(), logLevelConsole, logLevelRemote, log)
+		err = control.Start(listener, nil)
+		if err != nil {
+			log.Log(core.LogLevelCritical, err.Error())
+			os.Exit(1)
+		}
+	}
 
 	<-done
 }
@@ -1,10 +1,23 @@
 package core
 
+import "time"
+
 type Configuration interface {
 	ServiceName() string
 	ServiceUUID() string
 	ServiceHost() string
 	ServiceCmdLine() string
+	ServiceReadiness() string
+	ServiceReadinessTimeout() time.Duration
+	ServiceWatchdogTimeout() time.Duration
+
+	Services() []ServiceConfiguration
+
+	BridgeRoutes() []BridgeRoute
+	BridgeBidirectional() bool
+	BridgeRaw() bool
+	BridgeID() string
+	BridgeMaxHops() int
 
 	NamespaceListener() string
 	NamespacePublisher() string
@@ -15,9 +28,61 @@ type Configuration interface {
 	PublisherCredentials() Credentials
 
 	Subscriptions() []string
+	Publications() []string
+	PublishNamespace() string
+
+	MessageEnvelope() bool
+	MessageCausationID() bool
+
+	SchemaDir() string
+	SchemaValidation() string
+	SchemaValidateInput() bool
+
+	AckJournal() string
+	DelayJournal() string
+	Schedules() []Schedule
+
+	BatchSize() int
+	BatchTimeout() time.Duration
+
+	DedupKey() string
+	DedupWindow() time.Duration
+	DedupWindowSize() int
+	DedupSummaryInterval() time.Duration
+
+	RateLimits() []RateLimit
+	RateLimitSummaryInterval() time.Duration
 
 	LogLevelConsole() string
 	LogLevelRemote() string
+	LogFormat() string
+	LogLimits() LogLimits
+	LogLevelControl() bool
+	LogLevelForward() bool
+	MetricsAddress() string
+	MetricsPath() string
+	StatsInterval() time.Duration
+	LogFile() string
+	LogFileLevel() string
+	LogFileFormat() string
+	LogFileMaxSize() int64
+	LogFileMaxAge() time.Duration
+	LogFileMaxCount() int
+	LogSyslog() string
+	LogSyslogLevel() string
+	LogSyslogFacility() string
+	LogJournald() bool
+	LogJournaldLevel() string
+}
+
+type ServiceConfiguration struct {
+	Name            string
+	UUID            string
+	CmdLine         string
+	Subscriptions   []string
+	Schedules       []Schedule
+	LogLevelConsole string
+	LogLevelRemote  string
 }
 
 type Credentials struct {
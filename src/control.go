@@ -0,0 +1,44 @@
+package core
+
+import (
+	"github.com/tidwall/gjson"
+	"strings"
+)
+
+const (
+	ControlTopicPrefix      = "$samm/"
+	ControlTopicSubscribe   = ControlTopicPrefix + "subscribe"
+	ControlTopicUnsubscribe = ControlTopicPrefix + "unsubscribe"
+	ControlTopicReady       = ControlTopicPrefix + "ready"
+	ControlTopicHeartbeat   = ControlTopicPrefix + "heartbeat"
+	ControlTopicAck         = ControlTopicPrefix + "ack"
+	ControlTopicTimer       = ControlTopicPrefix + "timer"
+	ControlTopicLogLevel    = ControlTopicPrefix + "log_level"
+)
+
+func IsControlTopic(topic string) bool {
+	return strings.HasPrefix(topic, ControlTopicPrefix)
+}
+
+func controlTopics(msg string) []string {
+	var topics []string
+	for _, topic := range gjson.Get(msg, "payload.topics").Array() {
+		if value := strings.TrimSpace(topic.String()); value != "" {
+			topics = append(topics, value)
+		}
+	}
+	return topics
+}
+
+func controlDeliveryIDs(msg string) []string {
+	var ids []string
+	if id := gjson.Get(msg, "payload.delivery_id").String(); id != "" {
+		ids = append(ids, id)
+	}
+	for _, id := range gjson.Get(msg, "payload.delivery_ids").Array() {
+		if value := id.String(); value != "" {
+			ids = append(ids, value)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,115 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/tidwall/gjson"
+	"sync"
+	"time"
+)
+
+// DedupKeyHash deduplicates messages by a hash of the whole message.
+const DedupKeyHash = "hash"
+
+// Deduplicator remembers the keys of the messages seen within a sliding
+// window limited by time and by number of keys.
+type Deduplicator struct {
+	key    string
+	window time.Duration
+	size   int
+	logger Logger
+
+	mu         sync.Mutex
+	seen       map[string]bool
+	queue      []seenKey
+	duplicates int
+	missing    int
+}
+
+type seenKey struct {
+	key string
+	at  time.Time
+}
+
+// NewDeduplicator creates a deduplicator using the value at the JSON path key
+// or, with DedupKeyHash, a hash of the message. A window or size of 0 is
+// unlimited.
+func NewDeduplicator(key string, window time.Duration, size int, logger Logger) *Deduplicator {
+	return &Deduplicator{
+		key:    key,
+		window: window,
+		size:   size,
+		logger: logger,
+		seen:   make(map[string]bool),
+	}
+}
+
+// IsDuplicate reports whether a message with the same key was seen within the
+// window. Messages without the key are never duplicates.
+func (d *Deduplicator) IsDuplicate(msg string) bool {
+	var key string
+	if d.key == DedupKeyHash {
+		sum := sha256.Sum256([]byte(msg))
+		key = hex.EncodeToString(sum[:])
+	} else {
+		value := gjson.Get(msg, d.key)
+		if !value.Exists() {
+			d.mu.Lock()
+			d.missing++
+			d.mu.Unlock()
+			return false
+		}
+		key = value.Raw
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	if d.window > 0 {
+		expired := 0
+		for expired < len(d.queue) && now.Sub(d.queue[expired].at) >= d.window {
+			delete(d.seen, d.queue[expired].key)
+			expired++
+		}
+		d.queue = d.queue[expired:]
+	}
+
+	if d.seen[key] {
+		d.duplicates++
+		return true
+	}
+
+	d.seen[key] = true
+	d.queue = append(d.queue, seenKey{key: key, at: now})
+	if d.size > 0 && len(d.queue) > d.size {
+		delete(d.seen, d.queue[0].key)
+		d.queue = d.queue[1:]
+	}
+	return false
+}
+
+// LogSummary logs and resets the number of duplicates.
+func (d *Deduplicator) LogSummary() {
+	d.mu.Lock()
+	duplicates, missing := d.duplicates, d.missing
+	d.duplicates, d.missing = 0, 0
+	d.mu.Unlock()
+
+	if duplicates > 0 {
+		d.logger.Log(LogLevelInfo, fmt.Sprintf("duplicate messages dropped: %d", duplicates))
+	}
+	if missing > 0 {
+		d.logger.Log(LogLevelWarning, fmt.Sprintf("messages without deduplication key '%s': %d", d.key, missing))
+	}
+}
+
+// StartSummaries logs the number of duplicates every interval.
+func (d *Deduplicator) StartSummaries(interval time.Duration) {
+	go func() {
+		for range time.Tick(interval) {
+			d.LogSummary()
+		}
+	}()
+}
@@ -0,0 +1,73 @@
+package core_test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/flaneurtv/samm/core"
+	"testing"
+	"time"
+)
+
+func TestDeduplicatorKey(t *testing.T) {
+	log := &mockLogger{}
+	dedup := core.NewDeduplicator("payload.tick_uuid", time.Minute, 0, log)
+
+	assert.False(t, dedup.IsDuplicate(`{"topic": "tick", "payload": {"tick_uuid": "1"}}`))
+	assert.False(t, dedup.IsDuplicate(`{"topic": "tick", "payload": {"tick_uuid": "2"}}`))
+	assert.True(t, dedup.IsDuplicate(`{"topic": "tock", "payload": {"tick_uuid": "1"}}`))
+	assert.False(t, dedup.IsDuplicate(`{"topic": "tick", "payload": {}}`))
+	assert.False(t, dedup.IsDuplicate(`{"topic": "tick", "payload": {}}`))
+
+	dedup.LogSummary()
+	assert.Equal(t, 2, len(log.getMessages()))
+	assert.Equal(t, "duplicate messages dropped: 1", log.getMessages()[0].message)
+	assert.Equal(t, "messages without deduplication key 'payload.tick_uuid': 2", log.getMessages()[1].message)
+
+	log.clear()
+	dedup.LogSummary()
+	assert.Equal(t, 0, len(log.getMessages()))
+}
+
+func TestDeduplicatorHash(t *testing.T) {
+	dedup := core.NewDeduplicator(core.DedupKeyHash, 0, 2, &mockLogger{})
+
+	assert.False(t, dedup.IsDuplicate(`{"topic": "a"}`))
+	assert.True(t, dedup.IsDuplicate(`{"topic": "a"}`))
+	assert.False(t, dedup.IsDuplicate(`{"topic": "b"}`))
+	assert.False(t, dedup.IsDuplicate(`{"topic": "c"}`))
+	assert.False(t, dedup.IsDuplicate(`{"topic": "a"}`))
+	assert.True(t, dedup.IsDuplicate(`{"topic": "c"}`))
+}
+
+func TestDeduplicatorWindow(t *testing.T) {
+	dedup := core.NewDeduplicator(core.DedupKeyHash, 50*time.Millisecond, 0, &mockLogger{})
+
+	assert.False(t, dedup.IsDuplicate(`{"topic": "a"}`))
+	assert.True(t, dedup.IsDuplicate(`{"topic": "a"}`))
+	time.Sleep(60 * time.Millisecond)
+	assert.False(t, dedup.IsDuplicate(`{"topic": "a"}`))
+}
+
+func TestAdapterDedup(t *testing.T) {
+	bus := NewMockBus()
+	client := NewMockClient(bus)
+
+	service := NewMockService(func(msg string) string {
+		return `{"topic": "root/tock"}`
+	})
+
+	adapter := core.NewAdapter(client, client, []string{"root/tick"}, service, &mockLogger{})
+	adapter.SetDeduplicator(core.NewDeduplicator("payload.tick_uuid", time.Minute, 0, &mockLogger{}))
+	done, err := adapter.Start()
+	assert.Nil(t, err)
+
+	client.Publish("root/tick", `{"topic": "root/tick", "payload": {"tick_uuid": "1"}}`)
+	client.Publish("root/tick", `{"topic": "root/tick", "payload": {"tick_uuid": "1"}}`)
+	client.Publish("root/tick", `{"topic": "root/tick", "payload": {"tick_uuid": "2"}}`)
+	client.Publish("root/tick", `{"topic": "root/tick", "payload": "stop"}`)
+	<-done
+
+	assert.Equal(t, []string{
+		`{"topic": "root/tick", "payload": {"tick_uuid": "1"}}`,
+		`{"topic": "root/tick", "payload": {"tick_uuid": "2"}}`,
+	}, service.getInputMessages())
+}
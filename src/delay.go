@@ -0,0 +1,239 @@
+package core
+
+import (
+	"container/heap"
+	"encoding/json"
+	"fmt"
+	"github.com/satori/go.uuid"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+	"sync"
+	"time"
+)
+
+const (
+	publishAtField = "publish_at"
+	delayField     = "delay_ms"
+)
+
+// publishTime returns the time the message should be published at and the
+// message without the publish_at or delay_ms directive. The time is zero if
+// the message carries no directive.
+func publishTime(msg string, now time.Time) (time.Time, string, error) {
+	publishAt := gjson.Get(msg, publishAtField)
+	delay := gjson.Get(msg, delayField)
+
+	switch {
+	case publishAt.Exists() && delay.Exists():
+		return time.Time{}, msg, fmt.Errorf("%s and %s can't be used together", publishAtField, delayField)
+	case publishAt.Exists():
+		at, err := time.Parse(time.RFC3339Nano, publishAt.String())
+		if err != nil {
+			return time.Time{}, msg, fmt.Errorf("invalid %s: %s", publishAtField, publishAt.Raw)
+		}
+		msg, _ = sjson.Delete(msg, publishAtField)
+		return at, msg, nil
+	case delay.Exists():
+		if delay.Type != gjson.Number || delay.Int() < 0 {
+			return time.Time{}, msg, fmt.Errorf("invalid %s: %s", delayField, delay.Raw)
+		}
+		msg, _ = sjson.Delete(msg, delayField)
+		return now.Add(time.Duration(delay.Int()) * time.Millisecond), msg, nil
+	}
+	return time.Time{}, msg, nil
+}
+
+// DelayQueue holds messages until their publish time. With a journal path,
+// pending messages survive restarts.
+type DelayQueue struct {
+	mu      sync.Mutex
+	journal *journal
+	items   delayHeap
+	wakeup  chan struct{}
+}
+
+type delayedMessage struct {
+	ID      string    `json:"id"`
+	At      time.Time `json:"at"`
+	Message string    `json:"message,omitempty"`
+	Done    bool      `json:"done,omitempty"`
+}
+
+type delayHeap []delayedMessage
+
+func (h delayHeap) Len() int            { return len(h) }
+func (h delayHeap) Less(i, j int) bool  { return h[i].At.Before(h[j].At) }
+func (h delayHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *delayHeap) Push(x interface{}) { *h = append(*h, x.(delayedMessage)) }
+func (h *delayHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// NewDelayQueue creates a queue kept in memory only.
+func NewDelayQueue() *DelayQueue {
+	return &DelayQueue{wakeup: make(chan struct{}, 1)}
+}
+
+// OpenDelayQueue reads the pending messages of an existing journal and
+// compacts it.
+func OpenDelayQueue(path string) (*DelayQueue, error) {
+	q := NewDelayQueue()
+
+	pending := make(map[string]delayedMessage)
+	var order []string
+
+	var err error
+	q.journal, err = openJournal(path, "delay journal", func(line []byte) error {
+		var entry delayedMessage
+		err := json.Unmarshal(line, &entry)
+		if err != nil {
+			return err
+		}
+		if entry.Done {
+			delete(pending, entry.ID)
+		} else {
+			pending[entry.ID] = entry
+			order = append(order, entry.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range order {
+		if entry, ok := pending[id]; ok {
+			heap.Push(&q.items, entry)
+			delete(pending, id)
+		}
+	}
+
+	err = q.journal.compact(q.entries())
+	if err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// entries returns the journal entries of the pending messages. The caller
+// holds the lock.
+func (q *DelayQueue) entries() []interface{} {
+	entries := make([]interface{}, 0, len(q.items))
+	for _, entry := range q.items {
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// Add keeps the message until at.
+func (q *DelayQueue) Add(at time.Time, msg string) error {
+	entry := delayedMessage{ID: uuid.NewV4().String(), At: at, Message: msg}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	err := q.write(entry)
+	if err != nil {
+		return err
+	}
+	heap.Push(&q.items, entry)
+
+	select {
+	case q.wakeup <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Len returns the number of pending messages.
+func (q *DelayQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.items)
+}
+
+// Run passes every message to handler once its time has come, until done is
+// closed. Messages are removed from the journal after they were handled.
+// Journal errors are passed to errorHandler, the queue keeps running.
+func (q *DelayQueue) Run(done <-chan struct{}, handler func(msg string), errorHandler func(err error)) {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		q.mu.Lock()
+		var due []delayedMessage
+		now := time.Now()
+		for len(q.items) > 0 && !q.items[0].At.After(now) {
+			due = append(due, heap.Pop(&q.items).(delayedMessage))
+		}
+		wait := time.Hour
+		if len(q.items) > 0 {
+			wait = q.items[0].At.Sub(now)
+		}
+		q.mu.Unlock()
+
+		for _, entry := range due {
+			handler(entry.Message)
+
+			err := q.remove(entry.ID)
+			if err != nil {
+				errorHandler(err)
+			}
+		}
+		if len(due) > 0 {
+			continue
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+
+		select {
+		case <-done:
+			return
+		case <-q.wakeup:
+		case <-timer.C:
+		}
+	}
+}
+
+func (q *DelayQueue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.journal == nil {
+		return nil
+	}
+	return q.journal.close()
+}
+
+func (q *DelayQueue) write(entry delayedMessage) error {
+	if q.journal == nil {
+		return nil
+	}
+	return q.journal.write(entry)
+}
+
+// remove marks a handled message done in the journal and compacts the journal
+// once it holds mostly handled messages.
+func (q *DelayQueue) remove(id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	err := q.write(delayedMessage{ID: id, Done: true})
+	if err != nil {
+		return err
+	}
+	if q.journal != nil && q.journal.needsCompaction(len(q.items)) {
+		return q.journal.compact(q.entries())
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package core_test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/flaneurtv/samm/core"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAdapterDelayedPublish(t *testing.T) {
+	bus := NewMockBus()
+	client := NewMockClient(bus)
+
+	outputs := make(chan string)
+	errors := make(chan string)
+	service := NewMockServiceProducer(outputs, errors)
+
+	log := &mockLogger{}
+	adapter := core.NewAdapter(client, client, nil, service, log)
+	_, err := adapter.Start()
+	assert.Nil(t, err)
+
+	subscription, _ := client.Subscribe([]string{"root/+"})
+	output := make(chan string, 4)
+	go func() {
+		for msg := range subscription {
+			output <- msg
+		}
+	}()
+
+	start := time.Now()
+	publishAt := start.Add(100 * time.Millisecond).UTC().Format(time.RFC3339Nano)
+	outputs <- `{"topic": "root/a", "delay_ms": 200, "payload": "a"}`
+	outputs <- `{"topic": "root/b", "publish_at": "` + publishAt + `", "payload": "b"}`
+	outputs <- `{"topic": "root/c", "delay_ms": 0, "payload": "c"}`
+	outputs <- `{"topic": "root/d", "publish_at": "2000-01-01T00:00:00Z", "payload": "d"}`
+
+	assert.Equal(t, `{"topic": "root/c", "payload": "c"}`, <-output)
+	assert.Equal(t, `{"topic": "root/d", "payload": "d"}`, <-output)
+	assert.True(t, time.Since(start) < 100*time.Millisecond)
+
+	assert.Equal(t, `{"topic": "root/b", "payload": "b"}`, <-output)
+	assert.True(t, time.Since(start) >= 100*time.Millisecond)
+
+	assert.Equal(t, `{"topic": "root/a", "payload": "a"}`, <-output)
+	assert.True(t, time.Since(start) >= 200*time.Millisecond)
+}
+
+func TestAdapterDelayInvalid(t *testing.T) {
+	bus := NewMockBus()
+	client := NewMockClient(bus)
+
+	outputs := make(chan string)
+	errors := make(chan string)
+	service := NewMockServiceProducer(outputs, errors)
+
+	log := &mockLogger{}
+	adapter := core.NewAdapter(client, client, nil, service, log)
+	_, err := adapter.Start()
+	assert.Nil(t, err)
+
+	outputs <- `{"topic": "root/a", "delay_ms": "soon"}`
+	outputs <- `{"topic": "root/b", "publish_at": "tomorrow"}`
+	outputs <- `{"topic": "root/c", "delay_ms": 10, "publish_at": "2000-01-01T00:00:00Z"}`
+	time.Sleep(50 * time.Millisecond)
+
+	var errs []string
+	for _, msg := range log.getMessages() {
+		if msg.level == core.LogLevelError {
+			errs = append(errs, msg.message)
+		}
+	}
+	assert.Equal(t, []string{
+		`invalid delay_ms: "soon": {"topic": "root/a", "delay_ms": "soon"}`,
+		`invalid publish_at: "tomorrow": {"topic": "root/b", "publish_at": "tomorrow"}`,
+		`publish_at and delay_ms can't be used together: {"topic": "root/c", "delay_ms": 10, "publish_at": "2000-01-01T00:00:00Z"}`,
+	}, errs)
+}
+
+func TestDelayQueueJournal(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "delays")
+
+	delays, err := core.OpenDelayQueue(path)
+	assert.Nil(t, err)
+
+	now := time.Now()
+	assert.Nil(t, delays.Add(now.Add(time.Hour), "later"))
+	assert.Nil(t, delays.Add(now.Add(50*time.Millisecond), "soon"))
+	assert.Nil(t, delays.Add(now.Add(-time.Second), "overdue"))
+
+	var mu sync.Mutex
+	var handled []string
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		delays.Run(done, func(msg string) {
+			mu.Lock()
+			handled = append(handled, msg)
+			mu.Unlock()
+		}, func(err error) {
+			t.Error(err)
+		})
+		close(stopped)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	close(done)
+	<-stopped
+	delays.Close()
+
+	assert.Equal(t, []string{"overdue", "soon"}, handled)
+	assert.Equal(t, 1, delays.Len())
+
+	// a truncated entry written during a crash is ignored
+	file, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	file.WriteString(`{"id": "trunc`)
+	file.Close()
+
+	delays, err = core.OpenDelayQueue(path)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, delays.Len())
+	delays.Close()
+}
+
+func TestDelayQueueJournalWriteError(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(dir)
+
+	delays, err := core.OpenDelayQueue(filepath.Join(dir, "delays"))
+	assert.Nil(t, err)
+
+	now := time.Now()
+	assert.Nil(t, delays.Add(now, "first"))
+	assert.Nil(t, delays.Add(now.Add(50*time.Millisecond), "second"))
+	delays.Close()
+
+	var mu sync.Mutex
+	var handled []string
+	var errs int
+	done := make(chan struct{})
+	go delays.Run(done, func(msg string) {
+		mu.Lock()
+		handled = append(handled, msg)
+		mu.Unlock()
+	}, func(err error) {
+		mu.Lock()
+		errs++
+		mu.Unlock()
+	})
+
+	// messages are still published when the journal can't be written
+	time.Sleep(100 * time.Millisecond)
+	close(done)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"first", "second"}, handled)
+	assert.Equal(t, 2, errs)
+}
+
+func TestDelayQueueJournalError(t *testing.T) {
+	_, err := core.OpenDelayQueue("/dummy/delays")
+	assert.NotNil(t, err)
+}
@@ -8,7 +8,9 @@ import (
 	"gitlab.com/flaneurtv/samm/core"
 	"io/ioutil"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 const (
@@ -20,6 +22,14 @@ const (
 	defaultPublisherURL             = "tcp://mqtt:1883"
 	defaultServiceCmdLine           = "/srv/processor"
 	defaultSubscriptionsFile        = "/srv/subscriptions.txt"
+	defaultReadinessTimeout         = 60 * time.Second
+	defaultBridgeMaxHops            = 8
+	defaultRateLimitSummaryInterval = time.Minute
+	defaultDedupWindow              = time.Minute
+	defaultBatchTimeout             = 100 * time.Millisecond
+	defaultDedupWindowSize          = 10000
+	defaultDedupSummaryInterval     = time.Minute
+	defaultMetricsPath              = "/metrics"
 )
 
 type config struct {
@@ -28,6 +38,18 @@ type config struct {
 	serviceHost    string
 	serviceCmdLine string
 
+	serviceReadiness        string
+	serviceReadinessTimeout time.Duration
+	serviceWatchdogTimeout  time.Duration
+
+	services []core.ServiceConfiguration
+
+	bridgeRoutes        []core.BridgeRoute
+	bridgeBidirectional bool
+	bridgeRaw           bool
+	bridgeID            string
+	bridgeMaxHops       int
+
 	namespaceListener  string
 	namespacePublisher string
 
@@ -36,10 +58,45 @@ type config struct {
 	publisherURL         string
 	publisherCredentials core.Credentials
 
-	subscriptions []string
+	subscriptions    []string
+	publications     []string
+	publishNamespace string
+
+	messageEnvelope    bool
+	messageCausationID bool
+
+	schemaDir           string
+	schemaValidation    string
+	schemaValidateInput bool
+
+	ackJournal   string
+	delayJournal string
+
+	schedules []core.Schedule
+
+	batchSize    int
+	batchTimeout time.Duration
+
+	dedupKey             string
+	dedupWindow          time.Duration
+	dedupWindowSize      int
+	dedupSummaryInterval time.Duration
+
+	rateLimits               []core.RateLimit
+	rateLimitSummaryInterval time.Duration
 
 	logLevelConsole string
 	logLevelRemote  string
+	logFormat       string
+	logSinks        logSinks
+
+	logLimits       core.LogLimits
+	logLevelControl bool
+	logLevelForward bool
+
+	metricsAddress string
+	metricsPath    string
+	statsInterval  time.Duration
 }
 
 func NewAdapterConfig(logger core.Logger) (core.Configuration, error) {
@@ -55,10 +112,25 @@ func newConfig(logger core.Logger, withServiceProcessor bool) (core.Configuratio
 	serviceUUID := uuid.NewV4().String()
 	serviceHost, _ := os.Hostname()
 
-	var serviceCmdLine string
+	var serviceCmdLine, serviceReadiness string
+	var serviceReadinessTimeout, serviceWatchdogTimeout time.Duration
+	servicesPath := strings.TrimSpace(os.Getenv("SERVICES"))
 	if withServiceProcessor {
 		var err error
-		serviceCmdLine, err = getServiceCmdLine(logger)
+		if servicesPath == "" {
+			serviceCmdLine, err = getServiceCmdLine(logger)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		serviceReadiness = strings.TrimSpace(os.Getenv("SERVICE_READINESS"))
+		serviceReadinessTimeout, err = getDuration("SERVICE_READINESS_TIMEOUT", defaultReadinessTimeout)
+		if err != nil {
+			return nil, err
+		}
+
+		serviceWatchdogTimeout, err = getDuration("SERVICE_WATCHDOG_TIMEOUT", 0)
 		if err != nil {
 			return nil, err
 		}
@@ -106,6 +178,186 @@ func newConfig(logger core.Logger, withServiceProcessor bool) (core.Configuratio
 		return nil, err
 	}
 
+	var publications []string
+	var publishNamespace string
+	if withServiceProcessor {
+		publications, err = readPublications(namespacePublisher, logger)
+		if err != nil {
+			return nil, err
+		}
+
+		publishNamespace = strings.ToLower(strings.TrimSpace(os.Getenv("PUBLISH_NAMESPACE")))
+		if _, ok := core.ParseNamespaceMode(publishNamespace); !ok {
+			return nil, fmt.Errorf("PUBLISH_NAMESPACE should be one of: %s, %s", core.NamespaceModePrefix, core.NamespaceModeEnforce)
+		}
+		if publishNamespace != "" && namespacePublisher == nullNamespace {
+			return nil, fmt.Errorf("PUBLISH_NAMESPACE can't be used with namespace '%s'", nullNamespace)
+		}
+	}
+
+	var messageEnvelope, messageCausationID bool
+	if withServiceProcessor {
+		messageEnvelope, err = getBool("MESSAGE_ENVELOPE", false)
+		if err != nil {
+			return nil, err
+		}
+
+		messageCausationID, err = getBool("MESSAGE_CAUSATION_ID", false)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var schemaDir, schemaValidation string
+	var schemaValidateInput bool
+	if withServiceProcessor {
+		schemaDir = strings.TrimSpace(os.Getenv("SCHEMA_DIR"))
+
+		schemaValidation = strings.ToLower(strings.TrimSpace(os.Getenv("SCHEMA_VALIDATION")))
+		if schemaValidation == "" {
+			schemaValidation = string(core.ValidationModeReject)
+		} else if _, ok := core.ParseValidationMode(schemaValidation); !ok {
+			return nil, fmt.Errorf("SCHEMA_VALIDATION should be one of: %s, %s", core.ValidationModeReject, core.ValidationModeTag)
+		}
+
+		schemaValidateInput, err = getBool("SCHEMA_VALIDATE_INPUT", false)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var bridgeRoutes []core.BridgeRoute
+	var bridgeBidirectional, bridgeRaw bool
+	var bridgeID string
+	var bridgeMaxHops int
+	if !withServiceProcessor {
+		routesPath := strings.TrimSpace(os.Getenv("BRIDGE_ROUTES"))
+		if routesPath != "" {
+			bridgeRoutes, err = readRoutes(routesPath, logger)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		bridgeBidirectional, err = getBool("BRIDGE_BIDIRECTIONAL", false)
+		if err != nil {
+			return nil, err
+		}
+
+		bridgeRaw, err = getBool("BRIDGE_RAW", false)
+		if err != nil {
+			return nil, err
+		}
+
+		if bridgeRaw && bridgeBidirectional {
+			return nil, errors.New("BRIDGE_BIDIRECTIONAL can't be used with BRIDGE_RAW, as raw messages can't be marked to prevent loops")
+		}
+
+		reverse := false
+		for _, route := range bridgeRoutes {
+			if route.Direction == core.BridgeDirectionReverse {
+				reverse = true
+			}
+		}
+		if bridgeRaw && reverse {
+			return nil, errors.New("reverse routes can't be used with BRIDGE_RAW, as raw messages can't be marked to prevent loops")
+		}
+
+		bridgeID = strings.TrimSpace(os.Getenv("BRIDGE_ID"))
+		if bridgeRaw && bridgeID != "" {
+			return nil, errors.New("BRIDGE_ID can't be used with BRIDGE_RAW")
+		}
+		if bridgeID == "" && (bridgeBidirectional || reverse) {
+			bridgeID = serviceUUID
+		}
+
+		bridgeMaxHops, err = getInt("BRIDGE_MAX_HOPS", defaultBridgeMaxHops)
+		if err != nil {
+			return nil, err
+		}
+		if bridgeMaxHops < 0 {
+			return nil, errors.New("BRIDGE_MAX_HOPS can't be negative")
+		}
+	}
+
+	var ackJournal, delayJournal string
+	if withServiceProcessor {
+		ackJournal = strings.TrimSpace(os.Getenv("ACK_JOURNAL"))
+		delayJournal = strings.TrimSpace(os.Getenv("DELAY_JOURNAL"))
+	}
+
+	var schedules []core.Schedule
+	if withServiceProcessor {
+		schedulePath := strings.TrimSpace(os.Getenv("SCHEDULE"))
+		if schedulePath != "" && servicesPath != "" {
+			return nil, errors.New("SCHEDULE can't be used with SERVICES, set a schedule per service instead")
+		}
+		if schedulePath != "" {
+			schedules, err = readSchedules(schedulePath, logger)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var batchSize int
+	var batchTimeout time.Duration
+	if withServiceProcessor {
+		batchSize, err = getInt("BATCH_SIZE", 0)
+		if err != nil {
+			return nil, err
+		}
+		if batchSize < 0 {
+			return nil, errors.New("BATCH_SIZE can't be negative")
+		}
+
+		batchTimeout, err = getDuration("BATCH_TIMEOUT", defaultBatchTimeout)
+		if err != nil {
+			return nil, err
+		}
+		if batchSize > 0 && batchTimeout <= 0 {
+			return nil, errors.New("BATCH_TIMEOUT should be positive")
+		}
+	}
+
+	var dedupKey string
+	var dedupWindow, dedupSummaryInterval time.Duration
+	var dedupWindowSize int
+	if withServiceProcessor {
+		dedupKey = strings.TrimSpace(os.Getenv("DEDUP_KEY"))
+
+		dedupWindow, err = getDuration("DEDUP_WINDOW", defaultDedupWindow)
+		if err != nil {
+			return nil, err
+		}
+
+		dedupWindowSize, err = getInt("DEDUP_WINDOW_SIZE", defaultDedupWindowSize)
+		if err != nil {
+			return nil, err
+		}
+		if dedupWindowSize < 0 {
+			return nil, errors.New("DEDUP_WINDOW_SIZE can't be negative")
+		}
+		if dedupKey != "" && dedupWindow == 0 && dedupWindowSize == 0 {
+			return nil, errors.New("DEDUP_WINDOW and DEDUP_WINDOW_SIZE can't both be unlimited")
+		}
+
+		dedupSummaryInterval, err = getDuration("DEDUP_SUMMARY_INTERVAL", defaultDedupSummaryInterval)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	rateLimits, err := readRateLimits(logger)
+	if err != nil {
+		return nil, err
+	}
+
+	rateLimitSummaryInterval, err := getDuration("RATE_LIMIT_SUMMARY_INTERVAL", defaultRateLimitSummaryInterval)
+	if err != nil {
+		return nil, err
+	}
+
 	logLevel := strings.ToLower(os.Getenv("LOG_LEVEL"))
 	if logLevel == "" {
 		logLevel = "error"
@@ -121,20 +373,110 @@ func newConfig(logger core.Logger, withServiceProcessor bool) (core.Configuratio
 		logLevelRemote = logLevel
 	}
 
+	logFormat := strings.ToLower(strings.TrimSpace(os.Getenv("LOG_FORMAT")))
+	if logFormat == "" {
+		logFormat = string(core.ConsoleFormatText)
+	} else if _, ok := core.ParseConsoleFormat(logFormat); !ok {
+		return nil, fmt.Errorf("LOG_FORMAT should be one of: %s, %s, %s", core.ConsoleFormatText, core.ConsoleFormatLogfmt, core.ConsoleFormatJSON)
+	}
+
+	logSinks, err := readLogSinks(logLevel, logFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	logLimits, err := readLogLimits()
+	if err != nil {
+		return nil, err
+	}
+
+	logLevelControl, err := getBool("LOG_LEVEL_CONTROL", false)
+	if err != nil {
+		return nil, err
+	}
+
+	var logLevelForward bool
+	if withServiceProcessor {
+		logLevelForward, err = getBool("LOG_LEVEL_FORWARD", false)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	metricsAddress := strings.TrimSpace(os.Getenv("METRICS_ADDRESS"))
+	metricsPath := strings.TrimSpace(os.Getenv("METRICS_PATH"))
+	if metricsPath == "" {
+		metricsPath = defaultMetricsPath
+	}
+	if !strings.HasPrefix(metricsPath, "/") {
+		return nil, errors.New("METRICS_PATH should start with '/'")
+	}
+
+	statsInterval, err := getDuration("STATS_INTERVAL", 0)
+	if err != nil {
+		return nil, err
+	}
+	if statsInterval < 0 {
+		return nil, errors.New("STATS_INTERVAL can't be negative")
+	}
+
+	var services []core.ServiceConfiguration
+	if withServiceProcessor && servicesPath != "" {
+		services, err = readServices(servicesPath, namespaceListener, logLevelConsole, logLevelRemote, logger)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &config{
-		serviceName:          serviceName,
-		serviceUUID:          serviceUUID,
-		serviceHost:          serviceHost,
-		serviceCmdLine:       serviceCmdLine,
-		namespaceListener:    namespaceListener,
-		namespacePublisher:   namespacePublisher,
-		listenerURL:          listenerURL,
-		listenerCredentials:  listenerCredentials,
-		publisherURL:         publisherURL,
-		publisherCredentials: publisherCredentials,
-		subscriptions:        subscriptions,
-		logLevelConsole:      logLevelConsole,
-		logLevelRemote:       logLevelRemote,
+		serviceName:              serviceName,
+		serviceUUID:              serviceUUID,
+		serviceHost:              serviceHost,
+		serviceCmdLine:           serviceCmdLine,
+		serviceReadiness:         serviceReadiness,
+		serviceReadinessTimeout:  serviceReadinessTimeout,
+		serviceWatchdogTimeout:   serviceWatchdogTimeout,
+		services:                 services,
+		bridgeRoutes:             bridgeRoutes,
+		bridgeBidirectional:      bridgeBidirectional,
+		bridgeRaw:                bridgeRaw,
+		bridgeID:                 bridgeID,
+		bridgeMaxHops:            bridgeMaxHops,
+		namespaceListener:        namespaceListener,
+		namespacePublisher:       namespacePublisher,
+		listenerURL:              listenerURL,
+		listenerCredentials:      listenerCredentials,
+		publisherURL:             publisherURL,
+		publisherCredentials:     publisherCredentials,
+		subscriptions:            subscriptions,
+		publications:             publications,
+		publishNamespace:         publishNamespace,
+		messageEnvelope:          messageEnvelope,
+		messageCausationID:       messageCausationID,
+		schemaDir:                schemaDir,
+		schemaValidation:         schemaValidation,
+		schemaValidateInput:      schemaValidateInput,
+		ackJournal:               ackJournal,
+		delayJournal:             delayJournal,
+		schedules:                schedules,
+		batchSize:                batchSize,
+		batchTimeout:             batchTimeout,
+		dedupKey:                 dedupKey,
+		dedupWindow:              dedupWindow,
+		dedupWindowSize:          dedupWindowSize,
+		dedupSummaryInterval:     dedupSummaryInterval,
+		rateLimits:               rateLimits,
+		rateLimitSummaryInterval: rateLimitSummaryInterval,
+		logLevelConsole:          logLevelConsole,
+		logLevelRemote:           logLevelRemote,
+		logFormat:                logFormat,
+		logSinks:                 logSinks,
+		logLimits:                logLimits,
+		logLevelControl:          logLevelControl,
+		logLevelForward:          logLevelForward,
+		metricsAddress:           metricsAddress,
+		metricsPath:              metricsPath,
+		statsInterval:            statsInterval,
 	}, nil
 }
 
@@ -154,6 +496,42 @@ func (cfg *config) ServiceCmdLine() string {
 	return cfg.serviceCmdLine
 }
 
+func (cfg *config) ServiceReadiness() string {
+	return cfg.serviceReadiness
+}
+
+func (cfg *config) ServiceReadinessTimeout() time.Duration {
+	return cfg.serviceReadinessTimeout
+}
+
+func (cfg *config) ServiceWatchdogTimeout() time.Duration {
+	return cfg.serviceWatchdogTimeout
+}
+
+func (cfg *config) Services() []core.ServiceConfiguration {
+	return cfg.services
+}
+
+func (cfg *config) BridgeRoutes() []core.BridgeRoute {
+	return cfg.bridgeRoutes
+}
+
+func (cfg *config) BridgeBidirectional() bool {
+	return cfg.bridgeBidirectional
+}
+
+func (cfg *config) BridgeRaw() bool {
+	return cfg.bridgeRaw
+}
+
+func (cfg *config) BridgeID() string {
+	return cfg.bridgeID
+}
+
+func (cfg *config) BridgeMaxHops() int {
+	return cfg.bridgeMaxHops
+}
+
 func (cfg *config) NamespaceListener() string {
 	return cfg.namespaceListener
 }
@@ -182,6 +560,78 @@ func (cfg *config) Subscriptions() []string {
 	return cfg.subscriptions
 }
 
+func (cfg *config) Publications() []string {
+	return cfg.publications
+}
+
+func (cfg *config) PublishNamespace() string {
+	return cfg.publishNamespace
+}
+
+func (cfg *config) MessageEnvelope() bool {
+	return cfg.messageEnvelope
+}
+
+func (cfg *config) MessageCausationID() bool {
+	return cfg.messageCausationID
+}
+
+func (cfg *config) SchemaDir() string {
+	return cfg.schemaDir
+}
+
+func (cfg *config) SchemaValidation() string {
+	return cfg.schemaValidation
+}
+
+func (cfg *config) SchemaValidateInput() bool {
+	return cfg.schemaValidateInput
+}
+
+func (cfg *config) AckJournal() string {
+	return cfg.ackJournal
+}
+
+func (cfg *config) DelayJournal() string {
+	return cfg.delayJournal
+}
+
+func (cfg *config) Schedules() []core.Schedule {
+	return cfg.schedules
+}
+
+func (cfg *config) BatchSize() int {
+	return cfg.batchSize
+}
+
+func (cfg *config) BatchTimeout() time.Duration {
+	return cfg.batchTimeout
+}
+
+func (cfg *config) DedupKey() string {
+	return cfg.dedupKey
+}
+
+func (cfg *config) DedupWindow() time.Duration {
+	return cfg.dedupWindow
+}
+
+func (cfg *config) DedupWindowSize() int {
+	return cfg.dedupWindowSize
+}
+
+func (cfg *config) DedupSummaryInterval() time.Duration {
+	return cfg.dedupSummaryInterval
+}
+
+func (cfg *config) RateLimits() []core.RateLimit {
+	return cfg.rateLimits
+}
+
+func (cfg *config) RateLimitSummaryInterval() time.Duration {
+	return cfg.rateLimitSummaryInterval
+}
+
 func (cfg *config) LogLevelConsole() string {
 	return cfg.logLevelConsole
 }
@@ -190,6 +640,34 @@ func (cfg *config) LogLevelRemote() string {
 	return cfg.logLevelRemote
 }
 
+func (cfg *config) LogLimits() core.LogLimits {
+	return cfg.logLimits
+}
+
+func (cfg *config) LogLevelControl() bool {
+	return cfg.logLevelControl
+}
+
+func (cfg *config) LogLevelForward() bool {
+	return cfg.logLevelForward
+}
+
+func (cfg *config) MetricsAddress() string {
+	return cfg.metricsAddress
+}
+
+func (cfg *config) MetricsPath() string {
+	return cfg.metricsPath
+}
+
+func (cfg *config) StatsInterval() time.Duration {
+	return cfg.statsInterval
+}
+
+func (cfg *config) LogFormat() string {
+	return cfg.logFormat
+}
+
 func readSubscriptions(namespace string, logger core.Logger) ([]string, error) {
 	subscriptionsPath, ok := os.LookupEnv("SUBSCRIPTIONS")
 	if !ok {
@@ -211,8 +689,38 @@ func readSubscriptions(namespace string, logger core.Logger) ([]string, error) {
 
 	logger.Log(core.LogLevelInfo, fmt.Sprintf("Subscriptions file found at '%s'", subscriptionsPath))
 
-	lines := strings.Split(string(content), "\n")
-	subscriptions := make([]string, 0, len(lines))
+	subscriptions := parseTopics(string(content), namespace)
+	if len(subscriptions) == 0 {
+		logger.Log(core.LogLevelWarning, "Subscriptions file empty, starting without subscriptions")
+	}
+
+	return subscriptions, nil
+}
+
+func readPublications(namespace string, logger core.Logger) ([]string, error) {
+	publicationsPath := strings.TrimSpace(os.Getenv("PUBLICATIONS"))
+	if publicationsPath == "" {
+		return nil, nil
+	}
+
+	content, err := ioutil.ReadFile(publicationsPath)
+	if err != nil {
+		return nil, fmt.Errorf("can't read publications: %s", err)
+	}
+
+	logger.Log(core.LogLevelInfo, fmt.Sprintf("Publications file found at '%s'", publicationsPath))
+
+	publications := parseTopics(string(content), namespace)
+	if len(publications) == 0 {
+		logger.Log(core.LogLevelWarning, "Publications file empty, publishing is not allowed")
+	}
+
+	return publications, nil
+}
+
+func parseTopics(content, namespace string) []string {
+	lines := strings.Split(content, "\n")
+	topics := make([]string, 0, len(lines))
 	for _, line := range lines {
 		line = strings.TrimSpace(line)
 		if line != "" {
@@ -220,15 +728,10 @@ func readSubscriptions(namespace string, logger core.Logger) ([]string, error) {
 			if namespace != nullNamespace {
 				topic = fmt.Sprintf("%s/%s", namespace, topic)
 			}
-			subscriptions = append(subscriptions, topic)
+			topics = append(topics, topic)
 		}
 	}
-
-	if len(subscriptions) == 0 {
-		logger.Log(core.LogLevelWarning, "Subscriptions file empty, starting without subscriptions")
-	}
-
-	return subscriptions, nil
+	return topics
 }
 
 func readCredentials(credentialsTitle, credentialsEnvVar, defaultCredentialsPath string, logger core.Logger) (core.Credentials, error) {
@@ -270,13 +773,60 @@ func getServiceCmdLine(logger core.Logger) (string, error) {
 		return "", errors.New("SERVICE_PROCESSOR can't be empty")
 	}
 
-	parts := strings.Fields(serviceCmdLine)
+	err := checkCmdLine(serviceCmdLine)
+	if err != nil {
+		return "", fmt.Errorf("SERVICE_PROCESSOR %s", err)
+	}
+	return serviceCmdLine, nil
+}
+
+func checkCmdLine(cmdLine string) error {
+	parts := strings.Fields(cmdLine)
 	info, err := os.Stat(parts[0])
 	if err != nil {
-		return "", err
+		return err
 	}
 	if info.IsDir() {
-		return "", errors.New("SERVICE_PROCESSOR should reference to a file")
+		return errors.New("should reference to a file")
 	}
-	return serviceCmdLine, nil
+	return nil
+}
+
+func getDuration(envVar string, defaultValue time.Duration) (time.Duration, error) {
+	value := strings.TrimSpace(os.Getenv(envVar))
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("can't parse %s: %s", envVar, err)
+	}
+	return duration, nil
+}
+
+func getBool(envVar string, defaultValue bool) (bool, error) {
+	value := strings.TrimSpace(os.Getenv(envVar))
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	result, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("can't parse %s: %s", envVar, err)
+	}
+	return result, nil
+}
+
+func getInt(envVar string, defaultValue int) (int, error) {
+	value := strings.TrimSpace(os.Getenv(envVar))
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	result, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("can't parse %s: %s", envVar, err)
+	}
+	return result, nil
 }
@@ -350,6 +350,120 @@ func TestLogLevelConsoleRemote(t *testing.T) {
 	assert.Equal(t, "info", cfg.LogLevelRemote())
 }
 
+func TestLogLevelControl(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	serviceProcessorFile, _ := ioutil.TempFile("", "")
+	defer os.Remove(serviceProcessorFile.Name())
+
+	setEnv(map[string]string{
+		"SERVICE_PROCESSOR": serviceProcessorFile.Name(),
+	})
+
+	cfg, err := env.NewAdapterConfig(&mockLogger{})
+	assert.Nil(t, err)
+	assert.False(t, cfg.LogLevelControl())
+	assert.False(t, cfg.LogLevelForward())
+
+	setEnv(map[string]string{
+		"LOG_LEVEL_CONTROL": "true",
+		"LOG_LEVEL_FORWARD": "true",
+	})
+
+	cfg, err = env.NewAdapterConfig(&mockLogger{})
+	assert.Nil(t, err)
+	assert.True(t, cfg.LogLevelControl())
+	assert.True(t, cfg.LogLevelForward())
+}
+
+func TestMetricsConfig(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	cfg, err := env.NewBridgeConfig(&mockLogger{})
+	assert.Nil(t, err)
+	assert.Equal(t, "", cfg.MetricsAddress())
+	assert.Equal(t, "/metrics", cfg.MetricsPath())
+
+	setEnv(map[string]string{
+		"METRICS_ADDRESS": ":9100",
+		"METRICS_PATH":    "/samm/metrics",
+	})
+
+	cfg, err = env.NewBridgeConfig(&mockLogger{})
+	assert.Nil(t, err)
+	assert.Equal(t, ":9100", cfg.MetricsAddress())
+	assert.Equal(t, "/samm/metrics", cfg.MetricsPath())
+
+	setEnv(map[string]string{
+		"METRICS_PATH": "metrics",
+	})
+
+	_, err = env.NewBridgeConfig(&mockLogger{})
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "METRICS_PATH should start with '/'", err.Error())
+	}
+}
+
+func TestStatsInterval(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	cfg, err := env.NewBridgeConfig(&mockLogger{})
+	assert.Nil(t, err)
+	assert.Equal(t, time.Duration(0), cfg.StatsInterval())
+
+	setEnv(map[string]string{
+		"STATS_INTERVAL": "30s",
+	})
+
+	cfg, err = env.NewBridgeConfig(&mockLogger{})
+	assert.Nil(t, err)
+	assert.Equal(t, 30*time.Second, cfg.StatsInterval())
+
+	setEnv(map[string]string{
+		"STATS_INTERVAL": "-1s",
+	})
+
+	_, err = env.NewBridgeConfig(&mockLogger{})
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "STATS_INTERVAL can't be negative", err.Error())
+	}
+}
+
+func TestLogFormat(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	serviceProcessorFile, _ := ioutil.TempFile("", "")
+	defer os.Remove(serviceProcessorFile.Name())
+
+	setEnv(map[string]string{
+		"SERVICE_PROCESSOR": serviceProcessorFile.Name(),
+	})
+
+	cfg, err := env.NewAdapterConfig(&mockLogger{})
+	assert.Nil(t, err)
+	assert.Equal(t, "text", cfg.LogFormat())
+
+	setEnv(map[string]string{
+		"LOG_FORMAT": "JSON",
+	})
+
+	cfg, err = env.NewAdapterConfig(&mockLogger{})
+	assert.Nil(t, err)
+	assert.Equal(t, "json", cfg.LogFormat())
+
+	setEnv(map[string]string{
+		"LOG_FORMAT": "xml",
+	})
+
+	_, err = env.NewAdapterConfig(&mockLogger{})
+	assert.NotNil(t, err)
+	assert.Equal(t, "LOG_FORMAT should be one of: text, logfmt, json", err.Error())
+}
+
 func TestServiceProcessorEmpty(t *testing.T) {
 	clearEnv()
 	defer clearEnv()
@@ -410,6 +524,268 @@ func TestDefaultValues(t *testing.T) {
 	assert.Equal(t, core.Credentials{}, cfg.PublisherCredentials())
 	assert.Equal(t, "tcp://mqtt:1883", cfg.ListenerURL())
 	assert.Equal(t, "tcp://mqtt:1883", cfg.PublisherURL())
+	assert.Equal(t, "", cfg.ServiceReadiness())
+	assert.Equal(t, 60*time.Second, cfg.ServiceReadinessTimeout())
+	assert.Equal(t, time.Duration(0), cfg.ServiceWatchdogTimeout())
+	assert.False(t, cfg.MessageEnvelope())
+	assert.False(t, cfg.MessageCausationID())
+	assert.Equal(t, "", cfg.SchemaDir())
+	assert.Equal(t, "reject", cfg.SchemaValidation())
+	assert.False(t, cfg.SchemaValidateInput())
+	assert.Nil(t, cfg.Publications())
+	assert.Equal(t, "", cfg.PublishNamespace())
+}
+
+func TestServiceReadiness(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	serviceProcessorFile, _ := ioutil.TempFile("", "")
+	defer os.Remove(serviceProcessorFile.Name())
+
+	setEnv(map[string]string{
+		"SERVICE_PROCESSOR":         serviceProcessorFile.Name(),
+		"SERVICE_READINESS":         "tcp:localhost:8080",
+		"SERVICE_READINESS_TIMEOUT": "90s",
+	})
+
+	cfg, err := env.NewAdapterConfig(&mockLogger{})
+	assert.Nil(t, err)
+	assert.Equal(t, "tcp:localhost:8080", cfg.ServiceReadiness())
+	assert.Equal(t, 90*time.Second, cfg.ServiceReadinessTimeout())
+}
+
+func TestServiceWatchdogTimeout(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	serviceProcessorFile, _ := ioutil.TempFile("", "")
+	defer os.Remove(serviceProcessorFile.Name())
+
+	setEnv(map[string]string{
+		"SERVICE_PROCESSOR":        serviceProcessorFile.Name(),
+		"SERVICE_WATCHDOG_TIMEOUT": "15s",
+	})
+
+	cfg, err := env.NewAdapterConfig(&mockLogger{})
+	assert.Nil(t, err)
+	assert.Equal(t, 15*time.Second, cfg.ServiceWatchdogTimeout())
+}
+
+func TestServiceReadinessTimeoutInvalid(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	serviceProcessorFile, _ := ioutil.TempFile("", "")
+	defer os.Remove(serviceProcessorFile.Name())
+
+	setEnv(map[string]string{
+		"SERVICE_PROCESSOR":         serviceProcessorFile.Name(),
+		"SERVICE_READINESS_TIMEOUT": "soon",
+	})
+
+	_, err := env.NewAdapterConfig(&mockLogger{})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "can't parse SERVICE_READINESS_TIMEOUT")
+}
+
+func TestMessageEnvelope(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	serviceProcessorFile, _ := ioutil.TempFile("", "")
+	defer os.Remove(serviceProcessorFile.Name())
+
+	setEnv(map[string]string{
+		"SERVICE_PROCESSOR":    serviceProcessorFile.Name(),
+		"MESSAGE_ENVELOPE":     "true",
+		"MESSAGE_CAUSATION_ID": "1",
+	})
+
+	cfg, err := env.NewAdapterConfig(&mockLogger{})
+	assert.Nil(t, err)
+	assert.True(t, cfg.MessageEnvelope())
+	assert.True(t, cfg.MessageCausationID())
+}
+
+func TestBatching(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	serviceProcessorFile, _ := ioutil.TempFile("", "")
+	defer os.Remove(serviceProcessorFile.Name())
+
+	setEnv(map[string]string{
+		"SERVICE_PROCESSOR": serviceProcessorFile.Name(),
+		"BATCH_SIZE":        "50",
+	})
+
+	cfg, err := env.NewAdapterConfig(&mockLogger{})
+	assert.Nil(t, err)
+	assert.Equal(t, 50, cfg.BatchSize())
+	assert.Equal(t, 100*time.Millisecond, cfg.BatchTimeout())
+
+	setEnv(map[string]string{
+		"BATCH_TIMEOUT": "0",
+	})
+
+	_, err = env.NewAdapterConfig(&mockLogger{})
+	assert.NotNil(t, err)
+	assert.Equal(t, "BATCH_TIMEOUT should be positive", err.Error())
+}
+
+func TestDedup(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	serviceProcessorFile, _ := ioutil.TempFile("", "")
+	defer os.Remove(serviceProcessorFile.Name())
+
+	setEnv(map[string]string{
+		"SERVICE_PROCESSOR": serviceProcessorFile.Name(),
+		"DEDUP_KEY":         "payload.tick_uuid",
+		"DEDUP_WINDOW":      "5m",
+	})
+
+	cfg, err := env.NewAdapterConfig(&mockLogger{})
+	assert.Nil(t, err)
+	assert.Equal(t, "payload.tick_uuid", cfg.DedupKey())
+	assert.Equal(t, 5*time.Minute, cfg.DedupWindow())
+	assert.Equal(t, 10000, cfg.DedupWindowSize())
+	assert.Equal(t, time.Minute, cfg.DedupSummaryInterval())
+
+	setEnv(map[string]string{
+		"DEDUP_WINDOW":      "0",
+		"DEDUP_WINDOW_SIZE": "0",
+	})
+
+	_, err = env.NewAdapterConfig(&mockLogger{})
+	assert.NotNil(t, err)
+	assert.Equal(t, "DEDUP_WINDOW and DEDUP_WINDOW_SIZE can't both be unlimited", err.Error())
+}
+
+func TestMessageEnvelopeInvalid(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	serviceProcessorFile, _ := ioutil.TempFile("", "")
+	defer os.Remove(serviceProcessorFile.Name())
+
+	setEnv(map[string]string{
+		"SERVICE_PROCESSOR": serviceProcessorFile.Name(),
+		"MESSAGE_ENVELOPE":  "sometimes",
+	})
+
+	_, err := env.NewAdapterConfig(&mockLogger{})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "can't parse MESSAGE_ENVELOPE")
+}
+
+func TestSchemaValidation(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	serviceProcessorFile, _ := ioutil.TempFile("", "")
+	defer os.Remove(serviceProcessorFile.Name())
+
+	setEnv(map[string]string{
+		"SERVICE_PROCESSOR":     serviceProcessorFile.Name(),
+		"SCHEMA_DIR":            "/srv/schemas",
+		"SCHEMA_VALIDATION":     "Tag",
+		"SCHEMA_VALIDATE_INPUT": "true",
+	})
+
+	cfg, err := env.NewAdapterConfig(&mockLogger{})
+	assert.Nil(t, err)
+	assert.Equal(t, "/srv/schemas", cfg.SchemaDir())
+	assert.Equal(t, "tag", cfg.SchemaValidation())
+	assert.True(t, cfg.SchemaValidateInput())
+}
+
+func TestSchemaValidationInvalid(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	serviceProcessorFile, _ := ioutil.TempFile("", "")
+	defer os.Remove(serviceProcessorFile.Name())
+
+	setEnv(map[string]string{
+		"SERVICE_PROCESSOR": serviceProcessorFile.Name(),
+		"SCHEMA_VALIDATION": "ignore",
+	})
+
+	_, err := env.NewAdapterConfig(&mockLogger{})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "SCHEMA_VALIDATION should be one of")
+}
+
+func TestPublications(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	serviceProcessorFile, _ := ioutil.TempFile("", "")
+	defer os.Remove(serviceProcessorFile.Name())
+
+	publicationsFile, _ := ioutil.TempFile("", "")
+	defer os.Remove(publicationsFile.Name())
+
+	publicationsFile.WriteString("tick\n\nlog/#\n")
+	publicationsFile.Close()
+
+	setEnv(map[string]string{
+		"SERVICE_PROCESSOR":   serviceProcessorFile.Name(),
+		"NAMESPACE_PUBLISHER": "root",
+		"PUBLICATIONS":        publicationsFile.Name(),
+		"PUBLISH_NAMESPACE":   "enforce",
+	})
+
+	cfg, err := env.NewAdapterConfig(&mockLogger{})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"root/tick", "root/log/#"}, cfg.Publications())
+	assert.Equal(t, "enforce", cfg.PublishNamespace())
+}
+
+func TestPublicationsMissing(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	serviceProcessorFile, _ := ioutil.TempFile("", "")
+	defer os.Remove(serviceProcessorFile.Name())
+
+	setEnv(map[string]string{
+		"SERVICE_PROCESSOR": serviceProcessorFile.Name(),
+		"PUBLICATIONS":      fmt.Sprintf("/dummy/publications_%d", time.Now().UnixNano()),
+	})
+
+	_, err := env.NewAdapterConfig(&mockLogger{})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "can't read publications")
+}
+
+func TestPublishNamespaceInvalid(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	serviceProcessorFile, _ := ioutil.TempFile("", "")
+	defer os.Remove(serviceProcessorFile.Name())
+
+	setEnv(map[string]string{
+		"SERVICE_PROCESSOR": serviceProcessorFile.Name(),
+		"PUBLISH_NAMESPACE": "always",
+	})
+
+	_, err := env.NewAdapterConfig(&mockLogger{})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "PUBLISH_NAMESPACE should be one of")
+
+	setEnv(map[string]string{
+		"PUBLISH_NAMESPACE":   "prefix",
+		"NAMESPACE_PUBLISHER": "null",
+	})
+
+	_, err = env.NewAdapterConfig(&mockLogger{})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "PUBLISH_NAMESPACE can't be used with namespace 'null'")
 }
 
 func setEnv(env map[string]string) {
@@ -421,6 +797,15 @@ func setEnv(env map[string]string) {
 func clearEnv() {
 	os.Unsetenv("SERVICE_NAME")
 	os.Unsetenv("SERVICE_PROCESSOR")
+	os.Unsetenv("SERVICES")
+	os.Unsetenv("BRIDGE_ROUTES")
+	os.Unsetenv("BRIDGE_BIDIRECTIONAL")
+	os.Unsetenv("BRIDGE_RAW")
+	os.Unsetenv("BRIDGE_ID")
+	os.Unsetenv("BRIDGE_MAX_HOPS")
+	os.Unsetenv("SERVICE_READINESS")
+	os.Unsetenv("SERVICE_READINESS_TIMEOUT")
+	os.Unsetenv("SERVICE_WATCHDOG_TIMEOUT")
 	os.Unsetenv("NAMESPACE")
 	os.Unsetenv("NAMESPACE_LISTENER")
 	os.Unsetenv("NAMESPACE_PUBLISHER")
@@ -429,6 +814,47 @@ func clearEnv() {
 	os.Unsetenv("MQTT_LISTENER_CREDENTIALS")
 	os.Unsetenv("MQTT_PUBLISHER_CREDENTIALS")
 	os.Unsetenv("SUBSCRIPTIONS")
+	os.Unsetenv("PUBLICATIONS")
+	os.Unsetenv("PUBLISH_NAMESPACE")
+	os.Unsetenv("MESSAGE_ENVELOPE")
+	os.Unsetenv("MESSAGE_CAUSATION_ID")
+	os.Unsetenv("SCHEMA_DIR")
+	os.Unsetenv("SCHEMA_VALIDATION")
+	os.Unsetenv("SCHEMA_VALIDATE_INPUT")
+	os.Unsetenv("ACK_JOURNAL")
+	os.Unsetenv("DELAY_JOURNAL")
+	os.Unsetenv("LOG_FORMAT")
+	os.Unsetenv("LOG_LEVEL_CONTROL")
+	os.Unsetenv("LOG_MQTT_QUEUE_SIZE")
+	os.Unsetenv("LOG_MQTT_RATE_LIMIT")
+	os.Unsetenv("LOG_MQTT_DEDUP")
+	os.Unsetenv("LOG_MQTT_SUMMARY_INTERVAL")
+	os.Unsetenv("METRICS_ADDRESS")
+	os.Unsetenv("METRICS_PATH")
+	os.Unsetenv("STATS_INTERVAL")
+	os.Unsetenv("LOG_LEVEL_FORWARD")
+	os.Unsetenv("LOG_FILE")
+	os.Unsetenv("LOG_FILE_LEVEL")
+	os.Unsetenv("LOG_FILE_FORMAT")
+	os.Unsetenv("LOG_FILE_MAX_SIZE")
+	os.Unsetenv("LOG_FILE_MAX_AGE")
+	os.Unsetenv("LOG_FILE_MAX_COUNT")
+	os.Unsetenv("LOG_SYSLOG")
+	os.Unsetenv("LOG_SYSLOG_LEVEL")
+	os.Unsetenv("LOG_SYSLOG_FACILITY")
+	os.Unsetenv("LOG_JOURNALD")
+	os.Unsetenv("LOG_JOURNALD_LEVEL")
+	os.Unsetenv("SCHEDULE")
+	os.Unsetenv("BATCH_SIZE")
+	os.Unsetenv("BATCH_TIMEOUT")
+	os.Unsetenv("DEDUP_KEY")
+	os.Unsetenv("DEDUP_WINDOW")
+	os.Unsetenv("DEDUP_WINDOW_SIZE")
+	os.Unsetenv("DEDUP_SUMMARY_INTERVAL")
+	os.Unsetenv("RATE_LIMIT")
+	os.Unsetenv("RATE_LIMIT_POLICY")
+	os.Unsetenv("RATE_LIMITS")
+	os.Unsetenv("RATE_LIMIT_SUMMARY_INTERVAL")
 	os.Unsetenv("DEBUG")
 	os.Unsetenv("LOG_LEVEL")
 	os.Unsetenv("LOG_LEVEL_CONSOLE")
@@ -448,10 +874,23 @@ func (*mockLogger) SetLevels(levelConsole, levelRemote core.LogLevel) {
 func (*mockLogger) SetCreatedAtGetter(getCreatedAt func() time.Time) {
 }
 
+func (*mockLogger) SetConsoleFormat(format core.ConsoleFormat) {
+}
+
 func (log *mockLogger) Log(level core.LogLevel, message string) {
 	log.messages = append(log.messages, mockLoggerMessage{level: level, message: message})
 }
 
+func (log *mockLogger) LogEntry(entry core.LogEntry) {
+	log.Log(entry.Level, entry.Message)
+}
+
+func (*mockLogger) AddSink(sink core.LogSink) {
+}
+
+func (*mockLogger) SetRemoteLimits(limits core.LogLimits) {
+}
+
 func (log *mockLogger) clear() {
 	log.messages = nil
 }
@@ -0,0 +1,196 @@
+package env
+
+import (
+	"errors"
+	"fmt"
+	"gitlab.com/flaneurtv/samm/core"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	defaultLogFileMaxSize  = 10 * 1024 * 1024
+	defaultLogFileMaxCount = 5
+	defaultSyslogFacility  = "local0"
+
+	defaultLogQueueSize       = 1000
+	defaultLogSummaryInterval = 10 * time.Second
+)
+
+type logSinks struct {
+	file         string
+	fileLevel    string
+	fileFormat   string
+	fileMaxSize  int64
+	fileMaxAge   time.Duration
+	fileMaxCount int
+
+	syslog         string
+	syslogLevel    string
+	syslogFacility string
+
+	journald      bool
+	journaldLevel string
+}
+
+func readLogSinks(logLevel, logFormat string) (logSinks, error) {
+	var sinks logSinks
+	var err error
+
+	sinks.file = strings.TrimSpace(os.Getenv("LOG_FILE"))
+	if sinks.file != "" {
+		sinks.fileLevel, err = getLogLevel("LOG_FILE_LEVEL", logLevel)
+		if err != nil {
+			return sinks, err
+		}
+
+		sinks.fileFormat = strings.ToLower(strings.TrimSpace(os.Getenv("LOG_FILE_FORMAT")))
+		if sinks.fileFormat == "" {
+			sinks.fileFormat = logFormat
+		} else if _, ok := core.ParseConsoleFormat(sinks.fileFormat); !ok {
+			return sinks, fmt.Errorf("LOG_FILE_FORMAT should be one of: %s, %s, %s", core.ConsoleFormatText, core.ConsoleFormatLogfmt, core.ConsoleFormatJSON)
+		}
+
+		maxSize, err := getInt("LOG_FILE_MAX_SIZE", defaultLogFileMaxSize)
+		if err != nil {
+			return sinks, err
+		}
+		sinks.fileMaxSize = int64(maxSize)
+
+		sinks.fileMaxAge, err = getDuration("LOG_FILE_MAX_AGE", 0)
+		if err != nil {
+			return sinks, err
+		}
+
+		sinks.fileMaxCount, err = getInt("LOG_FILE_MAX_COUNT", defaultLogFileMaxCount)
+		if err != nil {
+			return sinks, err
+		}
+
+		if sinks.fileMaxSize < 0 || sinks.fileMaxAge < 0 || sinks.fileMaxCount < 0 {
+			return sinks, errors.New("LOG_FILE_MAX_SIZE, LOG_FILE_MAX_AGE and LOG_FILE_MAX_COUNT can't be negative")
+		}
+	}
+
+	sinks.syslog = strings.TrimSpace(os.Getenv("LOG_SYSLOG"))
+	if sinks.syslog != "" {
+		sinks.syslogLevel, err = getLogLevel("LOG_SYSLOG_LEVEL", logLevel)
+		if err != nil {
+			return sinks, err
+		}
+
+		sinks.syslogFacility = strings.ToLower(strings.TrimSpace(os.Getenv("LOG_SYSLOG_FACILITY")))
+		if sinks.syslogFacility == "" {
+			sinks.syslogFacility = defaultSyslogFacility
+		}
+	}
+
+	sinks.journald, err = getBool("LOG_JOURNALD", false)
+	if err != nil {
+		return sinks, err
+	}
+	if sinks.journald {
+		sinks.journaldLevel, err = getLogLevel("LOG_JOURNALD_LEVEL", logLevel)
+		if err != nil {
+			return sinks, err
+		}
+	}
+
+	return sinks, nil
+}
+
+func readLogLimits() (core.LogLimits, error) {
+	var limits core.LogLimits
+	var err error
+
+	limits.QueueSize, err = getInt("LOG_MQTT_QUEUE_SIZE", defaultLogQueueSize)
+	if err != nil {
+		return limits, err
+	}
+	if limits.QueueSize < 0 {
+		return limits, errors.New("LOG_MQTT_QUEUE_SIZE can't be negative")
+	}
+
+	rateLimit := strings.TrimSpace(os.Getenv("LOG_MQTT_RATE_LIMIT"))
+	if rateLimit != "" {
+		limits.Rate, limits.Burst, err = parseRate(rateLimit)
+		if err != nil {
+			return limits, fmt.Errorf("can't parse LOG_MQTT_RATE_LIMIT: %s", err)
+		}
+		if limits.Rate <= 0 || limits.Burst < 0 {
+			return limits, errors.New("LOG_MQTT_RATE_LIMIT should be positive")
+		}
+	}
+
+	limits.Dedup, err = getBool("LOG_MQTT_DEDUP", true)
+	if err != nil {
+		return limits, err
+	}
+
+	limits.SummaryInterval, err = getDuration("LOG_MQTT_SUMMARY_INTERVAL", defaultLogSummaryInterval)
+	if err != nil {
+		return limits, err
+	}
+	if limits.SummaryInterval <= 0 {
+		return limits, errors.New("LOG_MQTT_SUMMARY_INTERVAL should be positive")
+	}
+
+	return limits, nil
+}
+
+func getLogLevel(envVar, defaultValue string) (string, error) {
+	value := strings.ToLower(strings.TrimSpace(os.Getenv(envVar)))
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	if _, ok := core.ParseLogLevel(value); !ok {
+		return "", fmt.Errorf("%s should be one of: debug, info, notice, warning, error, critical, alert, emergency", envVar)
+	}
+	return value, nil
+}
+
+func (cfg *config) LogFile() string {
+	return cfg.logSinks.file
+}
+
+func (cfg *config) LogFileLevel() string {
+	return cfg.logSinks.fileLevel
+}
+
+func (cfg *config) LogFileFormat() string {
+	return cfg.logSinks.fileFormat
+}
+
+func (cfg *config) LogFileMaxSize() int64 {
+	return cfg.logSinks.fileMaxSize
+}
+
+func (cfg *config) LogFileMaxAge() time.Duration {
+	return cfg.logSinks.fileMaxAge
+}
+
+func (cfg *config) LogFileMaxCount() int {
+	return cfg.logSinks.fileMaxCount
+}
+
+func (cfg *config) LogSyslog() string {
+	return cfg.logSinks.syslog
+}
+
+func (cfg *config) LogSyslogLevel() string {
+	return cfg.logSinks.syslogLevel
+}
+
+func (cfg *config) LogSyslogFacility() string {
+	return cfg.logSinks.syslogFacility
+}
+
+func (cfg *config) LogJournald() bool {
+	return cfg.logSinks.journald
+}
+
+func (cfg *config) LogJournaldLevel() string {
+	return cfg.logSinks.journaldLevel
+}
@@ -0,0 +1,110 @@
+package env_test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/flaneurtv/samm/core"
+	"gitlab.com/flaneurtv/samm/core/env"
+	"testing"
+	"time"
+)
+
+func TestLogSinks(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	setEnv(map[string]string{
+		"LOG_LEVEL":          "warning",
+		"LOG_FORMAT":         "logfmt",
+		"LOG_FILE":           "/var/log/samm.log",
+		"LOG_FILE_MAX_AGE":   "168h",
+		"LOG_SYSLOG":         "udp://syslog:514",
+		"LOG_SYSLOG_LEVEL":   "Error",
+		"LOG_JOURNALD":       "true",
+		"LOG_JOURNALD_LEVEL": "debug",
+	})
+
+	cfg, err := env.NewBridgeConfig(&mockLogger{})
+	assert.Nil(t, err)
+
+	assert.Equal(t, "/var/log/samm.log", cfg.LogFile())
+	assert.Equal(t, "warning", cfg.LogFileLevel())
+	assert.Equal(t, "logfmt", cfg.LogFileFormat())
+	assert.Equal(t, int64(10*1024*1024), cfg.LogFileMaxSize())
+	assert.Equal(t, 168*time.Hour, cfg.LogFileMaxAge())
+	assert.Equal(t, 5, cfg.LogFileMaxCount())
+
+	assert.Equal(t, "udp://syslog:514", cfg.LogSyslog())
+	assert.Equal(t, "error", cfg.LogSyslogLevel())
+	assert.Equal(t, "local0", cfg.LogSyslogFacility())
+
+	assert.True(t, cfg.LogJournald())
+	assert.Equal(t, "debug", cfg.LogJournaldLevel())
+}
+
+func TestLogSinksInvalid(t *testing.T) {
+	cases := []struct {
+		env map[string]string
+		err string
+	}{
+		{map[string]string{"LOG_FILE": "samm.log", "LOG_FILE_LEVEL": "verbose"}, "LOG_FILE_LEVEL should be one of: debug, info, notice, warning, error, critical, alert, emergency"},
+		{map[string]string{"LOG_FILE": "samm.log", "LOG_FILE_FORMAT": "xml"}, "LOG_FILE_FORMAT should be one of: text, logfmt, json"},
+		{map[string]string{"LOG_FILE": "samm.log", "LOG_FILE_MAX_COUNT": "-1"}, "LOG_FILE_MAX_SIZE, LOG_FILE_MAX_AGE and LOG_FILE_MAX_COUNT can't be negative"},
+		{map[string]string{"LOG_SYSLOG": "udp://syslog:514", "LOG_SYSLOG_LEVEL": "loud"}, "LOG_SYSLOG_LEVEL should be one of: debug, info, notice, warning, error, critical, alert, emergency"},
+		{map[string]string{"LOG_JOURNALD": "maybe"}, "can't parse LOG_JOURNALD"},
+	}
+
+	for _, c := range cases {
+		clearEnv()
+		setEnv(c.env)
+
+		_, err := env.NewBridgeConfig(&mockLogger{})
+		if assert.NotNil(t, err, c.err) {
+			assert.Contains(t, err.Error(), c.err)
+		}
+	}
+	clearEnv()
+}
+
+func TestLogLimits(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	cfg, err := env.NewBridgeConfig(&mockLogger{})
+	assert.Nil(t, err)
+	assert.Equal(t, core.LogLimits{QueueSize: 1000, Dedup: true, SummaryInterval: 10 * time.Second}, cfg.LogLimits())
+
+	setEnv(map[string]string{
+		"LOG_MQTT_QUEUE_SIZE":       "0",
+		"LOG_MQTT_RATE_LIMIT":       "2.5:10",
+		"LOG_MQTT_DEDUP":            "false",
+		"LOG_MQTT_SUMMARY_INTERVAL": "1m",
+	})
+
+	cfg, err = env.NewBridgeConfig(&mockLogger{})
+	assert.Nil(t, err)
+	assert.Equal(t, core.LogLimits{Rate: 2.5, Burst: 10, SummaryInterval: time.Minute}, cfg.LogLimits())
+}
+
+func TestLogLimitsInvalid(t *testing.T) {
+	cases := []struct {
+		env map[string]string
+		err string
+	}{
+		{map[string]string{"LOG_MQTT_QUEUE_SIZE": "-1"}, "LOG_MQTT_QUEUE_SIZE can't be negative"},
+		{map[string]string{"LOG_MQTT_RATE_LIMIT": "fast"}, "can't parse LOG_MQTT_RATE_LIMIT"},
+		{map[string]string{"LOG_MQTT_RATE_LIMIT": "0"}, "LOG_MQTT_RATE_LIMIT should be positive"},
+		{map[string]string{"LOG_MQTT_DEDUP": "maybe"}, "can't parse LOG_MQTT_DEDUP"},
+		{map[string]string{"LOG_MQTT_SUMMARY_INTERVAL": "0s"}, "LOG_MQTT_SUMMARY_INTERVAL should be positive"},
+	}
+
+	for _, c := range cases {
+		clearEnv()
+		setEnv(c.env)
+
+		_, err := env.NewBridgeConfig(&mockLogger{})
+		if assert.NotNil(t, err, c.err) {
+			assert.Contains(t, err.Error(), c.err)
+		}
+	}
+	clearEnv()
+}
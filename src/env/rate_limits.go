@@ -0,0 +1,113 @@
+package env
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gitlab.com/flaneurtv/samm/core"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type rateLimitEntry struct {
+	Topic  string  `json:"topic"`
+	Rate   float64 `json:"rate"`
+	Burst  int     `json:"burst"`
+	Policy string  `json:"policy"`
+	Sample int     `json:"sample"`
+}
+
+func readRateLimits(logger core.Logger) ([]core.RateLimit, error) {
+	var limits []core.RateLimit
+
+	global := strings.TrimSpace(os.Getenv("RATE_LIMIT"))
+	if global != "" {
+		entry := rateLimitEntry{Topic: "#", Policy: strings.ToLower(strings.TrimSpace(os.Getenv("RATE_LIMIT_POLICY")))}
+
+		var err error
+		entry.Rate, entry.Burst, err = parseRate(global)
+		if err != nil {
+			return nil, fmt.Errorf("can't parse RATE_LIMIT: %s", err)
+		}
+
+		limit, err := newRateLimit(entry)
+		if err != nil {
+			return nil, fmt.Errorf("RATE_LIMIT: %s", err)
+		}
+		limits = append(limits, limit)
+	}
+
+	limitsPath := strings.TrimSpace(os.Getenv("RATE_LIMITS"))
+	if limitsPath != "" {
+		content, err := ioutil.ReadFile(limitsPath)
+		if err != nil {
+			return nil, fmt.Errorf("can't read rate limits: %s", err)
+		}
+
+		var entries []rateLimitEntry
+		err = json.Unmarshal(content, &entries)
+		if err != nil {
+			return nil, fmt.Errorf("can't parse rate limits: %s", err)
+		}
+
+		logger.Log(core.LogLevelInfo, fmt.Sprintf("Rate limits file found at '%s'", limitsPath))
+
+		for i, entry := range entries {
+			limit, err := newRateLimit(entry)
+			if err != nil {
+				return nil, fmt.Errorf("rate limit #%d: %s", i+1, err)
+			}
+			limits = append(limits, limit)
+		}
+	}
+
+	return limits, nil
+}
+
+// parseRate parses "$RATE[:$BURST]". The burst is 0 if missing.
+func parseRate(value string) (float64, int, error) {
+	rate, burst := value, ""
+	if i := strings.Index(value, ":"); i >= 0 {
+		rate, burst = value[:i], value[i+1:]
+	}
+
+	r, err := strconv.ParseFloat(rate, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	var b int
+	if burst != "" {
+		b, err = strconv.Atoi(burst)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	return r, b, nil
+}
+
+func newRateLimit(entry rateLimitEntry) (core.RateLimit, error) {
+	if strings.TrimSpace(entry.Topic) == "" {
+		return core.RateLimit{}, errors.New("topic can't be empty")
+	}
+	if entry.Rate <= 0 {
+		return core.RateLimit{}, errors.New("rate should be positive")
+	}
+	if entry.Burst < 0 || entry.Sample < 0 {
+		return core.RateLimit{}, errors.New("burst and sample can't be negative")
+	}
+
+	policy, ok := core.ParseRateLimitPolicy(strings.ToLower(entry.Policy))
+	if !ok {
+		return core.RateLimit{}, fmt.Errorf("policy should be one of: %s, %s, %s", core.RateLimitPolicyDelay, core.RateLimitPolicyDrop, core.RateLimitPolicySample)
+	}
+
+	return core.RateLimit{
+		Topic:  strings.TrimSpace(entry.Topic),
+		Rate:   entry.Rate,
+		Burst:  entry.Burst,
+		Policy: policy,
+		Sample: entry.Sample,
+	}, nil
+}
@@ -0,0 +1,75 @@
+package env_test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/flaneurtv/samm/core"
+	"gitlab.com/flaneurtv/samm/core/env"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestRateLimits(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	limitsFile, _ := ioutil.TempFile("", "")
+	defer os.Remove(limitsFile.Name())
+
+	limitsFile.WriteString(`[{"topic": "default/metrics/#", "rate": 0.5, "policy": "sample", "sample": 5}]`)
+	limitsFile.Close()
+
+	setEnv(map[string]string{
+		"RATE_LIMIT":                  "100:200",
+		"RATE_LIMIT_POLICY":           "Drop",
+		"RATE_LIMITS":                 limitsFile.Name(),
+		"RATE_LIMIT_SUMMARY_INTERVAL": "10s",
+	})
+
+	cfg, err := env.NewBridgeConfig(&mockLogger{})
+	assert.Nil(t, err)
+	assert.Equal(t, []core.RateLimit{
+		{Topic: "#", Rate: 100, Burst: 200, Policy: core.RateLimitPolicyDrop},
+		{Topic: "default/metrics/#", Rate: 0.5, Policy: core.RateLimitPolicySample, Sample: 5},
+	}, cfg.RateLimits())
+	assert.Equal(t, 10*time.Second, cfg.RateLimitSummaryInterval())
+}
+
+func TestRateLimitsInvalid(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	cases := map[string]string{
+		`{"topic": "#"}`:   "can't parse rate limits",
+		`[{"rate": 1}]`:    "rate limit #1: topic can't be empty",
+		`[{"topic": "#"}]`: "rate limit #1: rate should be positive",
+		`[{"topic": "#", "rate": 1, "burst": -1}]`:    "rate limit #1: burst and sample can't be negative",
+		`[{"topic": "#", "rate": 1, "policy": "ok"}]`: "rate limit #1: policy should be one of: delay, drop, sample",
+	}
+
+	for content, expectedErr := range cases {
+		limitsFile, _ := ioutil.TempFile("", "")
+		limitsFile.WriteString(content)
+		limitsFile.Close()
+
+		setEnv(map[string]string{
+			"RATE_LIMITS": limitsFile.Name(),
+		})
+
+		_, err := env.NewBridgeConfig(&mockLogger{})
+		os.Remove(limitsFile.Name())
+
+		if assert.NotNil(t, err, content) {
+			assert.Contains(t, err.Error(), expectedErr, content)
+		}
+	}
+
+	clearEnv()
+	setEnv(map[string]string{
+		"RATE_LIMIT": "fast",
+	})
+	_, err := env.NewBridgeConfig(&mockLogger{})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "can't parse RATE_LIMIT")
+}
@@ -0,0 +1,94 @@
+package env
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gitlab.com/flaneurtv/samm/core"
+	"io/ioutil"
+	"regexp"
+)
+
+type routeEntry struct {
+	Name       string        `json:"name"`
+	Sources    []string      `json:"sources"`
+	Target     string        `json:"target"`
+	Direction  string        `json:"direction"`
+	Filters    []filterEntry `json:"filters"`
+	Transforms []string      `json:"transforms"`
+}
+
+type filterEntry struct {
+	Path    string          `json:"path"`
+	Exists  *bool           `json:"exists"`
+	Equals  json.RawMessage `json:"equals"`
+	Matches string          `json:"matches"`
+}
+
+func readRoutes(routesPath string, logger core.Logger) ([]core.BridgeRoute, error) {
+	content, err := ioutil.ReadFile(routesPath)
+	if err != nil {
+		return nil, fmt.Errorf("can't read routes: %s", err)
+	}
+
+	var entries []routeEntry
+	err = json.Unmarshal(content, &entries)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse routes: %s", err)
+	}
+	if len(entries) == 0 {
+		return nil, errors.New("routes file doesn't contain any route")
+	}
+
+	logger.Log(core.LogLevelInfo, fmt.Sprintf("Routes file found at '%s'", routesPath))
+
+	routes := make([]core.BridgeRoute, 0, len(entries))
+	for i, entry := range entries {
+		name := entry.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+
+		direction, ok := core.ParseBridgeDirection(entry.Direction)
+		if !ok {
+			return nil, fmt.Errorf("route '%s': direction should be one of: %s, %s", name, core.BridgeDirectionForward, core.BridgeDirectionReverse)
+		}
+
+		filters := make([]core.BridgeFilter, 0, len(entry.Filters))
+		for _, f := range entry.Filters {
+			filter := core.BridgeFilter{Path: f.Path, Exists: f.Exists, Equals: string(f.Equals)}
+			if f.Matches != "" {
+				filter.Matches, err = regexp.Compile(f.Matches)
+				if err != nil {
+					return nil, fmt.Errorf("route '%s': invalid filter pattern: %s", name, err)
+				}
+			}
+			filters = append(filters, filter)
+		}
+
+		transforms := make([]core.Transform, 0, len(entry.Transforms))
+		for _, expr := range entry.Transforms {
+			transform, err := core.ParseTransform(expr)
+			if err != nil {
+				return nil, fmt.Errorf("route '%s': %s", name, err)
+			}
+			transforms = append(transforms, transform)
+		}
+
+		route := core.BridgeRoute{
+			Name:       name,
+			Sources:    entry.Sources,
+			Target:     entry.Target,
+			Direction:  direction,
+			Filters:    filters,
+			Transforms: transforms,
+		}
+		err := route.Validate()
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, route)
+	}
+
+	return routes, nil
+}
@@ -0,0 +1,156 @@
+package env_test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/flaneurtv/samm/core"
+	"gitlab.com/flaneurtv/samm/core/env"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestBridgeRoutes(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	routesFile, _ := ioutil.TempFile("", "")
+	defer os.Remove(routesFile.Name())
+
+	routesFile.WriteString(`[
+  {"name": "ticks", "sources": ["tick/+/status"], "target": "tack/{1}/status", "transforms": ["del(payload.secret)", "set(payload.bridged, true)"], "filters": [{"path": "payload.level", "equals": "error"}, {"path": "payload.id", "matches": "^[0-9]+$"}]},
+  {"sources": ["tack/#"], "target": "tick/{1}", "direction": "reverse", "filters": [{"path": "payload.internal", "exists": false}]}
+]`)
+	routesFile.Close()
+
+	setEnv(map[string]string{
+		"BRIDGE_ROUTES": routesFile.Name(),
+	})
+
+	cfg, err := env.NewBridgeConfig(&mockLogger{})
+	assert.Nil(t, err)
+
+	routes := cfg.BridgeRoutes()
+	assert.Equal(t, 2, len(routes))
+
+	assert.Equal(t, "ticks", routes[0].Name)
+	assert.Equal(t, []string{"tick/+/status"}, routes[0].Sources)
+	assert.Equal(t, "tack/{1}/status", routes[0].Target)
+	assert.Equal(t, core.BridgeDirectionForward, routes[0].Direction)
+	assert.Equal(t, 2, len(routes[0].Filters))
+	assert.Equal(t, `"error"`, routes[0].Filters[0].Equals)
+	assert.Equal(t, "^[0-9]+$", routes[0].Filters[1].Matches.String())
+	assert.Equal(t, 2, len(routes[0].Transforms))
+	assert.Equal(t, "set(payload.bridged, true)", routes[0].Transforms[1].String())
+
+	assert.Equal(t, "#2", routes[1].Name)
+	assert.Equal(t, core.BridgeDirectionReverse, routes[1].Direction)
+	assert.False(t, *routes[1].Filters[0].Exists)
+
+	assert.False(t, cfg.BridgeBidirectional())
+	assert.Equal(t, cfg.ServiceUUID(), cfg.BridgeID())
+
+	setEnv(map[string]string{
+		"BRIDGE_RAW": "true",
+	})
+
+	_, err = env.NewBridgeConfig(&mockLogger{})
+	assert.NotNil(t, err)
+	assert.Equal(t, "reverse routes can't be used with BRIDGE_RAW, as raw messages can't be marked to prevent loops", err.Error())
+}
+
+func TestBridgeRoutesInvalid(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	cases := map[string]string{
+		`{"name": "ticks"}`:                     "can't parse routes",
+		`[]`:                                    "routes file doesn't contain any route",
+		`[{"name": "ticks", "target": "tack"}]`: "route 'ticks': sources can't be empty",
+		`[{"sources": ["tick"]}]`:               "route '#1': target can't be empty",
+		`[{"sources": ["tick"], "target": "tack", "direction": "both"}]`:                        "route '#1': direction should be one of: forward, reverse",
+		`[{"sources": ["tick/+"], "target": "tack/{2}"}]`:                                       "route '#1': source 'tick/+' has 1 wildcards, target 'tack/{2}' uses {2}",
+		`[{"sources": ["tick/+"], "target": "tack/{0}"}]`:                                       "route '#1': placeholder '{0}' should start at {1}",
+		`[{"sources": ["tick"], "target": "tack", "filters": [{"equals": 1}]}]`:                 "route '#1': filter path can't be empty",
+		`[{"sources": ["tick"], "target": "tack", "filters": [{"path": "a", "matches": "("}]}]`: "route '#1': invalid filter pattern",
+		`[{"sources": ["tick"], "target": "tack", "transforms": ["drop(a)"]}]`:                  "route '#1': invalid transform 'drop(a)': unknown operation 'drop'",
+	}
+
+	for content, expectedErr := range cases {
+		routesFile, _ := ioutil.TempFile("", "")
+		routesFile.WriteString(content)
+		routesFile.Close()
+
+		setEnv(map[string]string{
+			"BRIDGE_ROUTES": routesFile.Name(),
+		})
+
+		_, err := env.NewBridgeConfig(&mockLogger{})
+		os.Remove(routesFile.Name())
+
+		if assert.NotNil(t, err, content) {
+			assert.Contains(t, err.Error(), expectedErr, content)
+		}
+	}
+}
+
+func TestBridgeLoopPrevention(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	cfg, err := env.NewBridgeConfig(&mockLogger{})
+	assert.Nil(t, err)
+	assert.False(t, cfg.BridgeBidirectional())
+	assert.Equal(t, "", cfg.BridgeID())
+	assert.Equal(t, 8, cfg.BridgeMaxHops())
+
+	setEnv(map[string]string{
+		"BRIDGE_BIDIRECTIONAL": "true",
+		"BRIDGE_MAX_HOPS":      "3",
+	})
+
+	cfg, err = env.NewBridgeConfig(&mockLogger{})
+	assert.Nil(t, err)
+	assert.True(t, cfg.BridgeBidirectional())
+	assert.Equal(t, cfg.ServiceUUID(), cfg.BridgeID())
+	assert.Equal(t, 3, cfg.BridgeMaxHops())
+
+	setEnv(map[string]string{
+		"BRIDGE_ID":       "bridge-1",
+		"BRIDGE_MAX_HOPS": "-1",
+	})
+
+	_, err = env.NewBridgeConfig(&mockLogger{})
+	assert.NotNil(t, err)
+	assert.Equal(t, "BRIDGE_MAX_HOPS can't be negative", err.Error())
+}
+
+func TestBridgeRaw(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	setEnv(map[string]string{
+		"BRIDGE_RAW": "true",
+	})
+
+	cfg, err := env.NewBridgeConfig(&mockLogger{})
+	assert.Nil(t, err)
+	assert.True(t, cfg.BridgeRaw())
+	assert.Equal(t, "", cfg.BridgeID())
+
+	setEnv(map[string]string{
+		"BRIDGE_BIDIRECTIONAL": "true",
+	})
+
+	_, err = env.NewBridgeConfig(&mockLogger{})
+	assert.NotNil(t, err)
+	assert.Equal(t, "BRIDGE_BIDIRECTIONAL can't be used with BRIDGE_RAW, as raw messages can't be marked to prevent loops", err.Error())
+
+	setEnv(map[string]string{
+		"BRIDGE_BIDIRECTIONAL": "false",
+		"BRIDGE_ID":            "bridge-1",
+	})
+
+	_, err = env.NewBridgeConfig(&mockLogger{})
+	assert.NotNil(t, err)
+	assert.Equal(t, "BRIDGE_ID can't be used with BRIDGE_RAW", err.Error())
+}
@@ -0,0 +1,76 @@
+package env
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/tidwall/gjson"
+	"gitlab.com/flaneurtv/samm/core"
+	"io/ioutil"
+	"time"
+)
+
+type scheduleEntry struct {
+	Name    string          `json:"name"`
+	Every   string          `json:"every"`
+	Cron    string          `json:"cron"`
+	Publish json.RawMessage `json:"publish"`
+}
+
+func readSchedules(schedulePath string, logger core.Logger) ([]core.Schedule, error) {
+	content, err := ioutil.ReadFile(schedulePath)
+	if err != nil {
+		return nil, fmt.Errorf("can't read schedule: %s", err)
+	}
+
+	var entries []scheduleEntry
+	err = json.Unmarshal(content, &entries)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse schedule: %s", err)
+	}
+	if len(entries) == 0 {
+		return nil, errors.New("schedule file doesn't contain any entry")
+	}
+
+	logger.Log(core.LogLevelInfo, fmt.Sprintf("Schedule file found at '%s'", schedulePath))
+
+	schedules := make([]core.Schedule, 0, len(entries))
+	for i, entry := range entries {
+		name := entry.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+
+		schedule := core.Schedule{Name: name}
+		switch {
+		case entry.Every != "" && entry.Cron != "":
+			return nil, fmt.Errorf("schedule '%s': every and cron can't be used together", name)
+		case entry.Every != "":
+			schedule.Every, err = time.ParseDuration(entry.Every)
+			if err != nil {
+				return nil, fmt.Errorf("schedule '%s': can't parse every: %s", name, err)
+			}
+			if schedule.Every <= 0 {
+				return nil, fmt.Errorf("schedule '%s': every should be positive", name)
+			}
+		case entry.Cron != "":
+			schedule.Cron, err = core.ParseCron(entry.Cron)
+			if err != nil {
+				return nil, fmt.Errorf("schedule '%s': %s", name, err)
+			}
+		default:
+			return nil, fmt.Errorf("schedule '%s': every or cron is required", name)
+		}
+
+		if len(entry.Publish) > 0 {
+			if !gjson.ParseBytes(entry.Publish).IsObject() {
+				return nil, fmt.Errorf("schedule '%s': publish should be a JSON object", name)
+			}
+			schedule.Publish = string(entry.Publish)
+		}
+
+		schedules = append(schedules, schedule)
+	}
+
+	return schedules, nil
+}
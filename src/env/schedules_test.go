@@ -0,0 +1,84 @@
+package env_test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/flaneurtv/samm/core/env"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestSchedules(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	serviceProcessorFile, _ := ioutil.TempFile("", "")
+	defer os.Remove(serviceProcessorFile.Name())
+
+	scheduleFile, _ := ioutil.TempFile("", "")
+	defer os.Remove(scheduleFile.Name())
+
+	scheduleFile.WriteString(`[
+  {"name": "tick", "every": "30s"},
+  {"cron": "0 3 * * *", "publish": {"topic": "$NAMESPACE_PUBLISHER/cleanup", "payload": {"id": "$UUID"}}}
+]`)
+	scheduleFile.Close()
+
+	setEnv(map[string]string{
+		"SERVICE_PROCESSOR": serviceProcessorFile.Name(),
+		"SCHEDULE":          scheduleFile.Name(),
+	})
+
+	cfg, err := env.NewAdapterConfig(&mockLogger{})
+	assert.Nil(t, err)
+
+	schedules := cfg.Schedules()
+	if assert.Equal(t, 2, len(schedules)) {
+		assert.Equal(t, "tick", schedules[0].Name)
+		assert.Equal(t, 30*time.Second, schedules[0].Every)
+		assert.Nil(t, schedules[0].Cron)
+		assert.Equal(t, "", schedules[0].Publish)
+
+		assert.Equal(t, "#2", schedules[1].Name)
+		assert.NotNil(t, schedules[1].Cron)
+		assert.JSONEq(t, `{"topic": "$NAMESPACE_PUBLISHER/cleanup", "payload": {"id": "$UUID"}}`, schedules[1].Publish)
+	}
+}
+
+func TestSchedulesInvalid(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	serviceProcessorFile, _ := ioutil.TempFile("", "")
+	defer os.Remove(serviceProcessorFile.Name())
+
+	cases := map[string]string{
+		`{"name": "tick"}`:                       "can't parse schedule",
+		`[]`:                                     "schedule file doesn't contain any entry",
+		`[{"name": "tick"}]`:                     "schedule 'tick': every or cron is required",
+		`[{"every": "1m", "cron": "* * * * *"}]`: "schedule '#1': every and cron can't be used together",
+		`[{"every": "soon"}]`:                    "schedule '#1': can't parse every",
+		`[{"every": "-1s"}]`:                     "schedule '#1': every should be positive",
+		`[{"cron": "* * *"}]`:                    "schedule '#1': invalid cron expression '* * *': expected 5 fields",
+		`[{"every": "1m", "publish": "tick"}]`:   "schedule '#1': publish should be a JSON object",
+	}
+
+	for content, expectedErr := range cases {
+		scheduleFile, _ := ioutil.TempFile("", "")
+		scheduleFile.WriteString(content)
+		scheduleFile.Close()
+
+		setEnv(map[string]string{
+			"SERVICE_PROCESSOR": serviceProcessorFile.Name(),
+			"SCHEDULE":          scheduleFile.Name(),
+		})
+
+		_, err := env.NewAdapterConfig(&mockLogger{})
+		os.Remove(scheduleFile.Name())
+
+		if assert.NotNil(t, err, content) {
+			assert.Contains(t, err.Error(), expectedErr, content)
+		}
+	}
+}
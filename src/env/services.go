@@ -0,0 +1,99 @@
+package env
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/satori/go.uuid"
+	"gitlab.com/flaneurtv/samm/core"
+	"io/ioutil"
+	"strings"
+)
+
+type serviceEntry struct {
+	Name            string `json:"name"`
+	Processor       string `json:"processor"`
+	Subscriptions   string `json:"subscriptions"`
+	Schedule        string `json:"schedule"`
+	LogLevel        string `json:"log_level"`
+	LogLevelConsole string `json:"log_level_console"`
+	LogLevelRemote  string `json:"log_level_mqtt"`
+}
+
+func readServices(servicesPath, namespaceListener, logLevelConsole, logLevelRemote string, logger core.Logger) ([]core.ServiceConfiguration, error) {
+	content, err := ioutil.ReadFile(servicesPath)
+	if err != nil {
+		return nil, fmt.Errorf("can't read services: %s", err)
+	}
+
+	var entries []serviceEntry
+	err = json.Unmarshal(content, &entries)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse services: %s", err)
+	}
+	if len(entries) == 0 {
+		return nil, errors.New("services file doesn't contain any service")
+	}
+
+	logger.Log(core.LogLevelInfo, fmt.Sprintf("Services file found at '%s'", servicesPath))
+
+	services := make([]core.ServiceConfiguration, 0, len(entries))
+	names := make(map[string]bool, len(entries))
+	for i, entry := range entries {
+		if entry.Name == "" {
+			return nil, fmt.Errorf("service #%d: name can't be empty", i+1)
+		}
+		if names[entry.Name] {
+			return nil, fmt.Errorf("service '%s' is defined more than once", entry.Name)
+		}
+		names[entry.Name] = true
+
+		if strings.TrimSpace(entry.Processor) == "" {
+			return nil, fmt.Errorf("service '%s': processor can't be empty", entry.Name)
+		}
+		err := checkCmdLine(entry.Processor)
+		if err != nil {
+			return nil, fmt.Errorf("service '%s': processor %s", entry.Name, err)
+		}
+
+		var subscriptions []string
+		if entry.Subscriptions != "" {
+			content, err := ioutil.ReadFile(entry.Subscriptions)
+			if err != nil {
+				return nil, fmt.Errorf("service '%s': can't read subscriptions: %s", entry.Name, err)
+			}
+			subscriptions = parseTopics(string(content), namespaceListener)
+		}
+
+		var schedules []core.Schedule
+		if entry.Schedule != "" {
+			schedules, err = readSchedules(entry.Schedule, logger)
+			if err != nil {
+				return nil, fmt.Errorf("service '%s': %s", entry.Name, err)
+			}
+		}
+
+		service := core.ServiceConfiguration{
+			Name:            entry.Name,
+			UUID:            uuid.NewV4().String(),
+			CmdLine:         entry.Processor,
+			Subscriptions:   subscriptions,
+			Schedules:       schedules,
+			LogLevelConsole: firstNonEmpty(entry.LogLevelConsole, entry.LogLevel, logLevelConsole),
+			LogLevelRemote:  firstNonEmpty(entry.LogLevelRemote, entry.LogLevel, logLevelRemote),
+		}
+		services = append(services, service)
+	}
+
+	return services, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		value = strings.ToLower(strings.TrimSpace(value))
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,135 @@
+package env_test
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/flaneurtv/samm/core/env"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestServices(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	processorFile1, _ := ioutil.TempFile("", "")
+	defer os.Remove(processorFile1.Name())
+
+	processorFile2, _ := ioutil.TempFile("", "")
+	defer os.Remove(processorFile2.Name())
+
+	subscriptionsFile, _ := ioutil.TempFile("", "")
+	defer os.Remove(subscriptionsFile.Name())
+
+	scheduleFile, _ := ioutil.TempFile("", "")
+	defer os.Remove(scheduleFile.Name())
+
+	servicesFile, _ := ioutil.TempFile("", "")
+	defer os.Remove(servicesFile.Name())
+
+	subscriptionsFile.WriteString("tick\ntock\n")
+	subscriptionsFile.Close()
+	scheduleFile.WriteString(`[{"name": "tick", "every": "30s"}]`)
+	scheduleFile.Close()
+	servicesFile.WriteString(fmt.Sprintf(`[
+  {"name": "first", "processor": "%s run", "subscriptions": "%s", "log_level": "info"},
+  {"name": "second", "processor": "%s", "schedule": "%s", "log_level_mqtt": "Debug"}
+]`, processorFile1.Name(), subscriptionsFile.Name(), processorFile2.Name(), scheduleFile.Name()))
+	servicesFile.Close()
+
+	setEnv(map[string]string{
+		"SERVICES":           servicesFile.Name(),
+		"SERVICE_PROCESSOR":  "",
+		"NAMESPACE_LISTENER": "root",
+		"LOG_LEVEL":          "warning",
+	})
+
+	cfg, err := env.NewAdapterConfig(&mockLogger{})
+	assert.Nil(t, err)
+	assert.Equal(t, "", cfg.ServiceCmdLine())
+
+	services := cfg.Services()
+	assert.Equal(t, 2, len(services))
+
+	assert.Equal(t, "first", services[0].Name)
+	assert.Equal(t, processorFile1.Name()+" run", services[0].CmdLine)
+	assert.Equal(t, []string{"root/tick", "root/tock"}, services[0].Subscriptions)
+	assert.Equal(t, "info", services[0].LogLevelConsole)
+	assert.Equal(t, "info", services[0].LogLevelRemote)
+	assert.Equal(t, 0, len(services[0].Schedules))
+	assert.NotEmpty(t, services[0].UUID)
+
+	assert.Equal(t, "second", services[1].Name)
+	assert.Equal(t, processorFile2.Name(), services[1].CmdLine)
+	assert.Equal(t, 0, len(services[1].Subscriptions))
+	if assert.Equal(t, 1, len(services[1].Schedules)) {
+		assert.Equal(t, "tick", services[1].Schedules[0].Name)
+		assert.Equal(t, 30*time.Second, services[1].Schedules[0].Every)
+	}
+	assert.Equal(t, "warning", services[1].LogLevelConsole)
+	assert.Equal(t, "debug", services[1].LogLevelRemote)
+	assert.NotEqual(t, services[0].UUID, services[1].UUID)
+	assert.Equal(t, 0, len(cfg.Schedules()))
+}
+
+func TestServicesInvalid(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	processorFile, _ := ioutil.TempFile("", "")
+	defer os.Remove(processorFile.Name())
+
+	cases := map[string]string{
+		`{"name": "first"}`: "can't parse services",
+		`[]`:                "services file doesn't contain any service",
+		`[{"processor": "` + processorFile.Name() + `"}]`:      "service #1: name can't be empty",
+		`[{"name": "first"}]`:                                  "service 'first': processor can't be empty",
+		`[{"name": "first", "processor": "/dummy/processor"}]`: "service 'first': processor stat /dummy/processor",
+		`[{"name": "first", "processor": "` + processorFile.Name() + `", "subscriptions": "/dummy/subscriptions"}]`:                        "service 'first': can't read subscriptions",
+		`[{"name": "first", "processor": "` + processorFile.Name() + `", "schedule": "/dummy/schedule"}]`:                                  "service 'first': can't read schedule",
+		`[{"name": "first", "processor": "` + processorFile.Name() + `"}, {"name": "first", "processor": "` + processorFile.Name() + `"}]`: "service 'first' is defined more than once",
+	}
+
+	for content, expectedErr := range cases {
+		servicesFile, _ := ioutil.TempFile("", "")
+		servicesFile.WriteString(content)
+		servicesFile.Close()
+
+		setEnv(map[string]string{
+			"SERVICES": servicesFile.Name(),
+		})
+
+		_, err := env.NewAdapterConfig(&mockLogger{})
+		os.Remove(servicesFile.Name())
+
+		if assert.NotNil(t, err, content) {
+			assert.Contains(t, err.Error(), expectedErr, content)
+		}
+	}
+}
+
+func TestServicesSchedule(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	processorFile, _ := ioutil.TempFile("", "")
+	defer os.Remove(processorFile.Name())
+
+	servicesFile, _ := ioutil.TempFile("", "")
+	defer os.Remove(servicesFile.Name())
+
+	servicesFile.WriteString(`[{"name": "first", "processor": "` + processorFile.Name() + `"}]`)
+	servicesFile.Close()
+
+	setEnv(map[string]string{
+		"SERVICES": servicesFile.Name(),
+		"SCHEDULE": "/dummy/schedule",
+	})
+
+	_, err := env.NewAdapterConfig(&mockLogger{})
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "SCHEDULE can't be used with SERVICES")
+	}
+}
@@ -0,0 +1,54 @@
+package core
+
+import (
+	"github.com/satori/go.uuid"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+	"time"
+)
+
+const createdAtFormat = "2006-01-02T15:04:05.000Z"
+
+type envelope struct {
+	serviceName     string
+	serviceUUID     string
+	serviceHost     string
+	withCausationID bool
+	getCreatedAt    func() time.Time
+}
+
+func newEnvelope(serviceName, serviceUUID, serviceHost string, withCausationID bool) *envelope {
+	return &envelope{
+		serviceName:     serviceName,
+		serviceUUID:     serviceUUID,
+		serviceHost:     serviceHost,
+		withCausationID: withCausationID,
+		getCreatedAt: func() time.Time {
+			return time.Now().UTC()
+		},
+	}
+}
+
+func (e *envelope) enrich(msg, causationID string) string {
+	msg = setMissing(msg, "service_uuid", e.serviceUUID)
+	msg = setMissing(msg, "service_name", e.serviceName)
+	msg = setMissing(msg, "service_host", e.serviceHost)
+	msg = setMissing(msg, "created_at", e.getCreatedAt().Format(createdAtFormat))
+	msg = setMissing(msg, "message_uuid", uuid.NewV4().String())
+	if e.withCausationID && causationID != "" {
+		msg = setMissing(msg, "causation_id", causationID)
+	}
+	return msg
+}
+
+func setMissing(msg, path, value string) string {
+	if gjson.Get(msg, path).Exists() {
+		return msg
+	}
+
+	result, err := sjson.Set(msg, path, value)
+	if err != nil {
+		return msg
+	}
+	return result
+}
@@ -0,0 +1,110 @@
+package core
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// journalCompactSize is the number of entries a journal has to reach before
+// it is compacted at runtime. It is compacted once less than half of its
+// entries are live.
+const journalCompactSize = 1000
+
+// journal is a file of JSON lines, each adding or removing a message. It is
+// shared by the AckJournal and the DelayQueue, which keep the live messages in
+// memory and rewrite the journal with them when compacting.
+type journal struct {
+	path    string
+	name    string
+	file    *os.File
+	entries int
+}
+
+// openJournal passes the lines of an existing journal to read. Lines read
+// can't parse are skipped. The journal is writable after compact.
+func openJournal(path, name string, read func(line []byte) error) (*journal, error) {
+	j := &journal{path: path, name: name}
+
+	file, err := os.Open(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("can't open %s: %s", name, err)
+	}
+	if err == nil {
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(nil, 16*1024*1024)
+		for scanner.Scan() {
+			// the last entry may be truncated by a crash
+			_ = read(scanner.Bytes())
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("can't read %s: %s", name, err)
+		}
+	}
+	return j, nil
+}
+
+// needsCompaction reports whether the journal should be rewritten with the
+// given number of live entries.
+func (j *journal) needsCompaction(live int) bool {
+	return j.entries >= journalCompactSize && j.entries > 2*live
+}
+
+// compact replaces the journal with the live entries. If that fails, the
+// current file is kept.
+func (j *journal) compact(entries []interface{}) error {
+	tmp, err := os.Create(filepath.Join(filepath.Dir(j.path), "."+filepath.Base(j.path)+".tmp"))
+	if err != nil {
+		return fmt.Errorf("can't compact %s: %s", j.name, err)
+	}
+
+	writer := bufio.NewWriter(tmp)
+	for _, entry := range entries {
+		line, _ := json.Marshal(entry)
+		writer.Write(append(line, '\n'))
+	}
+	err = writer.Flush()
+	if err == nil {
+		err = tmp.Sync()
+	}
+	tmp.Close()
+	if err == nil {
+		err = os.Rename(tmp.Name(), j.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("can't compact %s: %s", j.name, err)
+	}
+
+	file, err := os.OpenFile(j.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("can't open %s: %s", j.name, err)
+	}
+	if j.file != nil {
+		j.file.Close()
+	}
+	j.file = file
+	j.entries = len(entries)
+	return nil
+}
+
+func (j *journal) write(entry interface{}) error {
+	line, _ := json.Marshal(entry)
+	_, err := j.file.Write(append(line, '\n'))
+	if err != nil {
+		return fmt.Errorf("can't write %s: %s", j.name, err)
+	}
+	j.entries++
+	return nil
+}
+
+func (j *journal) close() error {
+	if j.file == nil {
+		return nil
+	}
+	return j.file.Close()
+}
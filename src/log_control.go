@@ -0,0 +1,94 @@
+package core
+
+import (
+	"fmt"
+	"github.com/tidwall/gjson"
+	"sync"
+)
+
+// LogLevelControl changes the log levels at runtime when a message arrives on
+// $NAMESPACE/control/$SERVICE_NAME/$SERVICE_UUID/log_level or on the
+// service-wide $NAMESPACE/control/$SERVICE_NAME/log_level. The payload sets
+// "log_level" for both, "log_level_console" or "log_level_mqtt".
+type LogLevelControl struct {
+	topics []string
+	logger Logger
+
+	mu           sync.Mutex
+	levelConsole LogLevel
+	levelRemote  LogLevel
+}
+
+func NewLogLevelControl(namespace, serviceName, serviceUUID string, levelConsole, levelRemote LogLevel, logger Logger) *LogLevelControl {
+	return &LogLevelControl{
+		topics: []string{
+			fmt.Sprintf("%s/control/%s/%s/log_level", namespace, serviceName, serviceUUID),
+			fmt.Sprintf("%s/control/%s/log_level", namespace, serviceName),
+		},
+		logger:       logger,
+		levelConsole: levelConsole,
+		levelRemote:  levelRemote,
+	}
+}
+
+func (c *LogLevelControl) Topics() []string {
+	return c.topics
+}
+
+// Start subscribes to the control topics. changed is called after the levels
+// were changed, if not nil.
+func (c *LogLevelControl) Start(client MessageBusClient, changed func(levelConsole, levelRemote LogLevel)) error {
+	messages, err := client.Subscribe(c.topics)
+	if err != nil {
+		return fmt.Errorf("can't subscribe to log level control: %s", err)
+	}
+
+	go func() {
+		for msg := range messages {
+			levelConsole, levelRemote, ok := c.handle(msg)
+			if ok && changed != nil {
+				changed(levelConsole, levelRemote)
+			}
+		}
+	}()
+	return nil
+}
+
+func (c *LogLevelControl) handle(msg string) (LogLevel, LogLevel, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	levelConsole, levelRemote := c.levelConsole, c.levelRemote
+	found := false
+	for _, field := range []struct {
+		key     string
+		targets []*LogLevel
+	}{
+		{"log_level", []*LogLevel{&levelConsole, &levelRemote}},
+		{"log_level_console", []*LogLevel{&levelConsole}},
+		{"log_level_mqtt", []*LogLevel{&levelRemote}},
+	} {
+		value := gjson.Get(msg, "payload."+field.key)
+		if !value.Exists() {
+			continue
+		}
+		level, ok := ParseLogLevel(value.String())
+		if !ok {
+			c.logger.Log(LogLevelWarning, fmt.Sprintf("invalid log level control message: unknown level '%s': %s", value.String(), msg))
+			return "", "", false
+		}
+		for _, target := range field.targets {
+			*target = level
+		}
+		found = true
+	}
+	if !found {
+		c.logger.Log(LogLevelWarning, fmt.Sprintf("invalid log level control message: missing log_level: %s", msg))
+		return "", "", false
+	}
+
+	c.levelConsole, c.levelRemote = levelConsole, levelRemote
+	c.logger.SetLevels(levelConsole, levelRemote)
+	c.logger.Log(LogLevelNotice, fmt.Sprintf("Log levels changed: console %s, mqtt %s", levelConsole, levelRemote))
+	return levelConsole, levelRemote, true
+}
@@ -0,0 +1,50 @@
+package core_test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/flaneurtv/samm/core"
+	"testing"
+	"time"
+)
+
+func TestAdapterLogLevelControl(t *testing.T) {
+	bus := NewMockBus()
+	client := NewMockClient(bus)
+
+	outputs := make(chan string)
+	errors := make(chan string)
+	service := NewMockServiceProducer(outputs, errors)
+
+	log := &mockLogger{}
+	control := core.NewLogLevelControl("root", "svc", "id1", core.LogLevelError, core.LogLevelError, log)
+	assert.Equal(t, []string{"root/control/svc/id1/log_level", "root/control/svc/log_level"}, control.Topics())
+
+	adapter := core.NewAdapter(client, client, nil, service, log)
+	adapter.SetLogLevelControl(control, true)
+	_, err := adapter.Start()
+	assert.Nil(t, err)
+
+	go client.Publish("root/control/svc/id1/log_level", `{"topic": "root/control/svc/id1/log_level", "payload": {"log_level": "Debug"}}`)
+	assert.Equal(t, `{"topic":"$samm/log_level","payload":{"log_level_console":"debug","log_level_mqtt":"debug"}}`, <-service.getInput())
+	levelConsole, levelRemote := log.getLevels()
+	assert.Equal(t, core.LogLevelDebug, levelConsole)
+	assert.Equal(t, core.LogLevelDebug, levelRemote)
+
+	go client.Publish("root/control/svc/log_level", `{"topic": "root/control/svc/log_level", "payload": {"log_level_mqtt": "warning"}}`)
+	assert.Equal(t, `{"topic":"$samm/log_level","payload":{"log_level_console":"debug","log_level_mqtt":"warning"}}`, <-service.getInput())
+	levelConsole, levelRemote = log.getLevels()
+	assert.Equal(t, core.LogLevelDebug, levelConsole)
+	assert.Equal(t, core.LogLevelWarning, levelRemote)
+
+	log.clear()
+	client.Publish("root/control/svc/log_level", `{"topic": "root/control/svc/log_level", "payload": {"log_level": "loud"}}`)
+	client.Publish("root/control/svc/log_level", `{"topic": "root/control/svc/log_level", "payload": {}}`)
+	time.Sleep(50 * time.Millisecond)
+
+	assert.Equal(t, []mockLoggerMessage{
+		{level: core.LogLevelWarning, message: `invalid log level control message: unknown level 'loud': {"topic": "root/control/svc/log_level", "payload": {"log_level": "loud"}}`},
+		{level: core.LogLevelWarning, message: `invalid log level control message: missing log_level: {"topic": "root/control/svc/log_level", "payload": {}}`},
+	}, log.getMessages())
+	_, levelRemote = log.getLevels()
+	assert.Equal(t, core.LogLevelWarning, levelRemote)
+}
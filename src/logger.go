@@ -18,6 +18,14 @@ const (
 	LogLevelEmergency LogLevel = "emergency"
 )
 
+type ConsoleFormat string
+
+const (
+	ConsoleFormatText   ConsoleFormat = "text"
+	ConsoleFormatLogfmt ConsoleFormat = "logfmt"
+	ConsoleFormatJSON   ConsoleFormat = "json"
+)
+
 var levels = []LogLevel{
 	LogLevelDebug, LogLevelInfo, LogLevelNotice, LogLevelWarning,
 	LogLevelError, LogLevelCritical, LogLevelAlert, LogLevelEmergency,
@@ -27,7 +35,52 @@ type Logger interface {
 	SetLevels(levelConsole, leverRemote LogLevel)
 	SetClient(client MessageBusClient, namespace, serviceName, serviceUUID, serviceHost string)
 	SetCreatedAtGetter(getCreatedAt func() time.Time)
+	SetConsoleFormat(format ConsoleFormat)
 	Log(level LogLevel, message string)
+	LogEntry(entry LogEntry)
+	AddSink(sink LogSink)
+	SetRemoteLimits(limits LogLimits)
+}
+
+// LogLimits protect the message bus from floods of log messages. Repeated
+// and dropped messages are reported every SummaryInterval.
+type LogLimits struct {
+	// QueueSize > 0 publishes asynchronously, dropping messages while the
+	// queue is full.
+	QueueSize int
+	// Rate > 0 allows Rate messages per second and level with bursts of up
+	// to Burst messages.
+	Rate  float64
+	Burst int
+	// Dedup collapses repeated identical messages.
+	Dedup           bool
+	SummaryInterval time.Duration
+}
+
+// LogEntry is a structured log message. CreatedAt is zero unless the message
+// was created elsewhere, e.g. by the service.
+type LogEntry struct {
+	Level     LogLevel
+	Message   string
+	CreatedAt time.Time
+	Fields    map[string]interface{}
+}
+
+// LogRecord is a log entry with the identity of the logging service, passed
+// to log sinks. CreatedAt is always set.
+type LogRecord struct {
+	LogEntry
+	ServiceName string
+	ServiceUUID string
+	ServiceHost string
+}
+
+// LogSink is a destination of log records in addition to the console and the
+// message bus, e.g. a file or syslog. Records weaker than Level are skipped.
+type LogSink interface {
+	Level() LogLevel
+	Write(record LogRecord) error
+	Close() error
 }
 
 func (level LogLevel) IsWeaker(other LogLevel) bool {
@@ -55,3 +108,11 @@ func ParseLogLevel(level string) (LogLevel, bool) {
 	}
 	return LogLevelDebug, false
 }
+
+func ParseConsoleFormat(format string) (ConsoleFormat, bool) {
+	switch ConsoleFormat(format) {
+	case ConsoleFormatText, ConsoleFormatLogfmt, ConsoleFormatJSON:
+		return ConsoleFormat(format), true
+	}
+	return ConsoleFormatText, false
+}
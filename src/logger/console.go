@@ -0,0 +1,113 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"gitlab.com/flaneurtv/samm/core"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type consoleField struct {
+	key   string
+	value interface{}
+}
+
+// consoleFields returns the fields of the MQTT log envelope followed by the
+// custom fields sorted by key. Custom fields can't override envelope fields.
+func consoleFields(record core.LogRecord) []consoleField {
+	result := make([]consoleField, 0, 6+len(record.Fields))
+	for _, field := range []consoleField{
+		{"service_name", record.ServiceName},
+		{"service_uuid", record.ServiceUUID},
+		{"service_host", record.ServiceHost},
+	} {
+		if field.value != "" {
+			result = append(result, field)
+		}
+	}
+	result = append(result,
+		consoleField{"created_at", record.CreatedAt.UTC().Format(createdAtFormat)},
+		consoleField{"log_level", string(record.Level)},
+		consoleField{"log_message", record.Message},
+	)
+	return append(result, customFields(record.Fields)...)
+}
+
+func customFields(fields map[string]interface{}) []consoleField {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		switch key {
+		case "service_name", "service_uuid", "service_host", "created_at", "log_level", "log_message":
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	result := make([]consoleField, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, consoleField{key, fields[key]})
+	}
+	return result
+}
+
+// formatRecord returns the record as a line in the given format.
+func formatRecord(format core.ConsoleFormat, record core.LogRecord) string {
+	switch format {
+	case core.ConsoleFormatJSON:
+		return formatJSON(consoleFields(record)) + "\n"
+	case core.ConsoleFormatLogfmt:
+		return formatLogfmt(consoleFields(record)) + "\n"
+	}
+
+	line := fmt.Sprintf("%s: %s", record.Level, record.Message)
+	if custom := customFields(record.Fields); len(custom) > 0 {
+		line += " " + formatLogfmt(custom)
+	}
+	return line + "\n"
+}
+
+func formatJSON(fields []consoleField) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, field := range fields {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, _ := json.Marshal(field.key)
+		b.Write(key)
+		b.WriteByte(':')
+		b.WriteString(marshalValue(field.value))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func formatLogfmt(fields []consoleField) string {
+	pairs := make([]string, 0, len(fields))
+	for _, field := range fields {
+		value, ok := field.value.(string)
+		if !ok {
+			value = marshalValue(field.value)
+		}
+		if value == "" || strings.ContainsAny(value, " =\"\\") || strings.IndexFunc(value, isControl) >= 0 {
+			value = strconv.Quote(value)
+		}
+		pairs = append(pairs, field.key+"="+value)
+	}
+	return strings.Join(pairs, " ")
+}
+
+func marshalValue(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(value))
+	}
+	return string(data)
+}
+
+func isControl(r rune) bool {
+	return r < 0x20 || r == 0x7f
+}
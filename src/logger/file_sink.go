@@ -0,0 +1,151 @@
+package logger
+
+import (
+	"fmt"
+	"gitlab.com/flaneurtv/samm/core"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const rotatedFileTimeFormat = "20060102T150405.000000000"
+
+type fileSink struct {
+	path     string
+	level    core.LogLevel
+	format   core.ConsoleFormat
+	maxSize  int64
+	maxAge   time.Duration
+	maxCount int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// NewFileSink appends records to the file at path in the given format. Once
+// the file exceeds maxSize bytes, it's renamed with a timestamp suffix and a
+// new file is started. Rotated files older than maxAge and all but the newest
+// maxCount rotated files are removed. Zero values disable the limits.
+func NewFileSink(path string, level core.LogLevel, format core.ConsoleFormat, maxSize int64, maxAge time.Duration, maxCount int) (core.LogSink, error) {
+	sink := &fileSink{
+		path:     path,
+		level:    level,
+		format:   format,
+		maxSize:  maxSize,
+		maxAge:   maxAge,
+		maxCount: maxCount,
+	}
+
+	err := sink.open()
+	if err != nil {
+		return nil, err
+	}
+	return sink, nil
+}
+
+func (sink *fileSink) Level() core.LogLevel {
+	return sink.level
+}
+
+func (sink *fileSink) Write(record core.LogRecord) error {
+	line := formatRecord(sink.format, record)
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+
+	if sink.file == nil {
+		return fmt.Errorf("log file '%s' is closed", sink.path)
+	}
+
+	if sink.maxSize > 0 && sink.size > 0 && sink.size+int64(len(line)) > sink.maxSize {
+		err := sink.rotate()
+		if err != nil {
+			return err
+		}
+	}
+
+	n, err := sink.file.WriteString(line)
+	sink.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("can't write log file '%s': %s", sink.path, err)
+	}
+	return nil
+}
+
+func (sink *fileSink) Close() error {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+
+	if sink.file == nil {
+		return nil
+	}
+	err := sink.file.Close()
+	sink.file = nil
+	return err
+}
+
+func (sink *fileSink) open() error {
+	file, err := os.OpenFile(sink.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("can't open log file: %s", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("can't open log file: %s", err)
+	}
+
+	sink.file = file
+	sink.size = info.Size()
+	return nil
+}
+
+func (sink *fileSink) rotate() error {
+	sink.file.Close()
+	sink.file = nil
+
+	rotated := fmt.Sprintf("%s.%s", sink.path, time.Now().UTC().Format(rotatedFileTimeFormat))
+	err := os.Rename(sink.path, rotated)
+	if err != nil {
+		return fmt.Errorf("can't rotate log file '%s': %s", sink.path, err)
+	}
+
+	err = sink.open()
+	if err != nil {
+		return err
+	}
+
+	sink.removeRotated()
+	return nil
+}
+
+// removeRotated applies maxAge and maxCount to the rotated files. Their
+// timestamp suffixes sort chronologically.
+func (sink *fileSink) removeRotated() {
+	matches, _ := filepath.Glob(sink.path + ".*")
+
+	var rotated []string
+	for _, match := range matches {
+		suffix := strings.TrimPrefix(match, sink.path+".")
+		if _, err := time.Parse(rotatedFileTimeFormat, suffix); err == nil {
+			rotated = append(rotated, match)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(rotated)))
+
+	for i, path := range rotated {
+		remove := sink.maxCount > 0 && i >= sink.maxCount
+		if !remove && sink.maxAge > 0 {
+			info, err := os.Stat(path)
+			remove = err == nil && time.Since(info.ModTime()) > sink.maxAge
+		}
+		if remove {
+			os.Remove(path)
+		}
+	}
+}
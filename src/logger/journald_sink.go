@@ -0,0 +1,119 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"gitlab.com/flaneurtv/samm/core"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const DefaultJournaldSocket = "/run/systemd/journal/socket"
+
+type journaldSink struct {
+	level core.LogLevel
+
+	mu   sync.Mutex
+	conn *net.UnixConn
+}
+
+// NewJournaldSink sends records to systemd-journald using its native
+// protocol. Custom fields are added as journal fields with upper case names.
+func NewJournaldSink(socket string, level core.LogLevel) (core.LogSink, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("can't connect to journald: %s", err)
+	}
+	return &journaldSink{level: level, conn: conn}, nil
+}
+
+func (sink *journaldSink) Level() core.LogLevel {
+	return sink.level
+}
+
+func (sink *journaldSink) Write(record core.LogRecord) error {
+	var b bytes.Buffer
+	writeJournalField(&b, "MESSAGE", record.Message)
+	writeJournalField(&b, "PRIORITY", strconv.Itoa(severity(record.Level)))
+	writeJournalField(&b, "CREATED_AT", record.CreatedAt.UTC().Format(createdAtFormat))
+	if record.ServiceName != "" {
+		writeJournalField(&b, "SYSLOG_IDENTIFIER", record.ServiceName)
+	}
+	if record.ServiceUUID != "" {
+		writeJournalField(&b, "SERVICE_UUID", record.ServiceUUID)
+	}
+	if record.ServiceHost != "" {
+		writeJournalField(&b, "SERVICE_HOST", record.ServiceHost)
+	}
+	for _, field := range customFields(record.Fields) {
+		name := journalFieldName(field.key)
+		switch name {
+		case "", "MESSAGE", "PRIORITY", "CREATED_AT", "SYSLOG_IDENTIFIER", "SERVICE_UUID", "SERVICE_HOST":
+			continue
+		}
+		value, ok := field.value.(string)
+		if !ok {
+			value = marshalValue(field.value)
+		}
+		writeJournalField(&b, name, value)
+	}
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+
+	if sink.conn == nil {
+		return errors.New("journald connection is closed")
+	}
+	_, err := sink.conn.Write(b.Bytes())
+	if err != nil {
+		return fmt.Errorf("can't write to journald: %s", err)
+	}
+	return nil
+}
+
+func (sink *journaldSink) Close() error {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+
+	if sink.conn == nil {
+		return nil
+	}
+	err := sink.conn.Close()
+	sink.conn = nil
+	return err
+}
+
+// writeJournalField uses the binary form for values with newlines.
+func writeJournalField(b *bytes.Buffer, name, value string) {
+	if !strings.Contains(value, "\n") {
+		b.WriteString(name + "=" + value + "\n")
+		return
+	}
+
+	b.WriteString(name + "\n")
+	binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	b.WriteString(value + "\n")
+}
+
+// journalFieldName returns the field name in upper case with invalid
+// characters replaced by "_". Names can't start with "_" or a digit.
+func journalFieldName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		}
+		return '_'
+	}, key)
+	name = strings.TrimLeft(name, "_0123456789")
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
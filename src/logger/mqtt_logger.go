@@ -5,81 +5,203 @@ import (
 	"github.com/tidwall/sjson"
 	"gitlab.com/flaneurtv/samm/core"
 	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+const createdAtFormat = "2006-01-02T15:04:05.000Z"
+
+type logLevels struct {
+	console core.LogLevel
+	remote  core.LogLevel
+}
+
+// loggerState is a copy of the settings, so that a log call sees them
+// consistently while they're changed concurrently.
+type loggerState struct {
+	client        core.MessageBusClient
+	namespace     string
+	serviceName   string
+	serviceUUID   string
+	serviceHost   string
+	consoleFormat core.ConsoleFormat
+	sinks         []*lockedSink
+	limits        *remoteLimits
+	getCreatedAt  func() time.Time
+}
+
+// mqttLogger can be used concurrently. Levels are swapped atomically, other
+// settings are guarded by mu and writes to the console and to every sink are
+// serialized.
 type mqttLogger struct {
-	output io.Writer
-	error  io.Writer
+	levels atomic.Value // logLevels
+
+	consoleMu sync.Mutex
+	output    io.Writer
+	error     io.Writer
+
+	mu    sync.RWMutex
+	state loggerState
+}
+
+// lockedSink serializes the writes to a sink.
+type lockedSink struct {
+	mu sync.Mutex
+	core.LogSink
+}
 
-	levelConsole core.LogLevel
-	levelRemote  core.LogLevel
-	client       core.MessageBusClient
-	namespace    string
-	serviceName  string
-	serviceUUID  string
-	serviceHost  string
+func (sink *lockedSink) Write(record core.LogRecord) error {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	return sink.LogSink.Write(record)
+}
 
-	getCreatedAt func() time.Time
+func (sink *lockedSink) Close() error {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	return sink.LogSink.Close()
 }
 
 func NewMQTTLogger(output, error io.Writer) core.Logger {
-	return &mqttLogger{output: output, error: error}
+	logger := &mqttLogger{output: output, error: error}
+	logger.levels.Store(logLevels{})
+	return logger
 }
 
 func (logger *mqttLogger) SetLevels(levelConsole, levelRemote core.LogLevel) {
-	logger.levelConsole = levelConsole
-	logger.levelRemote = levelRemote
+	logger.levels.Store(logLevels{console: levelConsole, remote: levelRemote})
 }
 
 func (logger *mqttLogger) SetClient(client core.MessageBusClient, namespace, serviceName, serviceUUID, serviceHost string) {
-	logger.client = client
-	logger.namespace = namespace
-	logger.serviceName = serviceName
-	logger.serviceUUID = serviceUUID
-	logger.serviceHost = serviceHost
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+
+	logger.state.client = client
+	logger.state.namespace = namespace
+	logger.state.serviceName = serviceName
+	logger.state.serviceUUID = serviceUUID
+	logger.state.serviceHost = serviceHost
 }
 
 func (logger *mqttLogger) SetCreatedAtGetter(getCreatedAt func() time.Time) {
-	logger.getCreatedAt = getCreatedAt
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+
+	logger.state.getCreatedAt = getCreatedAt
+}
+
+func (logger *mqttLogger) SetConsoleFormat(format core.ConsoleFormat) {
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+
+	logger.state.consoleFormat = format
+}
+
+func (logger *mqttLogger) AddSink(sink core.LogSink) {
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+
+	// copy on write, states taken before keep their slice
+	sinks := make([]*lockedSink, len(logger.state.sinks), len(logger.state.sinks)+1)
+	copy(sinks, logger.state.sinks)
+	logger.state.sinks = append(sinks, &lockedSink{LogSink: sink})
 }
 
 func (logger *mqttLogger) Log(level core.LogLevel, message string) {
+	logger.LogEntry(core.LogEntry{Level: level, Message: message})
+}
+
+func (logger *mqttLogger) LogEntry(entry core.LogEntry) {
 	var out io.Writer
-	if level.IsWeaker(core.LogLevelError) {
+	if entry.Level.IsWeaker(core.LogLevelError) {
 		out = logger.output
 	} else {
 		out = logger.error
 	}
 
-	if !level.IsWeaker(logger.levelConsole) {
-		_, _ = fmt.Fprintf(out, fmt.Sprintf("%s: %s\n", level, message))
+	levels := logger.levels.Load().(logLevels)
+	state := logger.currentState()
+	createdAt := state.createdAt()
+	record := core.LogRecord{
+		LogEntry:    entry,
+		ServiceName: state.serviceName,
+		ServiceUUID: state.serviceUUID,
+		ServiceHost: state.serviceHost,
+	}
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = createdAt
 	}
 
-	if !level.IsWeaker(logger.levelRemote) && logger.client != nil {
-		topic, jsonMessage := logger.generateDebugMessage(level, message)
-		err := logger.client.Publish(topic, jsonMessage)
+	if !entry.Level.IsWeaker(levels.console) {
+		logger.writeConsole(out, formatRecord(state.consoleFormat, record))
+	}
+
+	for _, sink := range state.sinks {
+		if entry.Level.IsWeaker(sink.Level()) {
+			continue
+		}
+		err := sink.Write(record)
 		if err != nil {
-			_, _ = fmt.Fprintf(out, fmt.Sprintf("error: can't publish a log message: %s\n", jsonMessage))
+			logger.writeConsole(logger.error, fmt.Sprintf("error: can't write a log entry: %s\n", err))
 		}
 	}
+
+	if !entry.Level.IsWeaker(levels.remote) && state.client != nil {
+		logger.publishRemote(state, entry, createdAt)
+	}
 }
 
-func (logger *mqttLogger) generateDebugMessage(level core.LogLevel, message string) (topic string, jsonMessage string) {
-	var createdAt time.Time
-	if logger.getCreatedAt != nil {
-		createdAt = logger.getCreatedAt()
-	} else {
-		createdAt = time.Now().UTC()
+func (logger *mqttLogger) currentState() loggerState {
+	logger.mu.RLock()
+	defer logger.mu.RUnlock()
+	return logger.state
+}
+
+// writeConsole serializes the writes, output and error can be the same writer.
+func (logger *mqttLogger) writeConsole(out io.Writer, line string) {
+	logger.consoleMu.Lock()
+	defer logger.consoleMu.Unlock()
+	_, _ = io.WriteString(out, line)
+}
+
+func (state loggerState) createdAt() time.Time {
+	if state.getCreatedAt != nil {
+		return state.getCreatedAt()
 	}
+	return time.Now().UTC()
+}
 
-	topic = fmt.Sprintf("%s/log/%s/%s/%s", logger.namespace, logger.serviceName, logger.serviceUUID, level)
-	jsonMessage, _ = sjson.Set(jsonMessage, "payload.log_entry.log_message", message)
-	jsonMessage, _ = sjson.Set(jsonMessage, "payload.log_entry.log_level", string(level))
-	jsonMessage, _ = sjson.Set(jsonMessage, "created_at", createdAt.Format("2006-01-02T15:04:05.000Z"))
-	jsonMessage, _ = sjson.Set(jsonMessage, "service_host", logger.serviceHost)
-	jsonMessage, _ = sjson.Set(jsonMessage, "service_uuid", logger.serviceUUID)
-	jsonMessage, _ = sjson.Set(jsonMessage, "service_name", logger.serviceName)
+// generateDebugMessage puts the entry into payload.log_entry. A created_at of
+// the entry is kept there, the envelope's created_at is the time of logging.
+func (state loggerState) generateDebugMessage(entry core.LogEntry, createdAt time.Time) (topic string, jsonMessage string) {
+	topic = fmt.Sprintf("%s/log/%s/%s/%s", state.namespace, state.serviceName, state.serviceUUID, entry.Level)
+	custom := customFields(entry.Fields)
+	for i := len(custom) - 1; i >= 0; i-- {
+		jsonMessage, _ = sjson.Set(jsonMessage, "payload.log_entry."+escapePath(custom[i].key), custom[i].value)
+	}
+	if !entry.CreatedAt.IsZero() {
+		jsonMessage, _ = sjson.Set(jsonMessage, "payload.log_entry.created_at", entry.CreatedAt.UTC().Format(createdAtFormat))
+	}
+	jsonMessage, _ = sjson.Set(jsonMessage, "payload.log_entry.log_message", entry.Message)
+	jsonMessage, _ = sjson.Set(jsonMessage, "payload.log_entry.log_level", string(entry.Level))
+	jsonMessage, _ = sjson.Set(jsonMessage, "created_at", createdAt.Format(createdAtFormat))
+	jsonMessage, _ = sjson.Set(jsonMessage, "service_host", state.serviceHost)
+	jsonMessage, _ = sjson.Set(jsonMessage, "service_uuid", state.serviceUUID)
+	jsonMessage, _ = sjson.Set(jsonMessage, "service_name", state.serviceName)
 	jsonMessage, _ = sjson.Set(jsonMessage, "topic", topic)
 	return topic, jsonMessage
 }
+
+func escapePath(key string) string {
+	var b strings.Builder
+	for _, r := range key {
+		switch r {
+		case '.', '*', '?', '|', '#', '@', '\\':
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -2,10 +2,13 @@ package logger_test
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"github.com/stretchr/testify/assert"
 	"gitlab.com/flaneurtv/samm/core"
 	"gitlab.com/flaneurtv/samm/core/logger"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -51,6 +54,196 @@ func TestMQTTLogger(t *testing.T) {
 	assert.Equal(t, "", errorLines[2])
 }
 
+func TestLogEntry(t *testing.T) {
+	output := bytes.NewBuffer(nil)
+	log := logger.NewMQTTLogger(output, output)
+	client := &mockClient{}
+	log.SetClient(client, "root", "first", "id1", "host.com")
+	log.SetLevels(core.LogLevelWarning, core.LogLevelWarning)
+	log.SetConsoleFormat(core.ConsoleFormatJSON)
+	log.SetCreatedAtGetter(func() time.Time {
+		return time.Date(2018, 10, 9, 10, 11, 12, 345345345, time.UTC)
+	})
+
+	log.LogEntry(core.LogEntry{
+		Level:     core.LogLevelError,
+		Message:   "error A",
+		CreatedAt: time.Date(2018, 10, 9, 10, 11, 10, 0, time.UTC),
+		Fields:    map[string]interface{}{"request_id": "r1", "retry.count": 2, "log_level": "debug"},
+	})
+
+	assert.Equal(t, 1, len(client.messages))
+	assert.Equal(t, `{"topic":"root/log/first/id1/error","service_name":"first","service_uuid":"id1","service_host":"host.com","created_at":"2018-10-09T10:11:12.345Z","payload":{"log_entry":{"log_level":"error","log_message":"error A","created_at":"2018-10-09T10:11:10.000Z","request_id":"r1","retry.count":2}}}`, client.messages[0].message)
+
+	assert.Equal(t, `{"service_name":"first","service_uuid":"id1","service_host":"host.com","created_at":"2018-10-09T10:11:10.000Z","log_level":"error","log_message":"error A","request_id":"r1","retry.count":2}`+"\n", output.String())
+}
+
+func TestLogSinks(t *testing.T) {
+	output := bytes.NewBuffer(nil)
+	log := logger.NewMQTTLogger(output, output)
+	log.SetLevels(core.LogLevelError, core.LogLevelError)
+	log.SetClient(nil, "root", "first", "id1", "host.com")
+	log.SetCreatedAtGetter(func() time.Time {
+		return time.Date(2018, 10, 9, 10, 11, 12, 345345345, time.UTC)
+	})
+
+	info := &mockSink{level: core.LogLevelInfo}
+	errs := &mockSink{level: core.LogLevelError}
+	log.AddSink(info)
+	log.AddSink(errs)
+
+	log.Log(core.LogLevelDebug, "debug A")
+	log.Log(core.LogLevelInfo, "info B")
+	log.Log(core.LogLevelError, "error C")
+
+	assert.Equal(t, []string{"info B", "error C"}, info.messages())
+	assert.Equal(t, []string{"error C"}, errs.messages())
+	assert.Equal(t, "first", info.records[0].ServiceName)
+	assert.Equal(t, time.Date(2018, 10, 9, 10, 11, 12, 345345345, time.UTC), info.records[0].CreatedAt)
+	assert.Equal(t, "error: error C\n", output.String())
+}
+
+type mockSink struct {
+	level   core.LogLevel
+	records []core.LogRecord
+}
+
+func (s *mockSink) Level() core.LogLevel {
+	return s.level
+}
+
+func (s *mockSink) Write(record core.LogRecord) error {
+	s.records = append(s.records, record)
+	return nil
+}
+
+func (s *mockSink) Close() error {
+	return nil
+}
+
+func (s *mockSink) messages() []string {
+	var messages []string
+	for _, record := range s.records {
+		messages = append(messages, record.Message)
+	}
+	return messages
+}
+
+func TestConsoleFormat(t *testing.T) {
+	fields := map[string]interface{}{
+		"request_id": "r 1",
+		"attempt":    2,
+		"log_level":  "debug",
+	}
+
+	tests := []struct {
+		format core.ConsoleFormat
+		output string
+	}{
+		{core.ConsoleFormatText, "warning: warning A\nerror: error B attempt=2 request_id=\"r 1\"\n"},
+		{core.ConsoleFormatLogfmt, "service_name=first service_uuid=id1 service_host=host.com created_at=2018-10-09T10:11:12.345Z log_level=warning log_message=\"warning A\"\n" +
+			"service_name=first service_uuid=id1 service_host=host.com created_at=2018-10-09T10:11:12.345Z log_level=error log_message=\"error B\" attempt=2 request_id=\"r 1\"\n"},
+		{core.ConsoleFormatJSON, `{"service_name":"first","service_uuid":"id1","service_host":"host.com","created_at":"2018-10-09T10:11:12.345Z","log_level":"warning","log_message":"warning A"}` + "\n" +
+			`{"service_name":"first","service_uuid":"id1","service_host":"host.com","created_at":"2018-10-09T10:11:12.345Z","log_level":"error","log_message":"error B","attempt":2,"request_id":"r 1"}` + "\n"},
+	}
+
+	for _, test := range tests {
+		output := bytes.NewBuffer(nil)
+		log := logger.NewMQTTLogger(output, output)
+		log.SetClient(nil, "root", "first", "id1", "host.com")
+		log.SetLevels(core.LogLevelWarning, core.LogLevelWarning)
+		log.SetConsoleFormat(test.format)
+		log.SetCreatedAtGetter(func() time.Time {
+			return time.Date(2018, 10, 9, 10, 11, 12, 345345345, time.UTC)
+		})
+
+		log.Log(core.LogLevelWarning, "warning A")
+		log.LogEntry(core.LogEntry{Level: core.LogLevelError, Message: "error B", Fields: fields})
+		log.LogEntry(core.LogEntry{Level: core.LogLevelInfo, Message: "info C", Fields: fields})
+
+		assert.Equal(t, test.output, output.String(), string(test.format))
+	}
+}
+
+func TestLogFormatDirectives(t *testing.T) {
+	output := bytes.NewBuffer(nil)
+	log := logger.NewMQTTLogger(output, output)
+	log.SetClient(&failingClient{}, "root", "first", "id1", "host.com")
+	log.SetLevels(core.LogLevelError, core.LogLevelError)
+
+	log.Log(core.LogLevelError, "disk 100% full: %s %d")
+
+	lines := strings.Split(output.String(), "\n")
+	assert.Equal(t, 3, len(lines))
+	assert.Equal(t, "error: disk 100% full: %s %d", lines[0])
+	assert.True(t, strings.HasPrefix(lines[1], "error: can't publish a log message: {"))
+	assert.Contains(t, lines[1], `"log_message":"disk 100% full: %s %d"`)
+}
+
+// TestConcurrentLogging should be run with the race detector.
+func TestConcurrentLogging(t *testing.T) {
+	output := &syncBuffer{}
+	log := logger.NewMQTTLogger(output, output)
+	client := &syncClient{}
+	log.SetLevels(core.LogLevelInfo, core.LogLevelInfo)
+	log.SetClient(client, "root", "first", "id1", "host.com")
+	sink := &mockSink{level: core.LogLevelInfo}
+	log.AddSink(sink)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				log.Log(core.LogLevelError, fmt.Sprintf("error %d-%d", i, j))
+			}
+		}(i)
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for j := 0; j < 100; j++ {
+			log.SetLevels(core.LogLevelInfo, core.LogLevelDebug)
+			log.SetConsoleFormat(core.ConsoleFormatLogfmt)
+			log.SetClient(client, "root", "second", "id2", "host.com")
+			log.SetCreatedAtGetter(time.Now)
+		}
+		log.AddSink(&mockSink{level: core.LogLevelError})
+	}()
+	wg.Wait()
+
+	assert.Equal(t, 400, len(sink.messages()))
+	assert.Equal(t, 400, len(client.logMessages()))
+	assert.Equal(t, 400, strings.Count(output.String(), "\n"))
+}
+
+type failingClient struct {
+	mockClient
+}
+
+func (c *failingClient) Publish(topic, message string) error {
+	return errors.New("not connected")
+}
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
 type mockClient struct {
 	messages []mqttMessage
 }
@@ -63,6 +256,10 @@ func (c *mockClient) Subscribe(topics []string) (<-chan string, error) {
 	return nil, nil
 }
 
+func (c *mockClient) Unsubscribe(topics []string) error {
+	return nil
+}
+
 func (c *mockClient) Publish(topic, message string) error {
 	c.messages = append(c.messages, mqttMessage{topic: topic, message: message})
 	return nil
@@ -21,5 +21,17 @@ func (*noopLogger) SetClient(client core.MessageBusClient, namespace, serviceNam
 func (*noopLogger) SetCreatedAtGetter(getCreatedAt func() time.Time) {
 }
 
+func (*noopLogger) SetConsoleFormat(format core.ConsoleFormat) {
+}
+
 func (*noopLogger) Log(level core.LogLevel, message string) {
 }
+
+func (*noopLogger) LogEntry(entry core.LogEntry) {
+}
+
+func (*noopLogger) AddSink(sink core.LogSink) {
+}
+
+func (*noopLogger) SetRemoteLimits(limits core.LogLimits) {
+}
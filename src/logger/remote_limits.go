@@ -0,0 +1,171 @@
+package logger
+
+import (
+	"fmt"
+	"gitlab.com/flaneurtv/samm/core"
+	"sync"
+	"time"
+)
+
+const defaultLogSummaryInterval = 10 * time.Second
+
+type remoteMessage struct {
+	client  core.MessageBusClient
+	level   core.LogLevel
+	topic   string
+	message string
+}
+
+// remoteLimits keeps the state of the limits set by SetRemoteLimits.
+type remoteLimits struct {
+	core.LogLimits
+	rateLimiter *core.RateLimiter
+	queue       chan remoteMessage
+
+	mu          sync.Mutex
+	last        *core.LogEntry
+	repeated    int
+	rateDropped int
+	queueFull   int
+}
+
+// SetRemoteLimits should be called once, it starts the queue worker and the
+// summaries.
+func (logger *mqttLogger) SetRemoteLimits(limits core.LogLimits) {
+	if limits.SummaryInterval <= 0 {
+		limits.SummaryInterval = defaultLogSummaryInterval
+	}
+
+	l := &remoteLimits{LogLimits: limits}
+	if limits.Rate > 0 {
+		// one bucket per level, messages exceeding it are dropped
+		rateLimits := make([]core.RateLimit, 0, 8)
+		for _, level := range []core.LogLevel{
+			core.LogLevelDebug, core.LogLevelInfo, core.LogLevelNotice, core.LogLevelWarning,
+			core.LogLevelError, core.LogLevelCritical, core.LogLevelAlert, core.LogLevelEmergency,
+		} {
+			rateLimits = append(rateLimits, core.RateLimit{Topic: string(level), Rate: limits.Rate, Burst: limits.Burst, Policy: core.RateLimitPolicyDrop})
+		}
+		l.rateLimiter = core.NewRateLimiter(rateLimits, nil)
+	}
+	if limits.QueueSize > 0 {
+		l.queue = make(chan remoteMessage, limits.QueueSize)
+		go func() {
+			for msg := range l.queue {
+				logger.publish(msg)
+			}
+		}()
+	}
+
+	logger.mu.Lock()
+	logger.state.limits = l
+	logger.mu.Unlock()
+
+	go func() {
+		for range time.Tick(limits.SummaryInterval) {
+			logger.publishSummary()
+		}
+	}()
+}
+
+// publishRemote publishes the entry to the message bus, applying the limits.
+func (logger *mqttLogger) publishRemote(state loggerState, entry core.LogEntry, createdAt time.Time) {
+	l := state.limits
+	if l == nil {
+		logger.publish(state.remoteMessage(entry, createdAt))
+		return
+	}
+
+	l.mu.Lock()
+	if l.Dedup && l.last != nil && l.last.Level == entry.Level && l.last.Message == entry.Message {
+		l.repeated++
+		l.mu.Unlock()
+		return
+	}
+	repeated := l.takeRepeated()
+	l.last = &core.LogEntry{Level: entry.Level, Message: entry.Message}
+	allowed := l.rateLimiter == nil || l.rateLimiter.Wait(string(entry.Level))
+	if !allowed {
+		l.rateDropped++
+	}
+	l.mu.Unlock()
+
+	if repeated != nil {
+		logger.enqueue(l, state.remoteMessage(*repeated, createdAt))
+	}
+	if allowed {
+		logger.enqueue(l, state.remoteMessage(entry, createdAt))
+	}
+}
+
+// publishSummary reports pending repetitions and dropped messages.
+func (logger *mqttLogger) publishSummary() {
+	state := logger.currentState()
+	if state.client == nil || state.limits == nil {
+		return
+	}
+
+	l := state.limits
+	l.mu.Lock()
+	entries := make([]core.LogEntry, 0, 3)
+	if repeated := l.takeRepeated(); repeated != nil {
+		entries = append(entries, *repeated)
+		l.last = nil
+	}
+	if l.rateDropped > 0 {
+		entries = append(entries, core.LogEntry{Level: core.LogLevelWarning, Message: fmt.Sprintf("log rate limit exceeded, dropped %d log messages", l.rateDropped)})
+		l.rateDropped = 0
+	}
+	if l.queueFull > 0 {
+		entries = append(entries, core.LogEntry{Level: core.LogLevelWarning, Message: fmt.Sprintf("log queue full, dropped %d log messages", l.queueFull)})
+		l.queueFull = 0
+	}
+	l.mu.Unlock()
+
+	createdAt := state.createdAt()
+	for _, entry := range entries {
+		logger.enqueue(l, state.remoteMessage(entry, createdAt))
+	}
+}
+
+// takeRepeated returns the "repeated" entry of the last message, if any, and
+// resets the counter. The caller holds the lock.
+func (l *remoteLimits) takeRepeated() *core.LogEntry {
+	if l.repeated == 0 {
+		return nil
+	}
+	entry := &core.LogEntry{Level: l.last.Level, Message: fmt.Sprintf("last message repeated %d times", l.repeated)}
+	l.repeated = 0
+	return entry
+}
+
+func (logger *mqttLogger) enqueue(l *remoteLimits, msg remoteMessage) {
+	if l.queue == nil {
+		logger.publish(msg)
+		return
+	}
+
+	select {
+	case l.queue <- msg:
+	default:
+		l.mu.Lock()
+		l.queueFull++
+		l.mu.Unlock()
+	}
+}
+
+func (state loggerState) remoteMessage(entry core.LogEntry, createdAt time.Time) remoteMessage {
+	topic, message := state.generateDebugMessage(entry, createdAt)
+	return remoteMessage{client: state.client, level: entry.Level, topic: topic, message: message}
+}
+
+func (logger *mqttLogger) publish(msg remoteMessage) {
+	err := msg.client.Publish(msg.topic, msg.message)
+	if err != nil {
+		out := logger.error
+		if msg.level.IsWeaker(core.LogLevelError) {
+			out = logger.output
+		}
+		logger.writeConsole(out, fmt.Sprintf("error: can't publish a log message: %s\n", msg.message))
+	}
+}
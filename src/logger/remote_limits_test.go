@@ -0,0 +1,112 @@
+package logger_test
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+	"gitlab.com/flaneurtv/samm/core"
+	"gitlab.com/flaneurtv/samm/core/logger"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRemoteLimitsDedup(t *testing.T) {
+	log := logger.NewMQTTLogger(bytes.NewBuffer(nil), bytes.NewBuffer(nil))
+	client := &syncClient{}
+	log.SetClient(client, "root", "first", "id1", "host.com")
+	log.SetLevels(core.LogLevelError, core.LogLevelWarning)
+	log.SetRemoteLimits(core.LogLimits{Dedup: true, SummaryInterval: time.Hour})
+
+	log.Log(core.LogLevelError, "error A")
+	log.Log(core.LogLevelError, "error A")
+	log.Log(core.LogLevelError, "error A")
+	log.Log(core.LogLevelWarning, "warning B")
+	log.Log(core.LogLevelWarning, "warning B")
+	log.Log(core.LogLevelError, "error A")
+
+	assert.Equal(t, []string{
+		"error: error A",
+		"error: last message repeated 2 times",
+		"warning: warning B",
+		"warning: last message repeated 1 times",
+		"error: error A",
+	}, client.logMessages())
+}
+
+func TestRemoteLimitsRate(t *testing.T) {
+	log := logger.NewMQTTLogger(bytes.NewBuffer(nil), bytes.NewBuffer(nil))
+	client := &syncClient{}
+	log.SetClient(client, "root", "first", "id1", "host.com")
+	log.SetLevels(core.LogLevelError, core.LogLevelWarning)
+	log.SetRemoteLimits(core.LogLimits{Rate: 0.001, Burst: 2, SummaryInterval: 50 * time.Millisecond})
+
+	log.Log(core.LogLevelError, "error A")
+	log.Log(core.LogLevelError, "error B")
+	log.Log(core.LogLevelError, "error C")
+	log.Log(core.LogLevelError, "error D")
+	log.Log(core.LogLevelWarning, "warning E")
+
+	assert.Equal(t, []string{"error: error A", "error: error B", "warning: warning E"}, client.logMessages())
+
+	time.Sleep(80 * time.Millisecond)
+	assert.Equal(t, []string{
+		"error: error A",
+		"error: error B",
+		"warning: warning E",
+		"warning: log rate limit exceeded, dropped 2 log messages",
+	}, client.logMessages())
+}
+
+func TestRemoteLimitsQueue(t *testing.T) {
+	output := bytes.NewBuffer(nil)
+	log := logger.NewMQTTLogger(output, output)
+	client := &syncClient{release: make(chan struct{})}
+	log.SetClient(client, "root", "first", "id1", "host.com")
+	log.SetLevels(core.LogLevelError, core.LogLevelWarning)
+	log.SetRemoteLimits(core.LogLimits{QueueSize: 2, SummaryInterval: 50 * time.Millisecond})
+
+	// the first message blocks the worker, two fit into the queue
+	for _, message := range []string{"error A", "error B", "error C", "error D", "error E"} {
+		log.Log(core.LogLevelError, message)
+		time.Sleep(5 * time.Millisecond)
+	}
+	assert.Equal(t, "error: error A\nerror: error B\nerror: error C\nerror: error D\nerror: error E\n", output.String())
+
+	close(client.release)
+	time.Sleep(80 * time.Millisecond)
+	assert.Equal(t, []string{
+		"error: error A",
+		"error: error B",
+		"error: error C",
+		"warning: log queue full, dropped 2 log messages",
+	}, client.logMessages())
+}
+
+type syncClient struct {
+	mockClient
+	mu      sync.Mutex
+	release chan struct{}
+}
+
+func (c *syncClient) Publish(topic, message string) error {
+	if c.release != nil {
+		<-c.release
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.mockClient.Publish(topic, message)
+}
+
+// logMessages returns "level: message" of the published log messages.
+func (c *syncClient) logMessages() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	result := make([]string, 0, len(c.messages))
+	for _, msg := range c.messages {
+		entry := gjson.Get(msg.message, "payload.log_entry")
+		result = append(result, entry.Get("log_level").String()+": "+entry.Get("log_message").String())
+	}
+	return result
+}
@@ -0,0 +1,48 @@
+package logger
+
+import (
+	"gitlab.com/flaneurtv/samm/core"
+)
+
+// NewSinks creates the log sinks enabled in the configuration.
+func NewSinks(cfg core.Configuration) ([]core.LogSink, error) {
+	var sinks []core.LogSink
+
+	if cfg.LogFile() != "" {
+		level, _ := core.ParseLogLevel(cfg.LogFileLevel())
+		format, _ := core.ParseConsoleFormat(cfg.LogFileFormat())
+		sink, err := NewFileSink(cfg.LogFile(), level, format, cfg.LogFileMaxSize(), cfg.LogFileMaxAge(), cfg.LogFileMaxCount())
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+
+	if cfg.LogSyslog() != "" {
+		level, _ := core.ParseLogLevel(cfg.LogSyslogLevel())
+		sink, err := NewSyslogSink(cfg.LogSyslog(), level, cfg.LogSyslogFacility())
+		if err != nil {
+			closeSinks(sinks)
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+
+	if cfg.LogJournald() {
+		level, _ := core.ParseLogLevel(cfg.LogJournaldLevel())
+		sink, err := NewJournaldSink(DefaultJournaldSocket, level)
+		if err != nil {
+			closeSinks(sinks)
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+
+	return sinks, nil
+}
+
+func closeSinks(sinks []core.LogSink) {
+	for _, sink := range sinks {
+		sink.Close()
+	}
+}
@@ -0,0 +1,191 @@
+package logger_test
+
+import (
+	"bufio"
+	"encoding/binary"
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/flaneurtv/samm/core"
+	"gitlab.com/flaneurtv/samm/core/logger"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testRecord = core.LogRecord{
+	LogEntry: core.LogEntry{
+		Level:     core.LogLevelWarning,
+		Message:   "warning A",
+		CreatedAt: time.Date(2018, 10, 9, 10, 11, 12, 345000000, time.UTC),
+		Fields:    map[string]interface{}{"request_id": `r"1]`, "attempt": 2},
+	},
+	ServiceName: "first",
+	ServiceUUID: "id1",
+	ServiceHost: "host.com",
+}
+
+func TestFileSink(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "samm.log")
+
+	sink, err := logger.NewFileSink(path, core.LogLevelInfo, core.ConsoleFormatJSON, 300, 0, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, core.LogLevelInfo, sink.Level())
+
+	// every record is ~200 bytes, so every write after the first rotates
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, sink.Write(testRecord))
+	}
+	assert.Nil(t, sink.Close())
+
+	content, _ := ioutil.ReadFile(path)
+	assert.Equal(t, `{"service_name":"first","service_uuid":"id1","service_host":"host.com","created_at":"2018-10-09T10:11:12.345Z","log_level":"warning","log_message":"warning A","attempt":2,"request_id":"r\"1]"}`+"\n", string(content))
+
+	rotated, _ := filepath.Glob(path + ".*")
+	assert.Equal(t, 2, len(rotated))
+}
+
+func TestFileSinkError(t *testing.T) {
+	_, err := logger.NewFileSink("/dummy/samm.log", core.LogLevelInfo, core.ConsoleFormatJSON, 0, 0, 0)
+	assert.NotNil(t, err)
+}
+
+func TestSyslogSinkUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	sink, err := logger.NewSyslogSink("udp://"+conn.LocalAddr().String(), core.LogLevelWarning, "local1")
+	assert.Nil(t, err)
+	defer sink.Close()
+
+	assert.Nil(t, sink.Write(testRecord))
+
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, `<140>1 2018-10-09T10:11:12.345000Z host.com first `+strconv.Itoa(os.Getpid())+` - [samm@32473 service_uuid="id1" attempt="2" request_id="r\"1\]"] warning A`, string(buf[:n]))
+}
+
+func TestSyslogSinkTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+
+	sink, err := logger.NewSyslogSink("tcp://"+listener.Addr().String(), core.LogLevelWarning, "user")
+	assert.Nil(t, err)
+	defer sink.Close()
+
+	conn, err := listener.Accept()
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	record := testRecord
+	record.Level = core.LogLevelError
+	record.Fields = nil
+	assert.Nil(t, sink.Write(record))
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	reader := bufio.NewReader(conn)
+	length, err := reader.ReadString(' ')
+	assert.Nil(t, err)
+	n, _ := strconv.Atoi(strings.TrimSpace(length))
+	msg := make([]byte, n)
+	_, err = reader.Read(msg)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(string(msg), "<11>1 2018-10-09T10:11:12.345000Z host.com first "))
+	assert.True(t, strings.HasSuffix(string(msg), ` [samm@32473 service_uuid="id1"] warning A`))
+}
+
+func TestSyslogSinkReconnect(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	address := listener.Addr().String()
+
+	sink, err := logger.NewSyslogSink("tcp://"+address, core.LogLevelWarning, "user")
+	assert.Nil(t, err)
+	defer sink.Close()
+
+	conn, err := listener.Accept()
+	assert.Nil(t, err)
+	conn.Close()
+	listener.Close()
+
+	record := testRecord
+	record.Level = core.LogLevelError
+	for i := 0; i < 10 && err == nil; i++ {
+		time.Sleep(10 * time.Millisecond)
+		err = sink.Write(record)
+	}
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "dropping records for 1s")
+	}
+
+	listener, err = net.Listen("tcp", address)
+	assert.Nil(t, err)
+	defer listener.Close()
+
+	assert.Nil(t, sink.Write(record))
+	listener.(*net.TCPListener).SetDeadline(time.Now().Add(200 * time.Millisecond))
+	_, err = listener.Accept()
+	assert.NotNil(t, err)
+
+	time.Sleep(time.Second)
+	assert.Nil(t, sink.Write(record))
+	listener.(*net.TCPListener).SetDeadline(time.Now().Add(time.Second))
+	conn, err = listener.Accept()
+	if assert.Nil(t, err) {
+		conn.Close()
+	}
+}
+
+func TestSyslogSinkInvalid(t *testing.T) {
+	_, err := logger.NewSyslogSink("http://localhost:514", core.LogLevelWarning, "user")
+	assert.NotNil(t, err)
+	assert.Equal(t, "invalid syslog address 'http://localhost:514': scheme should be one of: udp, tcp, unix", err.Error())
+
+	_, err = logger.NewSyslogSink("udp://localhost:514", core.LogLevelWarning, "local9")
+	assert.NotNil(t, err)
+	assert.Equal(t, "invalid syslog facility 'local9'", err.Error())
+}
+
+func TestJournaldSink(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "socket")
+
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	sink, err := logger.NewJournaldSink(socket, core.LogLevelDebug)
+	assert.Nil(t, err)
+	defer sink.Close()
+
+	record := testRecord
+	record.Message = "line 1\nline 2"
+	record.Fields = map[string]interface{}{"request-id": "r1", "message": "ignored", "_private": true}
+	assert.Nil(t, sink.Write(record))
+
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	assert.Nil(t, err)
+
+	length := make([]byte, 8)
+	binary.LittleEndian.PutUint64(length, uint64(len(record.Message)))
+	assert.Equal(t, "MESSAGE\n"+string(length)+"line 1\nline 2\n"+
+		"PRIORITY=4\n"+
+		"CREATED_AT=2018-10-09T10:11:12.345Z\n"+
+		"SYSLOG_IDENTIFIER=first\n"+
+		"SERVICE_UUID=id1\n"+
+		"SERVICE_HOST=host.com\n"+
+		"PRIVATE=true\n"+
+		"REQUEST_ID=r1\n", string(buf[:n]))
+}
@@ -0,0 +1,243 @@
+package logger
+
+import (
+	"fmt"
+	"gitlab.com/flaneurtv/samm/core"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// structuredDataID is the SD-ID of the custom fields in syslog messages,
+// using the enterprise number reserved for documentation.
+const structuredDataID = "samm@32473"
+
+var syslogFacilities = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+func parseSyslogFacility(facility string) (int, bool) {
+	for i, name := range syslogFacilities {
+		if name == facility {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// severity returns the syslog severity of the level.
+func severity(level core.LogLevel) int {
+	switch level {
+	case core.LogLevelEmergency:
+		return 0
+	case core.LogLevelAlert:
+		return 1
+	case core.LogLevelCritical:
+		return 2
+	case core.LogLevelError:
+		return 3
+	case core.LogLevelWarning:
+		return 4
+	case core.LogLevelNotice:
+		return 5
+	case core.LogLevelInfo:
+		return 6
+	}
+	return 7
+}
+
+// syslogRetryMin and syslogRetryMax limit the interval between attempts to
+// reconnect. Records are dropped meanwhile, so logging doesn't wait for the
+// server.
+const (
+	syslogRetryMin = time.Second
+	syslogRetryMax = time.Minute
+)
+
+type syslogSink struct {
+	network  string
+	address  string
+	level    core.LogLevel
+	facility int
+
+	mu         sync.Mutex
+	conn       net.Conn
+	retryAt    time.Time
+	retryDelay time.Duration
+}
+
+// NewSyslogSink sends RFC 5424 messages to a syslog server. The address is
+// one of udp://host:port, tcp://host:port or unix:///path. TCP uses octet
+// counting framing (RFC 6587).
+func NewSyslogSink(address string, level core.LogLevel, facility string) (core.LogSink, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid syslog address '%s': %s", address, err)
+	}
+
+	facilityCode, ok := parseSyslogFacility(facility)
+	if !ok {
+		return nil, fmt.Errorf("invalid syslog facility '%s'", facility)
+	}
+
+	sink := &syslogSink{level: level, facility: facilityCode}
+	switch u.Scheme {
+	case "udp", "tcp":
+		sink.network, sink.address = u.Scheme, u.Host
+	case "unix":
+		sink.network, sink.address = "unixgram", u.Path
+	default:
+		return nil, fmt.Errorf("invalid syslog address '%s': scheme should be one of: udp, tcp, unix", address)
+	}
+
+	err = sink.connect()
+	if err != nil {
+		return nil, err
+	}
+	return sink, nil
+}
+
+func (sink *syslogSink) Level() core.LogLevel {
+	return sink.level
+}
+
+func (sink *syslogSink) Write(record core.LogRecord) error {
+	msg := sink.format(record)
+	if sink.network == "tcp" {
+		msg = fmt.Sprintf("%d %s", len(msg), msg)
+	}
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+
+	// reconnect once, e.g. after the server restarted
+	for attempt := 0; ; attempt++ {
+		if sink.conn == nil {
+			if time.Now().Before(sink.retryAt) {
+				return nil
+			}
+			err := sink.connect()
+			if err != nil {
+				sink.retryLater()
+				return fmt.Errorf("%s, dropping records for %s", err, sink.retryDelay)
+			}
+			sink.retryDelay = 0
+		}
+
+		_, err := sink.conn.Write([]byte(msg))
+		if err == nil {
+			return nil
+		}
+		sink.conn.Close()
+		sink.conn = nil
+		if attempt > 0 {
+			sink.retryLater()
+			return fmt.Errorf("can't write to syslog: %s, dropping records for %s", err, sink.retryDelay)
+		}
+	}
+}
+
+// retryLater doubles the interval until the next attempt to reconnect.
+func (sink *syslogSink) retryLater() {
+	sink.retryDelay *= 2
+	if sink.retryDelay < syslogRetryMin {
+		sink.retryDelay = syslogRetryMin
+	}
+	if sink.retryDelay > syslogRetryMax {
+		sink.retryDelay = syslogRetryMax
+	}
+	sink.retryAt = time.Now().Add(sink.retryDelay)
+}
+
+func (sink *syslogSink) Close() error {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+
+	if sink.conn == nil {
+		return nil
+	}
+	err := sink.conn.Close()
+	sink.conn = nil
+	return err
+}
+
+func (sink *syslogSink) connect() error {
+	conn, err := net.DialTimeout(sink.network, sink.address, 5*time.Second)
+	if err != nil {
+		return fmt.Errorf("can't connect to syslog: %s", err)
+	}
+	sink.conn = conn
+	return nil
+}
+
+// format returns "<PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID SD MSG".
+func (sink *syslogSink) format(record core.LogRecord) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<%d>1 %s %s %s %d - ",
+		sink.facility*8+severity(record.Level),
+		record.CreatedAt.UTC().Format("2006-01-02T15:04:05.000000Z"),
+		syslogHeaderField(record.ServiceHost, 255),
+		syslogHeaderField(record.ServiceName, 48),
+		os.Getpid())
+
+	custom := customFields(record.Fields)
+	if record.ServiceUUID == "" && len(custom) == 0 {
+		b.WriteString("-")
+	} else {
+		b.WriteString("[" + structuredDataID)
+		if record.ServiceUUID != "" {
+			b.WriteString(` service_uuid="` + syslogParamValue(record.ServiceUUID) + `"`)
+		}
+		for _, field := range custom {
+			value, ok := field.value.(string)
+			if !ok {
+				value = marshalValue(field.value)
+			}
+			b.WriteString(" " + syslogParamName(field.key) + `="` + syslogParamValue(value) + `"`)
+		}
+		b.WriteString("]")
+	}
+
+	b.WriteString(" " + record.Message)
+	return b.String()
+}
+
+// syslogHeaderField returns printable ASCII of at most max characters or the
+// nil value "-".
+func syslogHeaderField(value string, max int) string {
+	value = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return -1
+		}
+		return r
+	}, value)
+	if len(value) > max {
+		value = value[:max]
+	}
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+func syslogParamName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' || r == '=' || r == ']' || r == '"' {
+			return '_'
+		}
+		return r
+	}, name)
+	if len(name) > 32 {
+		name = name[:32]
+	}
+	return name
+}
+
+func syslogParamValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(value)
+}
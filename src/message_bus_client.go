@@ -3,5 +3,23 @@ package core
 type MessageBusClient interface {
 	Connect() error
 	Subscribe(topics []string) (<-chan string, error)
+	Unsubscribe(topics []string) error
 	Publish(topic, message string) error
 }
+
+// RawMessage is a message as received from the message bus, including the
+// topic it was published to.
+type RawMessage struct {
+	Topic    string
+	Payload  []byte
+	QoS      byte
+	Retained bool
+}
+
+// RawMessageBusClient is implemented by clients able to subscribe to and
+// publish messages without touching their payload.
+type RawMessageBusClient interface {
+	MessageBusClient
+	SubscribeRaw(topics []string) (<-chan RawMessage, error)
+	PublishRaw(msg RawMessage) error
+}
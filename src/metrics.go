@@ -0,0 +1,340 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	MetricMessagesReceived  = "samm_messages_received_total"
+	MetricMessagesPublished = "samm_messages_published_total"
+	MetricMessagesDropped   = "samm_messages_dropped_total"
+	MetricInvalidJSON       = "samm_invalid_json_total"
+	MetricMissingTopic      = "samm_missing_topic_total"
+	MetricPublishErrors     = "samm_publish_errors_total"
+	MetricProcessorStarts   = "samm_processor_starts_total"
+	MetricConnectionLost    = "samm_mqtt_connection_lost_total"
+	MetricDelayedMessages   = "samm_delayed_messages"
+	MetricUnackedMessages   = "samm_unacknowledged_messages"
+	MetricQueuedMessages    = "samm_queued_messages"
+	MetricProcessingLatency = "samm_processing_latency_seconds"
+	MetricStartTime         = "samm_start_time_seconds"
+)
+
+const (
+	metricTypeCounter   = "counter"
+	metricTypeGauge     = "gauge"
+	metricTypeHistogram = "histogram"
+
+	metricContentType  = "text/plain; version=0.0.4; charset=utf-8"
+	defaultMetricsPath = "/metrics"
+
+	// maxTopicLabels limits the topic label values, as topics may contain
+	// ids. Further topics are counted as otherTopicLabel.
+	maxTopicLabels  = 100
+	otherTopicLabel = "other"
+)
+
+// Reasons of MetricMessagesDropped.
+const (
+	DropReasonDuplicate   = "duplicate"
+	DropReasonInvalid     = "invalid"
+	DropReasonInvalidJSON = "invalid_json"
+	DropReasonPolicy      = "policy"
+	DropReasonRateLimit   = "rate_limit"
+	DropReasonJournal     = "journal"
+	DropReasonTransform   = "transform"
+	DropReasonLoop        = "loop"
+	DropReasonQueueFull   = "queue_full"
+)
+
+var metricDefinitions = map[string]struct {
+	typ  string
+	help string
+}{
+	MetricMessagesReceived:  {metricTypeCounter, "Messages received per subscription."},
+	MetricMessagesPublished: {metricTypeCounter, "Messages published per topic."},
+	MetricMessagesDropped:   {metricTypeCounter, "Messages dropped per reason."},
+	MetricInvalidJSON:       {metricTypeCounter, "Messages that aren't valid JSON."},
+	MetricMissingTopic:      {metricTypeCounter, "Messages without a topic."},
+	MetricPublishErrors:     {metricTypeCounter, "Messages that couldn't be published."},
+	MetricProcessorStarts:   {metricTypeCounter, "Starts of the service processor."},
+	MetricConnectionLost:    {metricTypeCounter, "Lost connections to the message bus per client."},
+	MetricDelayedMessages:   {metricTypeGauge, "Messages waiting for their publish time."},
+	MetricUnackedMessages:   {metricTypeGauge, "Messages delivered to the service processor and not acknowledged yet."},
+	MetricQueuedMessages:    {metricTypeGauge, "Messages waiting for the service processor to read them."},
+	MetricProcessingLatency: {metricTypeHistogram, "Seconds from receiving a message until publishing the resulting message."},
+	MetricStartTime:         {metricTypeGauge, "Start time of the process since the Unix epoch in seconds."},
+}
+
+// latencyBuckets are the upper bounds of the histogram buckets in seconds.
+var latencyBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type metricSeries struct {
+	labels string
+	value  float64
+	gauge  func() float64
+
+	buckets []uint64
+	count   uint64
+}
+
+type metricsRegistry struct {
+	mu     sync.Mutex
+	series map[string]map[string]*metricSeries
+	topics map[string]bool
+}
+
+// Metrics collects counters, gauges and histograms and writes them in the
+// Prometheus text format. Methods of a nil *Metrics do nothing, so components
+// can be instrumented unconditionally.
+type Metrics struct {
+	registry *metricsRegistry
+	labels   []string
+}
+
+func NewMetrics() *Metrics {
+	m := &Metrics{registry: &metricsRegistry{
+		series: make(map[string]map[string]*metricSeries),
+		topics: make(map[string]bool),
+	}}
+	startTime := float64(time.Now().UnixNano()) / 1e9
+	m.SetGaugeFunc(MetricStartTime, func() float64 { return startTime })
+	return m
+}
+
+// With returns metrics sharing the registry, adding a label to all series.
+func (m *Metrics) With(label, value string) *Metrics {
+	if m == nil {
+		return nil
+	}
+	labels := append(m.labels[:len(m.labels):len(m.labels)], label, value)
+	return &Metrics{registry: m.registry, labels: labels}
+}
+
+// Inc increments a counter. Labels are given as name, value pairs.
+func (m *Metrics) Inc(name string, labels ...string) {
+	if m == nil {
+		return
+	}
+	m.registry.mu.Lock()
+	defer m.registry.mu.Unlock()
+	m.get(name, labels).value++
+}
+
+// Observe adds a value to a histogram.
+func (m *Metrics) Observe(name string, value float64, labels ...string) {
+	if m == nil {
+		return
+	}
+	m.registry.mu.Lock()
+	defer m.registry.mu.Unlock()
+
+	s := m.get(name, labels)
+	if s.buckets == nil {
+		s.buckets = make([]uint64, len(latencyBuckets))
+	}
+	for i, bound := range latencyBuckets {
+		if value <= bound {
+			s.buckets[i]++
+		}
+	}
+	s.value += value
+	s.count++
+}
+
+// TopicLabel returns the topic as label value, or "other" once the maximum
+// number of topics is used.
+func (m *Metrics) TopicLabel(topic string) string {
+	if m == nil {
+		return topic
+	}
+	m.registry.mu.Lock()
+	defer m.registry.mu.Unlock()
+
+	if !m.registry.topics[topic] {
+		if len(m.registry.topics) >= maxTopicLabels {
+			return otherTopicLabel
+		}
+		m.registry.topics[topic] = true
+	}
+	return topic
+}
+
+// SetGaugeFunc sets a gauge whose value is read on every scrape.
+func (m *Metrics) SetGaugeFunc(name string, gauge func() float64, labels ...string) {
+	if m == nil {
+		return
+	}
+	m.registry.mu.Lock()
+	defer m.registry.mu.Unlock()
+	m.get(name, labels).gauge = gauge
+}
+
+// Sum returns the total of a counter over all series matching the labels of m.
+func (m *Metrics) Sum(name string) float64 {
+	if m == nil {
+		return 0
+	}
+	m.registry.mu.Lock()
+	defer m.registry.mu.Unlock()
+
+	prefix := formatLabels(m.labels)
+	var sum float64
+	for labels, s := range m.registry.series[name] {
+		if strings.HasPrefix(labels, prefix) {
+			sum += s.value
+		}
+	}
+	return sum
+}
+
+// get returns the series, creating it if needed. The caller holds the lock.
+func (m *Metrics) get(name string, labels []string) *metricSeries {
+	all := append(m.labels[:len(m.labels):len(m.labels)], labels...)
+	key := formatLabels(all)
+
+	family, ok := m.registry.series[name]
+	if !ok {
+		family = make(map[string]*metricSeries)
+		m.registry.series[name] = family
+	}
+	s, ok := family[key]
+	if !ok {
+		s = &metricSeries{labels: key}
+		family[key] = s
+	}
+	return s
+}
+
+// WriteTo writes all metrics in the Prometheus text format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	var b bytes.Buffer
+	if m != nil {
+		m.write(&b)
+	}
+	return b.WriteTo(w)
+}
+
+func (m *Metrics) write(b *bytes.Buffer) {
+	m.registry.mu.Lock()
+	defer m.registry.mu.Unlock()
+
+	names := make([]string, 0, len(m.registry.series))
+	for name := range m.registry.series {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		definition, ok := metricDefinitions[name]
+		if !ok {
+			definition.typ = metricTypeCounter
+		}
+		if definition.help != "" {
+			fmt.Fprintf(b, "# HELP %s %s\n", name, definition.help)
+		}
+		fmt.Fprintf(b, "# TYPE %s %s\n", name, definition.typ)
+
+		family := m.registry.series[name]
+		keys := make([]string, 0, len(family))
+		for key := range family {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			s := family[key]
+			switch {
+			case definition.typ == metricTypeHistogram:
+				for i, bound := range latencyBuckets {
+					fmt.Fprintf(b, "%s_bucket%s %d\n", name, withLabel(s.labels, "le", formatFloat(bound)), bucketCount(s, i))
+				}
+				fmt.Fprintf(b, "%s_bucket%s %d\n", name, withLabel(s.labels, "le", "+Inf"), s.count)
+				fmt.Fprintf(b, "%s_sum%s %s\n", name, braces(s.labels), formatFloat(s.value))
+				fmt.Fprintf(b, "%s_count%s %d\n", name, braces(s.labels), s.count)
+			case s.gauge != nil:
+				fmt.Fprintf(b, "%s%s %s\n", name, braces(s.labels), formatFloat(s.gauge()))
+			default:
+				fmt.Fprintf(b, "%s%s %s\n", name, braces(s.labels), formatFloat(s.value))
+			}
+		}
+	}
+}
+
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", metricContentType)
+	_, _ = m.WriteTo(w)
+}
+
+// ServeMetrics listens on address and serves the metrics at path in the
+// background. An empty path serves them at /metrics.
+func ServeMetrics(address, path string, metrics *Metrics) error {
+	if path == "" {
+		path = defaultMetricsPath
+	}
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("can't listen for metrics: %s", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(path, metrics)
+	go http.Serve(listener, mux)
+	return nil
+}
+
+func bucketCount(s *metricSeries, i int) uint64 {
+	if s.buckets == nil {
+		return 0
+	}
+	return s.buckets[i]
+}
+
+// formatLabels returns `name1="value1",name2="value2"` of name, value pairs.
+func formatLabels(labels []string) string {
+	var b strings.Builder
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(labels[i] + `="` + escapeLabelValue(labels[i+1]) + `"`)
+	}
+	return b.String()
+}
+
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func withLabel(labels, name, value string) string {
+	label := name + `="` + value + `"`
+	if labels == "" {
+		return "{" + label + "}"
+	}
+	return "{" + labels + "," + label + "}"
+}
+
+func braces(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+func formatFloat(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
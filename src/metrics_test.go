@@ -0,0 +1,194 @@
+package core_test
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+	"gitlab.com/flaneurtv/samm/core"
+	"gitlab.com/flaneurtv/samm/core/logger"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	metrics := core.NewMetrics()
+	first := metrics.With("service", "first")
+	first.Inc(core.MetricMessagesPublished, "topic", "root/tock")
+	first.Inc(core.MetricMessagesPublished, "topic", "root/tock")
+	first.Inc(core.MetricMessagesPublished, "topic", `root/"quoted"`)
+	metrics.With("service", "second").Inc(core.MetricMessagesPublished, "topic", "root/tock")
+	first.Observe(core.MetricProcessingLatency, 0.02)
+	first.Observe(core.MetricProcessingLatency, 3)
+	first.SetGaugeFunc(core.MetricDelayedMessages, func() float64 { return 7 })
+
+	assert.Equal(t, float64(3), first.Sum(core.MetricMessagesPublished))
+	assert.Equal(t, float64(4), metrics.Sum(core.MetricMessagesPublished))
+
+	output := bytes.NewBuffer(nil)
+	metrics.WriteTo(output)
+	lines := strings.Split(output.String(), "\n")
+
+	assert.Contains(t, lines, "# HELP samm_messages_published_total Messages published per topic.")
+	assert.Contains(t, lines, "# TYPE samm_messages_published_total counter")
+	assert.Contains(t, lines, `samm_messages_published_total{service="first",topic="root/tock"} 2`)
+	assert.Contains(t, lines, `samm_messages_published_total{service="first",topic="root/\"quoted\""} 1`)
+	assert.Contains(t, lines, `samm_messages_published_total{service="second",topic="root/tock"} 1`)
+	assert.Contains(t, lines, `samm_delayed_messages{service="first"} 7`)
+	assert.Contains(t, lines, "# TYPE samm_processing_latency_seconds histogram")
+	assert.Contains(t, lines, `samm_processing_latency_seconds_bucket{service="first",le="0.01"} 0`)
+	assert.Contains(t, lines, `samm_processing_latency_seconds_bucket{service="first",le="0.025"} 1`)
+	assert.Contains(t, lines, `samm_processing_latency_seconds_bucket{service="first",le="5"} 2`)
+	assert.Contains(t, lines, `samm_processing_latency_seconds_bucket{service="first",le="+Inf"} 2`)
+	assert.Contains(t, lines, `samm_processing_latency_seconds_sum{service="first"} 3.02`)
+	assert.Contains(t, lines, `samm_processing_latency_seconds_count{service="first"} 2`)
+	assert.True(t, strings.HasPrefix(output.String(), "# HELP samm_delayed_messages "))
+}
+
+func TestMetricsNil(t *testing.T) {
+	var metrics *core.Metrics
+	metrics.Inc(core.MetricInvalidJSON)
+	metrics.With("service", "first").Observe(core.MetricProcessingLatency, 1)
+	assert.Equal(t, float64(0), metrics.Sum(core.MetricInvalidJSON))
+}
+
+func TestMetricsHTTP(t *testing.T) {
+	metrics := core.NewMetrics()
+	metrics.Inc(core.MetricInvalidJSON)
+
+	recorder := httptest.NewRecorder()
+	metrics.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", recorder.Header().Get("Content-Type"))
+	assert.Contains(t, recorder.Body.String(), "\nsamm_invalid_json_total 1\n")
+	assert.Contains(t, recorder.Body.String(), "\nsamm_start_time_seconds ")
+}
+
+func TestMetricsTopicLabel(t *testing.T) {
+	metrics := core.NewMetrics()
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, fmt.Sprintf("root/%d", i), metrics.TopicLabel(fmt.Sprintf("root/%d", i)))
+	}
+	assert.Equal(t, "root/0", metrics.TopicLabel("root/0"))
+	assert.Equal(t, "other", metrics.TopicLabel("root/100"))
+
+	var none *core.Metrics
+	assert.Equal(t, "root/100", none.TopicLabel("root/100"))
+}
+
+func TestAdapterMetrics(t *testing.T) {
+	bus := NewMockBus()
+	client := NewMockClient(bus)
+
+	service := NewMockService(func(msg string) string {
+		switch gjson.Get(msg, "payload").String() {
+		case "invalid":
+			return `{"topic": "root/tock"`
+		case "missing":
+			return `{"payload": "missing"}`
+		}
+		return `{"topic": "root/tock"}`
+	})
+
+	metrics := core.NewMetrics()
+	adapter := core.NewAdapter(client, client, []string{"root/tick", "root/tack/+"}, service, &mockLogger{})
+	adapter.SetMetrics(metrics.With("service", "first"))
+	done, err := adapter.Start()
+	assert.Nil(t, err)
+
+	responses, err := client.Subscribe([]string{"root/tock"})
+	assert.Nil(t, err)
+
+	go client.Publish("root/tick", `{"topic": "root/tick", "payload": "a"}`)
+	<-responses
+	client.Publish("root/tack/1", `{"topic": "root/tack/1", "payload": "invalid"}`)
+	client.Publish("root/tick", `{"topic": "root/tick", "payload": "missing"}`)
+	client.Publish("root/tick", `{"topic": "root/tick", "payload": "stop"}`)
+	<-done
+
+	output := bytes.NewBuffer(nil)
+	metrics.WriteTo(output)
+	lines := strings.Split(output.String(), "\n")
+
+	assert.Contains(t, lines, `samm_messages_received_total{service="first",subscription="root/tick"} 3`)
+	assert.Contains(t, lines, `samm_messages_received_total{service="first",subscription="root/tack/+"} 1`)
+	assert.Contains(t, lines, `samm_messages_published_total{service="first",topic="root/tock"} 1`)
+	assert.Contains(t, lines, `samm_invalid_json_total{service="first"} 1`)
+	assert.Contains(t, lines, `samm_missing_topic_total{service="first"} 1`)
+	assert.Contains(t, lines, `samm_processor_starts_total{service="first"} 1`)
+	assert.Contains(t, lines, `samm_delayed_messages{service="first"} 0`)
+	assert.Contains(t, output.String(), "\nsamm_queued_messages{service=\"first\"} ")
+	assert.Contains(t, lines, `samm_processing_latency_seconds_count{service="first"} 1`)
+}
+
+func TestAdapterLatencyPending(t *testing.T) {
+	bus := NewMockBus()
+	client := NewMockClient(bus)
+	output := make(chan string)
+	service := NewMockServiceProducer(output, make(chan string))
+
+	metrics := core.NewMetrics()
+	adapter := core.NewAdapter(client, client, []string{"root/tick"}, service, &mockLogger{})
+	adapter.SetMetrics(metrics)
+	done, err := adapter.Start()
+	assert.Nil(t, err)
+
+	responses, err := client.Subscribe([]string{"root/tock"})
+	assert.Nil(t, err)
+
+	go client.Publish("root/tick", `{"topic": "root/tick", "payload": "a"}`)
+	<-service.getInput()
+	go client.Publish("root/tick", `{"topic": "root/tick", "payload": "b"}`)
+	<-service.getInput()
+
+	go func() { output <- `{"topic": "root/tock"}` }()
+	<-responses
+
+	scraped := bytes.NewBuffer(nil)
+	metrics.WriteTo(scraped)
+	assert.NotContains(t, scraped.String(), "samm_processing_latency_seconds")
+
+	go client.Publish("root/tick", `{"topic": "root/tick", "payload": "c"}`)
+	<-service.getInput()
+
+	go func() { output <- `{"topic": "root/tock"}` }()
+	<-responses
+
+	scraped.Reset()
+	metrics.WriteTo(scraped)
+	assert.Contains(t, strings.Split(scraped.String(), "\n"), "samm_processing_latency_seconds_count 1")
+
+	close(output)
+	<-done
+}
+
+func TestBridgeMetrics(t *testing.T) {
+	bus := NewMockBus()
+	client := NewMockClient(bus)
+
+	metrics := core.NewMetrics()
+	bridge := core.NewBridge(client, client, "tick", "tack", []string{"tick/#"}, logger.NewNoOpLogger())
+	bridge.SetMetrics(metrics)
+	done, err := bridge.Start()
+	assert.Nil(t, err)
+
+	client.Publish("tick/first", `{"topic": "tick/first", "payload": "a"}`)
+	client.Publish("tick/first", `{"topic": "tick/first"`)
+	client.Publish("tick/first", `{"payload": "b"}`)
+
+	time.Sleep(100 * time.Millisecond)
+	bus.close()
+	<-done
+
+	output := bytes.NewBuffer(nil)
+	metrics.WriteTo(output)
+	lines := strings.Split(output.String(), "\n")
+
+	assert.Contains(t, lines, `samm_messages_received_total{subscription="tick/#"} 3`)
+	assert.Contains(t, lines, `samm_messages_published_total{topic="tack/first"} 1`)
+	assert.Contains(t, lines, `samm_invalid_json_total 1`)
+	assert.Contains(t, lines, `samm_missing_topic_total 1`)
+	assert.Contains(t, lines, `samm_processing_latency_seconds_count 1`)
+}
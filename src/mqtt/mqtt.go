@@ -4,15 +4,73 @@ import (
 	"fmt"
 	"github.com/eclipse/paho.mqtt.golang"
 	"gitlab.com/flaneurtv/samm/core"
+	"sync"
 )
 
 type mqttClient struct {
-	client           mqtt.Client
-	subscribedTopics [][]string
-	inputMessages    []chan<- string
+	client mqtt.Client
+
+	mu            sync.Mutex
+	subscriptions []*subscription
+}
+
+type subscription struct {
+	topics  []string
+	qos     byte
+	handler mqtt.MessageHandler
+
+	// mu guards closing the messages channel against handlers sending to it.
+	mu      sync.Mutex
+	closed  bool
+	sending int
+	closing chan struct{}
+	closeFn func()
+}
+
+func newSubscription(topics []string, qos byte, closeFn func()) *subscription {
+	return &subscription{topics: topics, qos: qos, closing: make(chan struct{}), closeFn: closeFn}
+}
+
+// deliver calls send unless the subscription is closed. send must return once
+// closing is closed.
+func (s *subscription) deliver(send func(closing <-chan struct{})) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.sending++
+	s.mu.Unlock()
+
+	send(s.closing)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sending--
+	if s.closed && s.sending == 0 {
+		s.closeFn()
+	}
+}
+
+// close closes the messages channel once no handler is sending to it.
+func (s *subscription) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	close(s.closing)
+	if s.sending == 0 {
+		s.closeFn()
+	}
 }
 
-func NewMQTTClient(busURL, clientID string, credentials core.Credentials, logger core.Logger, onConnectionLost func(err error)) core.MessageBusClient {
+// rawQoS is the maximum QoS of raw subscriptions, so that messages are
+// received with the QoS they were published with.
+const rawQoS = 2
+
+func NewMQTTClient(busURL, clientID string, credentials core.Credentials, logger core.Logger, onConnectionLost func(err error)) core.RawMessageBusClient {
 	var client *mqttClient
 
 	opts := mqtt.NewClientOptions()
@@ -23,7 +81,7 @@ func NewMQTTClient(busURL, clientID string, credentials core.Credentials, logger
 	opts.OnConnect = func(cl mqtt.Client) {
 		logger.Log(core.LogLevelInfo, fmt.Sprintf("MQTT client connected to %s", busURL))
 
-		err := client.subscribe()
+		err := client.resubscribe()
 		if err != nil {
 			logger.Log(core.LogLevelError, fmt.Sprintf("Can't re-subscribe: %s", err))
 		}
@@ -56,33 +114,129 @@ func (m *mqttClient) Publish(topic, message string) error {
 	return token.Error()
 }
 
+func (m *mqttClient) PublishRaw(msg core.RawMessage) error {
+	token := m.client.Publish(msg.Topic, msg.QoS, msg.Retained, msg.Payload)
+	token.Wait()
+	return token.Error()
+}
+
 func (m *mqttClient) Subscribe(topics []string) (<-chan string, error) {
 	messages := make(chan string)
-	m.inputMessages = append(m.inputMessages, messages)
-	m.subscribedTopics = append(m.subscribedTopics, topics)
+	sub := newSubscription(topics, 0, func() { close(messages) })
+	sub.handler = func(cl mqtt.Client, msg mqtt.Message) {
+		sub.deliver(func(closing <-chan struct{}) {
+			select {
+			case messages <- string(msg.Payload()):
+			case <-closing:
+			}
+		})
+	}
+	err := m.add(sub)
+	return messages, err
+}
 
-	err := m.subscribe()
+func (m *mqttClient) SubscribeRaw(topics []string) (<-chan core.RawMessage, error) {
+	messages := make(chan core.RawMessage)
+	sub := newSubscription(topics, rawQoS, func() { close(messages) })
+	sub.handler = func(cl mqtt.Client, msg mqtt.Message) {
+		sub.deliver(func(closing <-chan struct{}) {
+			select {
+			case messages <- core.RawMessage{
+				Topic:    msg.Topic(),
+				Payload:  msg.Payload(),
+				QoS:      msg.Qos(),
+				Retained: msg.Retained(),
+			}:
+			case <-closing:
+			}
+		})
+	}
+	err := m.add(sub)
 	return messages, err
 }
 
-func (m *mqttClient) subscribe() error {
-	if len(m.subscribedTopics) == 0 {
-		return nil
+// add subscribes and keeps the subscription for resubscribing. If
+// subscribing fails, the subscription is removed and its channel closed.
+func (m *mqttClient) add(sub *subscription) error {
+	m.mu.Lock()
+	m.subscriptions = append(m.subscriptions, sub)
+	m.mu.Unlock()
+
+	err := m.subscribe(sub.topics, sub.qos, sub.handler)
+	if err != nil {
+		m.remove(sub)
+		sub.close()
 	}
+	return err
+}
+
+func (m *mqttClient) remove(sub *subscription) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	for i, topics := range m.subscribedTopics {
-		topicsMap := make(map[string]byte, len(topics))
-		for _, topic := range topics {
-			topicsMap[topic] = 0
+	for i, other := range m.subscriptions {
+		if other == sub {
+			m.subscriptions = append(m.subscriptions[:i], m.subscriptions[i+1:]...)
+			return
 		}
+	}
+}
 
-		m.client.Unsubscribe(topics...)
+// Unsubscribe removes the topics from the subscriptions. The channels of
+// subscriptions without remaining topics are closed.
+func (m *mqttClient) Unsubscribe(topics []string) error {
+	removed := make(map[string]bool, len(topics))
+	for _, topic := range topics {
+		removed[topic] = true
+	}
 
-		token := m.client.SubscribeMultiple(topicsMap, func(cl mqtt.Client, msg mqtt.Message) {
-			m.inputMessages[i] <- string(msg.Payload())
-		})
-		token.Wait()
-		err := token.Error()
+	var closed []*subscription
+	m.mu.Lock()
+	subscriptions := m.subscriptions[:0]
+	for _, sub := range m.subscriptions {
+		var remaining []string
+		for _, topic := range sub.topics {
+			if !removed[topic] {
+				remaining = append(remaining, topic)
+			}
+		}
+		if len(remaining) > 0 {
+			sub.topics = remaining
+			subscriptions = append(subscriptions, sub)
+		} else {
+			closed = append(closed, sub)
+		}
+	}
+	m.subscriptions = subscriptions
+	m.mu.Unlock()
+
+	token := m.client.Unsubscribe(topics...)
+	token.Wait()
+
+	for _, sub := range closed {
+		sub.close()
+	}
+	return token.Error()
+}
+
+func (m *mqttClient) resubscribe() error {
+	type resubscription struct {
+		topics  []string
+		qos     byte
+		handler mqtt.MessageHandler
+	}
+
+	m.mu.Lock()
+	subscriptions := make([]resubscription, 0, len(m.subscriptions))
+	for _, sub := range m.subscriptions {
+		subscriptions = append(subscriptions, resubscription{sub.topics, sub.qos, sub.handler})
+	}
+	m.mu.Unlock()
+
+	for _, sub := range subscriptions {
+		m.client.Unsubscribe(sub.topics...)
+
+		err := m.subscribe(sub.topics, sub.qos, sub.handler)
 		if err != nil {
 			return err
 		}
@@ -90,3 +244,14 @@ func (m *mqttClient) subscribe() error {
 
 	return nil
 }
+
+func (m *mqttClient) subscribe(topics []string, qos byte, handler mqtt.MessageHandler) error {
+	topicsMap := make(map[string]byte, len(topics))
+	for _, topic := range topics {
+		topicsMap[topic] = qos
+	}
+
+	token := m.client.SubscribeMultiple(topicsMap, handler)
+	token.Wait()
+	return token.Error()
+}
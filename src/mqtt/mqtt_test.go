@@ -59,6 +59,73 @@ func TestClients(t *testing.T) {
 	assert.Equal(t, "012", msg33)
 }
 
+func TestUnsubscribe(t *testing.T) {
+	mqttURL := "tcp://:15355"
+	srv := startMockMQTTServer(t, mqttURL, "")
+	defer closeMockMQTTServer(t, srv)
+
+	client1 := mqtt.NewMQTTClient(mqttURL, "client1", core.Credentials{}, logger.NewNoOpLogger(), nil)
+	err := client1.Connect()
+	assert.Nil(t, err)
+
+	client2 := mqtt.NewMQTTClient(mqttURL, "client2", core.Credentials{}, logger.NewNoOpLogger(), nil)
+	err = client2.Connect()
+	assert.Nil(t, err)
+
+	messages2, err := client2.Subscribe([]string{"test", "work"})
+	assert.Nil(t, err)
+
+	messages3, err := client2.Subscribe([]string{"job"})
+	assert.Nil(t, err)
+
+	err = client2.Unsubscribe([]string{"test", "job"})
+	assert.Nil(t, err)
+
+	go func() {
+		client1.Publish("test", "123")
+		client1.Publish("job", "456")
+		client1.Publish("work", "789")
+	}()
+
+	msg21 := <-messages2
+	assert.Equal(t, "789", msg21)
+
+	_, ok := <-messages3
+	assert.False(t, ok)
+}
+
+func TestSubscribeError(t *testing.T) {
+	mqttURL := "tcp://:15355"
+	srv := startMockMQTTServer(t, mqttURL, "")
+	defer closeMockMQTTServer(t, srv)
+
+	client1 := mqtt.NewMQTTClient(mqttURL, "client1", core.Credentials{}, logger.NewNoOpLogger(), nil)
+	err := client1.Connect()
+	assert.Nil(t, err)
+
+	client2 := mqtt.NewMQTTClient(mqttURL, "client2", core.Credentials{}, logger.NewNoOpLogger(), nil)
+	failed, err := client2.Subscribe([]string{"test"})
+	assert.NotNil(t, err)
+
+	_, ok := <-failed
+	assert.False(t, ok)
+
+	err = client2.Connect()
+	assert.Nil(t, err)
+
+	messages2, err := client2.Subscribe([]string{"test"})
+	assert.Nil(t, err)
+
+	go client1.Publish("test", "123")
+
+	select {
+	case msg := <-messages2:
+		assert.Equal(t, "123", msg)
+	case <-time.After(time.Second):
+		t.Error("message not received")
+	}
+}
+
 func TestCredentials(t *testing.T) {
 	auth.Register("test_auth", &testAuthenticator{})
 	defer auth.Unregister("test_auth")
@@ -169,6 +236,34 @@ func TestReconnect(t *testing.T) {
 	assert.Equal(t, "777", msg34)
 }
 
+func TestRawMessages(t *testing.T) {
+	mqttURL := "tcp://:15355"
+	srv := startMockMQTTServer(t, mqttURL, "")
+	defer closeMockMQTTServer(t, srv)
+
+	client1 := mqtt.NewMQTTClient(mqttURL, "client1", core.Credentials{}, logger.NewNoOpLogger(), nil)
+	err := client1.Connect()
+	assert.Nil(t, err)
+
+	client2 := mqtt.NewMQTTClient(mqttURL, "client2", core.Credentials{}, logger.NewNoOpLogger(), nil)
+	err = client2.Connect()
+	assert.Nil(t, err)
+
+	messages, err := client2.SubscribeRaw([]string{"test/+"})
+	assert.Nil(t, err)
+
+	go func() {
+		client1.PublishRaw(core.RawMessage{Topic: "test/first", Payload: []byte{0x00, 0xff}, QoS: 1})
+		client1.Publish("test/second", "123")
+	}()
+
+	msg1 := <-messages
+	msg2 := <-messages
+
+	assert.Equal(t, core.RawMessage{Topic: "test/first", Payload: []byte{0x00, 0xff}, QoS: 1}, msg1)
+	assert.Equal(t, core.RawMessage{Topic: "test/second", Payload: []byte("123"), QoS: 0}, msg2)
+}
+
 func startMockMQTTServer(t *testing.T, mqttURL, authenticator string) *service.Server {
 	time.Sleep(500 * time.Millisecond)
 	srv := &service.Server{}
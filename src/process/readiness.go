@@ -0,0 +1,51 @@
+package process
+
+import (
+	"fmt"
+	"gitlab.com/flaneurtv/samm/core"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	ReadinessLine       = "line"
+	readinessFilePrefix = "file:"
+	readinessTCPPrefix  = "tcp:"
+)
+
+type fileProbe struct {
+	path string
+}
+
+type tcpProbe struct {
+	address string
+}
+
+func NewReadinessProbe(readiness string) (core.ReadinessProbe, error) {
+	switch {
+	case readiness == ReadinessLine:
+		return nil, nil
+	case strings.HasPrefix(readiness, readinessFilePrefix) && len(readiness) > len(readinessFilePrefix):
+		return &fileProbe{path: strings.TrimPrefix(readiness, readinessFilePrefix)}, nil
+	case strings.HasPrefix(readiness, readinessTCPPrefix) && len(readiness) > len(readinessTCPPrefix):
+		return &tcpProbe{address: strings.TrimPrefix(readiness, readinessTCPPrefix)}, nil
+	default:
+		return nil, fmt.Errorf("unknown readiness probe '%s', expected one of: line, file:<path>, tcp:<address>", readiness)
+	}
+}
+
+func (p *fileProbe) IsReady() bool {
+	_, err := os.Stat(p.path)
+	return err == nil
+}
+
+func (p *tcpProbe) IsReady() bool {
+	conn, err := net.DialTimeout("tcp", p.address, time.Second)
+	if err != nil {
+		return false
+	}
+	_ = conn.Close()
+	return true
+}
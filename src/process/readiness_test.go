@@ -0,0 +1,52 @@
+package process_test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/flaneurtv/samm/core/process"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLineReadinessProbe(t *testing.T) {
+	probe, err := process.NewReadinessProbe("line")
+	assert.Nil(t, err)
+	assert.Nil(t, probe)
+}
+
+func TestFileReadinessProbe(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "ready")
+	probe, err := process.NewReadinessProbe("file:" + path)
+	assert.Nil(t, err)
+	assert.False(t, probe.IsReady())
+
+	_ = ioutil.WriteFile(path, nil, 0644)
+	assert.True(t, probe.IsReady())
+}
+
+func TestTCPReadinessProbe(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	address := listener.Addr().String()
+
+	probe, err := process.NewReadinessProbe("tcp:" + address)
+	assert.Nil(t, err)
+	assert.True(t, probe.IsReady())
+
+	_ = listener.Close()
+	assert.False(t, probe.IsReady())
+}
+
+func TestUnknownReadinessProbe(t *testing.T) {
+	_, err := process.NewReadinessProbe("http://localhost")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "unknown readiness probe")
+
+	_, err = process.NewReadinessProbe("file:")
+	assert.NotNil(t, err)
+}
@@ -8,8 +8,13 @@ import (
 	"os"
 	"os/exec"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 )
 
+const killTimeout = 5 * time.Second
+
 type service struct {
 	name               string
 	uuid               string
@@ -17,10 +22,16 @@ type service struct {
 	namespaceListener  string
 	namespacePublisher string
 	cmdLine            string
+	watchdogTimeout    time.Duration
 	logger             core.Logger
+
+	watchdog *watchdog
+
+	mu  sync.Mutex
+	pid int
 }
 
-func NewService(name, uuid, host, namespaceListener, namespacePublisher, cmdLine string, logger core.Logger) core.Service {
+func NewService(name, uuid, host, namespaceListener, namespacePublisher, cmdLine string, watchdogTimeout time.Duration, logger core.Logger) core.Service {
 	return &service{
 		name:               name,
 		uuid:               uuid,
@@ -28,6 +39,7 @@ func NewService(name, uuid, host, namespaceListener, namespacePublisher, cmdLine
 		namespaceListener:  namespaceListener,
 		namespacePublisher: namespacePublisher,
 		cmdLine:            cmdLine,
+		watchdogTimeout:    watchdogTimeout,
 		logger:             logger,
 	}
 }
@@ -62,29 +74,98 @@ func (sp *service) Start(input <-chan string) (output <-chan string, errors <-ch
 	if err != nil {
 		return nil, nil, fmt.Errorf("can't start command: %s", err)
 	}
+	sp.mu.Lock()
+	sp.pid = cmd.Process.Pid
+	sp.mu.Unlock()
+
+	if sp.watchdogTimeout > 0 {
+		sp.watchdog = newWatchdog(sp.watchdogTimeout)
+	}
 
+	var readers sync.WaitGroup
+	readers.Add(2)
 	if input != nil {
 		sp.startWriteTo(stdin, input)
 	}
-	output = sp.startReadFrom(stdout)
-	errors = sp.startReadFrom(stderr)
+	output = sp.startReadFrom(stdout, &readers, sp.watchdog)
+	errors = sp.startReadFrom(stderr, &readers, nil)
+
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+
+		readers.Wait()
+		_ = cmd.Wait()
+	}()
+
+	if sp.watchdog != nil {
+		sp.startWatchdog(cmd, exited)
+	}
+
 	return output, errors, nil
 }
 
+// PID returns the process id of the processor, 0 before it's started.
+func (sp *service) PID() int {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	return sp.pid
+}
+
+func (sp *service) startWatchdog(cmd *exec.Cmd, exited <-chan struct{}) {
+	go func() {
+		ticker := time.NewTicker(sp.watchdog.checkInterval())
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-exited:
+				return
+			case now := <-ticker.C:
+				if sp.watchdog.expired(now) {
+					sp.logger.Log(core.LogLevelCritical, fmt.Sprintf("service processor unresponsive for %s, terminating", sp.watchdogTimeout))
+					sp.terminate(cmd, exited)
+					return
+				}
+			}
+		}
+	}()
+}
+
+func (sp *service) terminate(cmd *exec.Cmd, exited <-chan struct{}) {
+	err := cmd.Process.Signal(syscall.SIGTERM)
+	if err != nil {
+		sp.logger.Log(core.LogLevelError, fmt.Sprintf("can't terminate service processor: %s", err))
+	}
+
+	select {
+	case <-exited:
+	case <-time.After(killTimeout):
+		sp.logger.Log(core.LogLevelCritical, fmt.Sprintf("service processor still running after %s, killing", killTimeout))
+		err := cmd.Process.Kill()
+		if err != nil {
+			sp.logger.Log(core.LogLevelError, fmt.Sprintf("can't kill service processor: %s", err))
+		}
+	}
+}
+
 func (sp *service) startWriteTo(writer io.WriteCloser, input <-chan string) {
 	go func() {
 		for line := range input {
 			_, err := writer.Write([]byte(line + "\n"))
 			if err != nil {
 				sp.logger.Log(core.LogLevelError, fmt.Sprintf("can't write to std stream: %s", err))
+			} else if sp.watchdog != nil {
+				sp.watchdog.inputWritten(time.Now())
 			}
 		}
 	}()
 }
 
-func (sp *service) startReadFrom(reader io.ReadCloser) <-chan string {
+func (sp *service) startReadFrom(reader io.ReadCloser, readers *sync.WaitGroup, watchdog *watchdog) <-chan string {
 	result := make(chan string)
 	go func() {
+		defer readers.Done()
 		defer close(result)
 
 		reader := bufio.NewReader(reader)
@@ -92,6 +173,9 @@ func (sp *service) startReadFrom(reader io.ReadCloser) <-chan string {
 			line, err := reader.ReadString('\n')
 			if err == nil || (err == io.EOF && line != "") {
 				line = strings.TrimSpace(line)
+				if watchdog != nil {
+					watchdog.outputRead(time.Now())
+				}
 				result <- line
 			}
 			if err != nil {
@@ -3,12 +3,15 @@ package process_test
 import (
 	"fmt"
 	"github.com/stretchr/testify/assert"
+	"gitlab.com/flaneurtv/samm/core"
 	"gitlab.com/flaneurtv/samm/core/logger"
 	"gitlab.com/flaneurtv/samm/core/process"
 	"io/ioutil"
 	"os"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestSimpleScript(t *testing.T) {
@@ -38,7 +41,7 @@ func main() {
 `)
 	_ = scriptFile.Close()
 
-	sp := process.NewService("process1", "uuid1", "host1", "namespace1", "namespace2", fmt.Sprintf("go run %s", scriptFile.Name()), logger.NewNoOpLogger())
+	sp := process.NewService("process1", "uuid1", "host1", "namespace1", "namespace2", fmt.Sprintf("go run %s", scriptFile.Name()), 0, logger.NewNoOpLogger())
 
 	input := make(chan string)
 	output, errors, err := sp.Start(input)
@@ -93,7 +96,7 @@ func main() {
 `)
 	_ = scriptFile.Close()
 
-	sp := process.NewService("process1", "uuid1", "host1", "namespace1", "namespace2", fmt.Sprintf("go run %s", scriptFile.Name()), logger.NewNoOpLogger())
+	sp := process.NewService("process1", "uuid1", "host1", "namespace1", "namespace2", fmt.Sprintf("go run %s", scriptFile.Name()), 0, logger.NewNoOpLogger())
 
 	input := make(chan string)
 	output, errors, err := sp.Start(input)
@@ -120,7 +123,7 @@ func main() {
 }
 
 func TestInvalidScript(t *testing.T) {
-	sp := process.NewService("process1", "uuid1", "host1", "namespace1", "namespace2", "qwerty123098 run", logger.NewNoOpLogger())
+	sp := process.NewService("process1", "uuid1", "host1", "namespace1", "namespace2", "qwerty123098 run", 0, logger.NewNoOpLogger())
 
 	input := make(chan string)
 	_, _, err := sp.Start(input)
@@ -158,7 +161,7 @@ func main() {
 `)
 	_ = scriptFile.Close()
 
-	sp := process.NewService("process1", "uuid1", "host1", "namespace1", "namespace2", fmt.Sprintf("go run %s", scriptFile.Name()), logger.NewNoOpLogger())
+	sp := process.NewService("process1", "uuid1", "host1", "namespace1", "namespace2", fmt.Sprintf("go run %s", scriptFile.Name()), 0, logger.NewNoOpLogger())
 
 	input := make(chan string)
 	output, errors, err := sp.Start(input)
@@ -212,7 +215,7 @@ func main() {
 `)
 	_ = scriptFile.Close()
 
-	sp := process.NewService("process1", "uuid1", "host1", "namespace1", "namespace2", fmt.Sprintf("go run %s", scriptFile.Name()), logger.NewNoOpLogger())
+	sp := process.NewService("process1", "uuid1", "host1", "namespace1", "namespace2", fmt.Sprintf("go run %s", scriptFile.Name()), 0, logger.NewNoOpLogger())
 
 	input := make(chan string)
 	output, errors, err := sp.Start(input)
@@ -235,3 +238,132 @@ func main() {
 		assert.Equal(t, value, outValue)
 	}
 }
+
+func TestWatchdog(t *testing.T) {
+	scriptFile, _ := ioutil.TempFile("", "script*.sh")
+	defer os.Remove(scriptFile.Name())
+
+	_, _ = scriptFile.WriteString(`read line
+echo "${line}_OUT"
+read line
+exec sleep 60
+`)
+	_ = scriptFile.Close()
+
+	log := &mockLogger{}
+	sp := process.NewService("process1", "uuid1", "host1", "namespace1", "namespace2", fmt.Sprintf("sh %s", scriptFile.Name()), time.Millisecond*500, log)
+
+	input := make(chan string)
+	output, _, err := sp.Start(input)
+	assert.Nil(t, err)
+
+	input <- "test1"
+	assert.Equal(t, "test1_OUT", <-output)
+
+	started := time.Now()
+	input <- "test2"
+
+	_, ok := <-output
+	assert.False(t, ok)
+	assert.True(t, time.Since(started) >= time.Millisecond*500)
+	assert.True(t, time.Since(started) < time.Second*5)
+
+	messages := log.getMessages()
+	assert.Equal(t, 1, len(messages))
+	assert.Equal(t, core.LogLevelCritical, messages[0].level)
+	assert.Equal(t, "service processor unresponsive for 500ms, terminating", messages[0].message)
+}
+
+func TestWatchdogPendingInput(t *testing.T) {
+	scriptFile, _ := ioutil.TempFile("", "script*.sh")
+	defer os.Remove(scriptFile.Name())
+
+	_, _ = scriptFile.WriteString(`read line
+read line2
+echo "${line}_OUT"
+exec sleep 60
+`)
+	_ = scriptFile.Close()
+
+	log := &mockLogger{}
+	sp := process.NewService("process1", "uuid1", "host1", "namespace1", "namespace2", fmt.Sprintf("sh %s", scriptFile.Name()), time.Millisecond*500, log)
+
+	input := make(chan string)
+	output, _, err := sp.Start(input)
+	assert.Nil(t, err)
+
+	input <- "test1"
+	input <- "test2"
+	assert.Equal(t, "test1_OUT", <-output)
+	started := time.Now()
+
+	_, ok := <-output
+	assert.False(t, ok)
+	assert.True(t, time.Since(started) >= time.Millisecond*500)
+	assert.True(t, time.Since(started) < time.Second*5)
+
+	messages := log.getMessages()
+	if assert.Equal(t, 1, len(messages)) {
+		assert.Equal(t, "service processor unresponsive for 500ms, terminating", messages[0].message)
+	}
+}
+
+type mockLogger struct {
+	mu       sync.Mutex
+	messages []mockLoggerMessage
+}
+
+func (*mockLogger) SetClient(client core.MessageBusClient, namespace, serviceName, serviceUUID, serviceHost string) {
+}
+
+func (*mockLogger) SetLevels(levelConsole, levelRemote core.LogLevel) {
+}
+
+func (*mockLogger) SetCreatedAtGetter(getCreatedAt func() time.Time) {
+}
+
+func (*mockLogger) SetConsoleFormat(format core.ConsoleFormat) {
+}
+
+func (log *mockLogger) Log(level core.LogLevel, message string) {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	log.messages = append(log.messages, mockLoggerMessage{level: level, message: message})
+}
+
+func (log *mockLogger) LogEntry(entry core.LogEntry) {
+	log.Log(entry.Level, entry.Message)
+}
+
+func (*mockLogger) AddSink(sink core.LogSink) {
+}
+
+func (*mockLogger) SetRemoteLimits(limits core.LogLimits) {
+}
+
+func (log *mockLogger) getMessages() []mockLoggerMessage {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	return append([]mockLoggerMessage(nil), log.messages...)
+}
+
+type mockLoggerMessage struct {
+	level   core.LogLevel
+	message string
+}
+
+func TestServicePID(t *testing.T) {
+	sp := process.NewService("process1", "uuid1", "host1", "namespace1", "namespace2", "sleep 1", 0, logger.NewNoOpLogger())
+
+	processService, ok := sp.(core.ProcessService)
+	assert.True(t, ok)
+	assert.Equal(t, 0, processService.PID())
+
+	_, _, err := sp.Start(nil)
+	assert.Nil(t, err)
+
+	pid := processService.PID()
+	assert.True(t, pid > 0)
+	_, err = os.Stat(fmt.Sprintf("/proc/%d", pid))
+	assert.Nil(t, err)
+}
@@ -0,0 +1,60 @@
+package process
+
+import (
+	"sync"
+	"time"
+)
+
+// watchdog counts the input lines the processor hasn't answered yet. Every
+// output line answers one of them and restarts the timeout while others are
+// still pending.
+type watchdog struct {
+	timeout time.Duration
+
+	mu           sync.Mutex
+	pending      int
+	pendingSince time.Time
+}
+
+func newWatchdog(timeout time.Duration) *watchdog {
+	return &watchdog{timeout: timeout}
+}
+
+func (w *watchdog) inputWritten(now time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.pending == 0 {
+		w.pendingSince = now
+	}
+	w.pending++
+}
+
+func (w *watchdog) outputRead(now time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.pending > 0 {
+		w.pending--
+	}
+	if w.pending > 0 {
+		w.pendingSince = now
+	} else {
+		w.pendingSince = time.Time{}
+	}
+}
+
+func (w *watchdog) expired(now time.Time) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return !w.pendingSince.IsZero() && now.Sub(w.pendingSince) >= w.timeout
+}
+
+func (w *watchdog) checkInterval() time.Duration {
+	interval := w.timeout / 4
+	if interval < 10*time.Millisecond {
+		interval = 10 * time.Millisecond
+	}
+	return interval
+}
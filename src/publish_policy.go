@@ -0,0 +1,64 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+type NamespaceMode string
+
+const (
+	NamespaceModeOff     NamespaceMode = ""
+	NamespaceModePrefix  NamespaceMode = "prefix"
+	NamespaceModeEnforce NamespaceMode = "enforce"
+)
+
+type PublishPolicy struct {
+	namespace     string
+	namespaceMode NamespaceMode
+	allowedTopics []string
+}
+
+func NewPublishPolicy(namespace string, namespaceMode NamespaceMode, allowedTopics []string) *PublishPolicy {
+	return &PublishPolicy{
+		namespace:     namespace,
+		namespaceMode: namespaceMode,
+		allowedTopics: allowedTopics,
+	}
+}
+
+func ParseNamespaceMode(mode string) (NamespaceMode, bool) {
+	switch NamespaceMode(mode) {
+	case NamespaceModeOff, NamespaceModePrefix, NamespaceModeEnforce:
+		return NamespaceMode(mode), true
+	}
+	return NamespaceModeOff, false
+}
+
+func (p *PublishPolicy) Apply(topic string) (string, error) {
+	if strings.ContainsAny(topic, "#+") {
+		return topic, fmt.Errorf("topic '%s' contains wildcards", topic)
+	}
+
+	if p.namespaceMode != NamespaceModeOff && !strings.HasPrefix(topic, p.namespace+"/") {
+		if p.namespaceMode == NamespaceModeEnforce {
+			return topic, fmt.Errorf("topic '%s' is outside of namespace '%s'", topic, p.namespace)
+		}
+		topic = p.namespace + "/" + topic
+	}
+
+	if p.allowedTopics != nil {
+		allowed := false
+		for _, pattern := range p.allowedTopics {
+			if MatchTopic(pattern, topic) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return topic, fmt.Errorf("topic '%s' is not allowed", topic)
+		}
+	}
+
+	return topic, nil
+}
@@ -0,0 +1,73 @@
+package core_test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/flaneurtv/samm/core"
+	"testing"
+)
+
+func TestPublishPolicyWildcards(t *testing.T) {
+	policy := core.NewPublishPolicy("default", core.NamespaceModeOff, nil)
+
+	topic, err := policy.Apply("default/tick")
+	assert.Nil(t, err)
+	assert.Equal(t, "default/tick", topic)
+
+	topic, err = policy.Apply("tick")
+	assert.Nil(t, err)
+	assert.Equal(t, "tick", topic)
+
+	_, err = policy.Apply("default/#")
+	assert.NotNil(t, err)
+	assert.Equal(t, "topic 'default/#' contains wildcards", err.Error())
+
+	_, err = policy.Apply("default/+/tick")
+	assert.NotNil(t, err)
+}
+
+func TestPublishPolicyNamespacePrefix(t *testing.T) {
+	policy := core.NewPublishPolicy("default", core.NamespaceModePrefix, nil)
+
+	topic, err := policy.Apply("default/tick")
+	assert.Nil(t, err)
+	assert.Equal(t, "default/tick", topic)
+
+	topic, err = policy.Apply("tick")
+	assert.Nil(t, err)
+	assert.Equal(t, "default/tick", topic)
+
+	topic, err = policy.Apply("defaulted/tick")
+	assert.Nil(t, err)
+	assert.Equal(t, "default/defaulted/tick", topic)
+}
+
+func TestPublishPolicyNamespaceEnforce(t *testing.T) {
+	policy := core.NewPublishPolicy("default", core.NamespaceModeEnforce, nil)
+
+	topic, err := policy.Apply("default/tick")
+	assert.Nil(t, err)
+	assert.Equal(t, "default/tick", topic)
+
+	_, err = policy.Apply("other/tick")
+	assert.NotNil(t, err)
+	assert.Equal(t, "topic 'other/tick' is outside of namespace 'default'", err.Error())
+}
+
+func TestPublishPolicyAllowedTopics(t *testing.T) {
+	policy := core.NewPublishPolicy("default", core.NamespaceModePrefix, []string{"default/tick", "default/log/#"})
+
+	topic, err := policy.Apply("tick")
+	assert.Nil(t, err)
+	assert.Equal(t, "default/tick", topic)
+
+	_, err = policy.Apply("default/log/a/b")
+	assert.Nil(t, err)
+
+	_, err = policy.Apply("tock")
+	assert.NotNil(t, err)
+	assert.Equal(t, "topic 'default/tock' is not allowed", err.Error())
+
+	policy = core.NewPublishPolicy("default", core.NamespaceModeOff, []string{})
+	_, err = policy.Apply("default/tick")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,161 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+type RateLimitPolicy string
+
+const (
+	RateLimitPolicyDelay  RateLimitPolicy = "delay"
+	RateLimitPolicyDrop   RateLimitPolicy = "drop"
+	RateLimitPolicySample RateLimitPolicy = "sample"
+
+	// DefaultRateLimitSample publishes every 10th excess message with the sample policy.
+	DefaultRateLimitSample = 10
+)
+
+func ParseRateLimitPolicy(policy string) (RateLimitPolicy, bool) {
+	switch RateLimitPolicy(policy) {
+	case "", RateLimitPolicyDelay:
+		return RateLimitPolicyDelay, true
+	case RateLimitPolicyDrop, RateLimitPolicySample:
+		return RateLimitPolicy(policy), true
+	}
+	return "", false
+}
+
+// RateLimit allows Rate messages per second with bursts of up to Burst
+// messages for all topics matching Topic together.
+type RateLimit struct {
+	Topic  string
+	Rate   float64
+	Burst  int
+	Policy RateLimitPolicy
+	Sample int
+}
+
+type RateLimiter struct {
+	limits []*limit
+	logger Logger
+}
+
+type limit struct {
+	RateLimit
+
+	mu       sync.Mutex
+	tokens   float64
+	last     time.Time
+	excess   int
+	delayed  int
+	dropped  int
+	maxDelay time.Duration
+}
+
+func NewRateLimiter(limits []RateLimit, logger Logger) *RateLimiter {
+	l := &RateLimiter{logger: logger}
+	for _, rl := range limits {
+		if rl.Burst < 1 {
+			rl.Burst = 1
+		}
+		if rl.Sample < 1 {
+			rl.Sample = DefaultRateLimitSample
+		}
+		l.limits = append(l.limits, &limit{RateLimit: rl, tokens: float64(rl.Burst), last: time.Now()})
+	}
+	return l
+}
+
+// Wait reports whether a message to the given topic may be published. All
+// limits matching the topic are applied; with the delay policy Wait blocks
+// until the message fits into the limit.
+func (l *RateLimiter) Wait(topic string) bool {
+	for _, lim := range l.limits {
+		if !MatchTopic(lim.Topic, topic) {
+			continue
+		}
+		if !l.take(lim) {
+			return false
+		}
+	}
+	return true
+}
+
+func (l *RateLimiter) take(lim *limit) bool {
+	var waited time.Duration
+	for {
+		lim.mu.Lock()
+		now := time.Now()
+		lim.tokens += now.Sub(lim.last).Seconds() * lim.Rate
+		if lim.tokens > float64(lim.Burst) {
+			lim.tokens = float64(lim.Burst)
+		}
+		lim.last = now
+
+		if lim.tokens >= 1 {
+			lim.tokens--
+			if waited > 0 {
+				lim.delayed++
+				if waited > lim.maxDelay {
+					lim.maxDelay = waited
+				}
+			}
+			lim.mu.Unlock()
+			return true
+		}
+
+		switch lim.Policy {
+		case RateLimitPolicyDrop:
+			lim.dropped++
+			lim.mu.Unlock()
+			return false
+		case RateLimitPolicySample:
+			lim.excess++
+			if lim.excess%lim.Sample == 0 {
+				lim.mu.Unlock()
+				return true
+			}
+			lim.dropped++
+			lim.mu.Unlock()
+			return false
+		}
+
+		wait := time.Duration((1 - lim.tokens) / lim.Rate * float64(time.Second))
+		lim.mu.Unlock()
+
+		time.Sleep(wait)
+		waited += wait
+	}
+}
+
+// LogSummary logs and resets the number of throttled messages per limit.
+func (l *RateLimiter) LogSummary() {
+	var summaries []string
+	for _, lim := range l.limits {
+		lim.mu.Lock()
+		if lim.delayed > 0 {
+			summaries = append(summaries, fmt.Sprintf("'%s' delayed %d (max %s)", lim.Topic, lim.delayed, lim.maxDelay))
+		}
+		if lim.dropped > 0 {
+			summaries = append(summaries, fmt.Sprintf("'%s' dropped %d", lim.Topic, lim.dropped))
+		}
+		lim.delayed, lim.dropped, lim.maxDelay = 0, 0, 0
+		lim.mu.Unlock()
+	}
+
+	if len(summaries) > 0 {
+		l.logger.Log(LogLevelWarning, fmt.Sprintf("rate limits exceeded: %s", strings.Join(summaries, ", ")))
+	}
+}
+
+// StartSummaries logs a summary of throttled messages every interval.
+func (l *RateLimiter) StartSummaries(interval time.Duration) {
+	go func() {
+		for range time.Tick(interval) {
+			l.LogSummary()
+		}
+	}()
+}
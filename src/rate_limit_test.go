@@ -0,0 +1,82 @@
+package core_test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/flaneurtv/samm/core"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterDrop(t *testing.T) {
+	log := &mockLogger{}
+	limiter := core.NewRateLimiter([]core.RateLimit{
+		{Topic: "root/metrics/#", Rate: 1, Burst: 2, Policy: core.RateLimitPolicyDrop},
+	}, log)
+
+	assert.True(t, limiter.Wait("root/metrics/cpu"))
+	assert.True(t, limiter.Wait("root/metrics/memory"))
+	assert.False(t, limiter.Wait("root/metrics/cpu"))
+	assert.False(t, limiter.Wait("root/metrics/cpu"))
+	assert.True(t, limiter.Wait("root/tick"))
+
+	limiter.LogSummary()
+	limiter.LogSummary()
+	assert.Equal(t, 1, len(log.getMessages()))
+	assert.Equal(t, core.LogLevelWarning, log.getMessages()[0].level)
+	assert.Equal(t, "rate limits exceeded: 'root/metrics/#' dropped 2", log.getMessages()[0].message)
+}
+
+func TestRateLimiterSample(t *testing.T) {
+	limiter := core.NewRateLimiter([]core.RateLimit{
+		{Topic: "#", Rate: 0.001, Burst: 1, Policy: core.RateLimitPolicySample, Sample: 3},
+	}, &mockLogger{})
+
+	var published []bool
+	for i := 0; i < 7; i++ {
+		published = append(published, limiter.Wait("root/tick"))
+	}
+	assert.Equal(t, []bool{true, false, false, true, false, false, true}, published)
+}
+
+func TestRateLimiterDelay(t *testing.T) {
+	log := &mockLogger{}
+	limiter := core.NewRateLimiter([]core.RateLimit{
+		{Topic: "#", Rate: 20, Burst: 1, Policy: core.RateLimitPolicyDelay},
+	}, log)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		assert.True(t, limiter.Wait("root/tick"))
+	}
+	assert.True(t, time.Since(start) >= 90*time.Millisecond)
+
+	limiter.LogSummary()
+	assert.Equal(t, 1, len(log.getMessages()))
+	assert.Contains(t, log.getMessages()[0].message, "rate limits exceeded: '#' delayed 2 (max ")
+}
+
+func TestAdapterRateLimit(t *testing.T) {
+	bus := NewMockBus()
+	client := NewMockClient(bus)
+
+	outputs := make(chan string)
+	errors := make(chan string)
+	service := NewMockServiceProducer(outputs, errors)
+
+	log := &mockLogger{}
+	adapter := core.NewAdapter(client, client, nil, service, log)
+	adapter.SetRateLimiter(core.NewRateLimiter([]core.RateLimit{
+		{Topic: "root/+", Rate: 0.001, Burst: 1, Policy: core.RateLimitPolicyDrop},
+	}, log))
+	_, err := adapter.Start()
+	assert.Nil(t, err)
+
+	messages := collect(client, []string{"root/tick"})
+
+	outputs <- `{"topic": "root/tick", "payload": "a"}`
+	outputs <- `{"topic": "root/tick", "payload": "b"}`
+	time.Sleep(100 * time.Millisecond)
+	bus.close()
+
+	assert.Equal(t, []string{`{"topic": "root/tick", "payload": "a"}`}, messages())
+}
@@ -0,0 +1,5 @@
+package core
+
+type ReadinessProbe interface {
+	IsReady() bool
+}
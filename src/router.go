@@ -0,0 +1,268 @@
+package core
+
+import (
+	"fmt"
+	"sync"
+)
+
+// routerQueueSize is the number of messages queued for a client of a Router.
+// Further messages are dropped until the client catches up.
+const routerQueueSize = 1000
+
+type Router struct {
+	listener  MessageBusClient
+	publisher MessageBusClient
+
+	connectOnce sync.Once
+	connectErr  error
+
+	// subscribeMu serializes subscribing and unsubscribing, so the listener
+	// subscriptions match the routes.
+	subscribeMu sync.Mutex
+
+	mu     sync.Mutex
+	routes map[string]*route
+}
+
+type route struct {
+	subscribers []*routeSubscriber
+}
+
+// routeSubscriber queues the messages routed to one client, so a client which
+// is slow to read them doesn't hold up the others.
+type routeSubscriber struct {
+	messages chan<- string
+	input    chan string
+	done     chan struct{}
+	topics   int
+	logger   Logger
+	metrics  *Metrics
+}
+
+type routerClient struct {
+	router  *Router
+	logger  Logger
+	metrics *Metrics
+
+	mu            sync.Mutex
+	subscriptions map[string]*routeSubscriber
+}
+
+func NewRouter(listener, publisher MessageBusClient) *Router {
+	return &Router{
+		listener:  listener,
+		publisher: publisher,
+		routes:    make(map[string]*route),
+	}
+}
+
+// Client returns a client for one service. Messages dropped because the
+// service doesn't keep up are logged to logger and counted in metrics.
+func (r *Router) Client(logger Logger, metrics *Metrics) MessageBusClient {
+	return &routerClient{router: r, logger: logger, metrics: metrics, subscriptions: make(map[string]*routeSubscriber)}
+}
+
+func (r *Router) connect() error {
+	r.connectOnce.Do(func() {
+		r.connectErr = r.listener.Connect()
+		if r.connectErr == nil && r.publisher != r.listener {
+			r.connectErr = r.publisher.Connect()
+		}
+	})
+	return r.connectErr
+}
+
+func (r *Router) subscribe(topic string, subscriber *routeSubscriber) error {
+	r.subscribeMu.Lock()
+	defer r.subscribeMu.Unlock()
+
+	r.mu.Lock()
+	rt, ok := r.routes[topic]
+	if ok {
+		rt.subscribers = append(rt.subscribers, subscriber)
+	}
+	r.mu.Unlock()
+	if ok {
+		return nil
+	}
+
+	input, err := r.listener.Subscribe([]string{topic})
+	if err != nil {
+		return err
+	}
+
+	rt = &route{subscribers: []*routeSubscriber{subscriber}}
+	r.mu.Lock()
+	r.routes[topic] = rt
+	r.mu.Unlock()
+
+	go r.dispatch(rt, input)
+	return nil
+}
+
+func (r *Router) unsubscribe(topic string, subscriber *routeSubscriber) error {
+	r.subscribeMu.Lock()
+	defer r.subscribeMu.Unlock()
+
+	r.mu.Lock()
+	rt, ok := r.routes[topic]
+	if !ok {
+		r.mu.Unlock()
+		return nil
+	}
+
+	var subscribers []*routeSubscriber
+	for _, other := range rt.subscribers {
+		if other != subscriber {
+			subscribers = append(subscribers, other)
+		}
+	}
+	rt.subscribers = subscribers
+
+	unused := len(subscribers) == 0
+	if unused {
+		delete(r.routes, topic)
+	}
+	r.mu.Unlock()
+
+	if !unused {
+		return nil
+	}
+	return r.listener.Unsubscribe([]string{topic})
+}
+
+func (r *Router) dispatch(rt *route, input <-chan string) {
+	for msg := range input {
+		r.mu.Lock()
+		subscribers := rt.subscribers
+		r.mu.Unlock()
+
+		for _, subscriber := range subscribers {
+			subscriber.send(msg)
+		}
+	}
+}
+
+func newRouteSubscriber(messages chan<- string, logger Logger, metrics *Metrics) *routeSubscriber {
+	s := &routeSubscriber{
+		messages: messages,
+		input:    make(chan string),
+		done:     make(chan struct{}),
+		logger:   logger,
+		metrics:  metrics,
+	}
+	go s.run()
+	return s
+}
+
+func (s *routeSubscriber) send(msg string) {
+	select {
+	case s.input <- msg:
+	case <-s.done:
+	}
+}
+
+// run passes the queued messages on in order until the subscriber is closed,
+// then closes the messages channel.
+func (s *routeSubscriber) run() {
+	defer close(s.messages)
+
+	var queue []string
+	var dropped int
+	for {
+		var messages chan<- string
+		var next string
+		if len(queue) > 0 {
+			messages = s.messages
+			next = queue[0]
+		}
+
+		select {
+		case msg := <-s.input:
+			if len(queue) >= routerQueueSize {
+				if dropped == 0 {
+					s.logger.Log(LogLevelWarning, fmt.Sprintf("%d messages queued for the service, dropping further messages", len(queue)))
+				}
+				dropped++
+				s.metrics.Inc(MetricMessagesDropped, "reason", DropReasonQueueFull)
+				continue
+			}
+			queue = append(queue, msg)
+		case messages <- next:
+			queue[0] = ""
+			queue = queue[1:]
+			if dropped > 0 && len(queue) == 0 {
+				s.logger.Log(LogLevelWarning, fmt.Sprintf("service caught up, %d messages were dropped", dropped))
+				dropped = 0
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *routeSubscriber) close() {
+	close(s.done)
+}
+
+func (c *routerClient) Connect() error {
+	return c.router.connect()
+}
+
+func (c *routerClient) Subscribe(topics []string) (<-chan string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	messages := make(chan string)
+	subscriber := newRouteSubscriber(messages, c.logger, c.metrics)
+	var subscribed []string
+	for _, topic := range topics {
+		if _, ok := c.subscriptions[topic]; ok {
+			continue
+		}
+
+		err := c.router.subscribe(topic, subscriber)
+		if err != nil {
+			for _, topic := range subscribed {
+				delete(c.subscriptions, topic)
+				_ = c.router.unsubscribe(topic, subscriber)
+			}
+			subscriber.close()
+			return nil, err
+		}
+		c.subscriptions[topic] = subscriber
+		subscriber.topics++
+		subscribed = append(subscribed, topic)
+	}
+	if subscriber.topics == 0 {
+		subscriber.close()
+	}
+	return messages, nil
+}
+
+func (c *routerClient) Unsubscribe(topics []string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, topic := range topics {
+		subscriber, ok := c.subscriptions[topic]
+		if !ok {
+			continue
+		}
+
+		delete(c.subscriptions, topic)
+		err := c.router.unsubscribe(topic, subscriber)
+		subscriber.topics--
+		if subscriber.topics == 0 {
+			subscriber.close()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *routerClient) Publish(topic, message string) error {
+	return c.router.publisher.Publish(topic, message)
+}
@@ -0,0 +1,216 @@
+package core_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/flaneurtv/samm/core"
+	"gitlab.com/flaneurtv/samm/core/logger"
+	"testing"
+	"time"
+)
+
+func TestRouter(t *testing.T) {
+	bus := NewMockBus()
+	listener := NewMockClient(bus)
+	publisher := NewMockClient(bus)
+	client := NewMockClient(bus)
+
+	router := core.NewRouter(listener, publisher)
+	client1 := router.Client(logger.NewNoOpLogger(), nil)
+	client2 := router.Client(logger.NewNoOpLogger(), nil)
+
+	assert.Nil(t, client1.Connect())
+	assert.Nil(t, client2.Connect())
+	assert.Equal(t, 1, listener.connects)
+	assert.Equal(t, 1, publisher.connects)
+
+	messages1, err := client1.Subscribe([]string{"tick", "tock"})
+	assert.Nil(t, err)
+	messages2, err := client2.Subscribe([]string{"tick"})
+	assert.Nil(t, err)
+
+	go client.Publish("tick", "a")
+	assert.Equal(t, "a", <-messages1)
+	assert.Equal(t, "a", <-messages2)
+
+	go client.Publish("tock", "b")
+	assert.Equal(t, "b", <-messages1)
+
+	assert.Nil(t, client1.Unsubscribe([]string{"tick"}))
+	go client.Publish("tick", "c")
+	assert.Equal(t, "c", <-messages2)
+
+	assert.Nil(t, client2.Unsubscribe([]string{"tick"}))
+	_, ok := <-messages2
+	assert.False(t, ok)
+	client.Publish("tick", "d")
+
+	select {
+	case msg := <-messages1:
+		t.Errorf("unexpected message: %s", msg)
+	case <-time.After(time.Millisecond * 100):
+	}
+
+	responses, err := client.Subscribe([]string{"tick-response"})
+	assert.Nil(t, err)
+	go client2.Publish("tick-response", "e")
+	assert.Equal(t, "e", <-responses)
+}
+
+func TestRouterSubscribeError(t *testing.T) {
+	bus := NewMockBus()
+	listener := NewMockClient(bus)
+	listener.forceSubscribeError = true
+
+	router := core.NewRouter(listener, listener)
+	_, err := router.Client(logger.NewNoOpLogger(), nil).Subscribe([]string{"tick"})
+	assert.NotNil(t, err)
+	assert.Equal(t, "subscribe error", err.Error())
+}
+
+func TestRouterSlowClient(t *testing.T) {
+	bus := NewMockBus()
+	listener := NewMockClient(bus)
+	client := NewMockClient(bus)
+
+	router := core.NewRouter(listener, listener)
+	slow, err := router.Client(logger.NewNoOpLogger(), nil).Subscribe([]string{"tick"})
+	assert.Nil(t, err)
+	messages, err := router.Client(logger.NewNoOpLogger(), nil).Subscribe([]string{"tick"})
+	assert.Nil(t, err)
+
+	go func() {
+		for _, msg := range []string{"a", "b", "c"} {
+			client.Publish("tick", msg)
+		}
+	}()
+
+	for _, expected := range []string{"a", "b", "c"} {
+		select {
+		case msg := <-messages:
+			assert.Equal(t, expected, msg)
+		case <-time.After(time.Second):
+			t.Fatalf("message '%s' held up by the slow client", expected)
+		}
+	}
+
+	for _, expected := range []string{"a", "b", "c"} {
+		assert.Equal(t, expected, <-slow)
+	}
+}
+
+func TestRouterQueueFull(t *testing.T) {
+	bus := NewMockBus()
+	listener := NewMockClient(bus)
+	client := NewMockClient(bus)
+	log := &mockLogger{}
+	metrics := core.NewMetrics()
+
+	router := core.NewRouter(listener, listener)
+	slow, err := router.Client(log, metrics.With("service", "slow")).Subscribe([]string{"tick"})
+	assert.Nil(t, err)
+
+	for i := 0; i < 1005; i++ {
+		client.Publish("tick", fmt.Sprint(i))
+	}
+	time.Sleep(time.Millisecond * 100)
+
+	var output bytes.Buffer
+	metrics.WriteTo(&output)
+	assert.Contains(t, output.String(), `samm_messages_dropped_total{service="slow",reason="queue_full"} 5`)
+	messages := log.getMessages()
+	if assert.Equal(t, 1, len(messages)) {
+		assert.Equal(t, core.LogLevelWarning, messages[0].level)
+		assert.Equal(t, "1000 messages queued for the service, dropping further messages", messages[0].message)
+	}
+
+	for i := 0; i < 1000; i++ {
+		assert.Equal(t, fmt.Sprint(i), <-slow)
+	}
+
+	client.Publish("tick", "next")
+	assert.Equal(t, "next", <-slow)
+
+	messages = log.getMessages()
+	if assert.Equal(t, 2, len(messages)) {
+		assert.Equal(t, "service caught up, 5 messages were dropped", messages[1].message)
+	}
+}
+
+func TestRouterSubscribeRollback(t *testing.T) {
+	bus := NewMockBus()
+	listener := &failingClient{mockClient: NewMockClient(bus), failTopic: "tock"}
+	client := NewMockClient(bus)
+
+	router := core.NewRouter(listener, listener)
+	client1 := router.Client(logger.NewNoOpLogger(), nil)
+	_, err := client1.Subscribe([]string{"tick", "tock"})
+	assert.NotNil(t, err)
+	assert.Equal(t, []string{"tick"}, listener.unsubscribed)
+
+	listener.failTopic = ""
+	messages, err := client1.Subscribe([]string{"tick"})
+	assert.Nil(t, err)
+
+	go client.Publish("tick", "a")
+	assert.Equal(t, "a", <-messages)
+}
+
+func TestRouterConcurrentSubscribe(t *testing.T) {
+	bus := NewMockBus()
+	listener := &failingClient{mockClient: NewMockClient(bus), unsubscribing: make(chan struct{})}
+	client := NewMockClient(bus)
+
+	router := core.NewRouter(listener, listener)
+	client1 := router.Client(logger.NewNoOpLogger(), nil)
+	client2 := router.Client(logger.NewNoOpLogger(), nil)
+	_, err := client1.Subscribe([]string{"tick"})
+	assert.Nil(t, err)
+
+	go client1.Unsubscribe([]string{"tick"})
+	time.Sleep(time.Millisecond * 50)
+
+	subscribed := make(chan (<-chan string))
+	go func() {
+		messages, err := client2.Subscribe([]string{"tick"})
+		assert.Nil(t, err)
+		subscribed <- messages
+	}()
+	time.Sleep(time.Millisecond * 50)
+	close(listener.unsubscribing)
+
+	messages := <-subscribed
+	go client.Publish("tick", "a")
+	select {
+	case msg := <-messages:
+		assert.Equal(t, "a", msg)
+	case <-time.After(time.Second):
+		t.Error("message not received")
+	}
+}
+
+type failingClient struct {
+	*mockClient
+	failTopic     string
+	unsubscribing chan struct{}
+	unsubscribed  []string
+}
+
+func (c *failingClient) Subscribe(topics []string) (<-chan string, error) {
+	for _, topic := range topics {
+		if topic == c.failTopic {
+			return nil, errors.New("subscribe error")
+		}
+	}
+	return c.mockClient.Subscribe(topics)
+}
+
+func (c *failingClient) Unsubscribe(topics []string) error {
+	if c.unsubscribing != nil {
+		<-c.unsubscribing
+	}
+	c.unsubscribed = append(c.unsubscribed, topics...)
+	return c.mockClient.Unsubscribe(topics)
+}
@@ -0,0 +1,201 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/satori/go.uuid"
+	"github.com/tidwall/gjson"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule fires every interval or at the times matching a cron expression.
+// Without a publish template, a timer message on ControlTopicTimer is
+// delivered to the service, otherwise the expanded template is published.
+type Schedule struct {
+	Name    string
+	Every   time.Duration
+	Cron    *CronExpr
+	Publish string
+}
+
+func (s *Schedule) Next(t time.Time) time.Time {
+	if s.Cron != nil {
+		return s.Cron.Next(t)
+	}
+	return t.Add(s.Every)
+}
+
+// ExpandTemplate replaces $VAR and ${VAR} by the JSON escaped values of
+// vars. Unknown variables are left untouched.
+func ExpandTemplate(template string, vars map[string]string) string {
+	return os.Expand(template, func(key string) string {
+		value, ok := vars[key]
+		if !ok {
+			return "$" + key
+		}
+		escaped, _ := json.Marshal(value)
+		return string(escaped[1 : len(escaped)-1])
+	})
+}
+
+func (a *Adapter) runSchedule(s Schedule, done <-chan struct{}) {
+	next := s.Next(time.Now())
+	for {
+		select {
+		case <-done:
+			return
+		case <-time.After(time.Until(next)):
+		}
+
+		firedAt := next
+		next = s.Next(next)
+		if now := time.Now(); !next.After(now) {
+			// skip the times missed while the service was busy
+			next = s.Next(now)
+		}
+
+		createdAt := firedAt.UTC().Format(createdAtFormat)
+		if s.Publish == "" {
+			name, _ := json.Marshal(s.Name)
+			msg := fmt.Sprintf(`{"topic":"%s","created_at":"%s","payload":{"name":%s}}`, ControlTopicTimer, createdAt, name)
+			a.deliver(msg, delivery{})
+			continue
+		}
+
+		vars := make(map[string]string, len(a.templateVars)+2)
+		for key, value := range a.templateVars {
+			vars[key] = value
+		}
+		vars["UUID"] = uuid.NewV4().String()
+		vars["CREATED_AT"] = createdAt
+
+		msg := ExpandTemplate(s.Publish, vars)
+		if !gjson.Valid(msg) {
+			a.logger.Log(LogLevelError, fmt.Sprintf("schedule '%s': template isn't valid JSON: %s", s.Name, msg))
+			continue
+		}
+		a.handleOutputMessage(msg, delivery{})
+	}
+}
+
+// CronExpr is a cron expression with the fields minute, hour, day of month,
+// month and day of week. Fields support *, lists, ranges and steps. Like in
+// Vixie cron, a day matches if either day field matches when both are
+// restricted.
+type CronExpr struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool
+}
+
+func ParseCron(expr string) (*CronExpr, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid cron expression '%s': expected 5 fields", expr)
+	}
+
+	c := &CronExpr{domAny: fields[2] == "*", dowAny: fields[4] == "*"}
+	bounds := []struct {
+		field    *uint64
+		min, max int
+	}{
+		{&c.minute, 0, 59},
+		{&c.hour, 0, 23},
+		{&c.dom, 1, 31},
+		{&c.month, 1, 12},
+		{&c.dow, 0, 7},
+	}
+	for i, b := range bounds {
+		bits, err := parseCronField(fields[i], b.min, b.max)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron expression '%s': %s", expr, err)
+		}
+		*b.field = bits
+	}
+
+	// both 0 and 7 are sunday
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	return c, nil
+}
+
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			rng = part[:i]
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step in '%s'", part)
+			}
+		}
+
+		from, to := min, max
+		if rng != "*" {
+			bounds := strings.SplitN(rng, "-", 2)
+			var err error
+			from, err = strconv.Atoi(bounds[0])
+			if err != nil {
+				return 0, fmt.Errorf("invalid value in '%s'", part)
+			}
+			to = from
+			if len(bounds) == 2 {
+				to, err = strconv.Atoi(bounds[1])
+				if err != nil {
+					return 0, fmt.Errorf("invalid value in '%s'", part)
+				}
+			} else if step > 1 {
+				to = max
+			}
+		}
+		if from < min || to > max || from > to {
+			return 0, fmt.Errorf("'%s' is out of range %d-%d", part, min, max)
+		}
+
+		for v := from; v <= to; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// Next returns the first matching time after t.
+func (c *CronExpr) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return limit
+}
+
+func (c *CronExpr) matchDay(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domAny || c.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
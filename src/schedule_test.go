@@ -0,0 +1,122 @@
+package core_test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+	"gitlab.com/flaneurtv/samm/core"
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	base := time.Date(2018, 3, 14, 10, 27, 30, 0, time.UTC)
+
+	tests := []struct {
+		expr string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2018, 3, 14, 10, 28, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2018, 3, 14, 10, 30, 0, 0, time.UTC)},
+		{"0 9-17 * * *", time.Date(2018, 3, 14, 11, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2018, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"30 8 * * 1,5", time.Date(2018, 3, 16, 8, 30, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2018, 3, 18, 0, 0, 0, 0, time.UTC)},
+		{"0 0 20 * 0", time.Date(2018, 3, 18, 0, 0, 0, 0, time.UTC)},
+		{"0 12 29 2 *", time.Date(2020, 2, 29, 12, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		cron, err := core.ParseCron(test.expr)
+		if assert.Nil(t, err, test.expr) {
+			assert.Equal(t, test.next, cron.Next(base), test.expr)
+		}
+	}
+
+	errs := map[string]string{
+		"* * * *":     "invalid cron expression '* * * *': expected 5 fields",
+		"60 * * * *":  "invalid cron expression '60 * * * *': '60' is out of range 0-59",
+		"* * 0 * *":   "invalid cron expression '* * 0 * *': '0' is out of range 1-31",
+		"*/0 * * * *": "invalid cron expression '*/0 * * * *': invalid step in '*/0'",
+		"a * * * *":   "invalid cron expression 'a * * * *': invalid value in 'a'",
+		"* 5-2 * * *": "invalid cron expression '* 5-2 * * *': '5-2' is out of range 0-23",
+	}
+	for expr, msg := range errs {
+		_, err := core.ParseCron(expr)
+		if assert.NotNil(t, err, expr) {
+			assert.Equal(t, msg, err.Error())
+		}
+	}
+}
+
+func TestExpandTemplate(t *testing.T) {
+	vars := map[string]string{"SERVICE_NAME": "svc", "QUOTE": `a"b`}
+	assert.Equal(t,
+		`{"topic": "svc/ping", "payload": {"q": "a\"b", "x": "$UNKNOWN"}}`,
+		core.ExpandTemplate(`{"topic": "${SERVICE_NAME}/ping", "payload": {"q": "$QUOTE", "x": "$UNKNOWN"}}`, vars))
+}
+
+func TestAdapterTimer(t *testing.T) {
+	bus := NewMockBus()
+	client := NewMockClient(bus)
+
+	outputs := make(chan string)
+	errors := make(chan string)
+	service := NewMockServiceProducer(outputs, errors)
+
+	log := &mockLogger{}
+	adapter := core.NewAdapter(client, client, nil, service, log)
+	adapter.SetSchedules([]core.Schedule{{Name: "tick", Every: 50 * time.Millisecond}}, nil)
+	_, err := adapter.Start()
+	assert.Nil(t, err)
+
+	for i := 0; i < 2; i++ {
+		select {
+		case msg := <-service.getInput():
+			assert.Equal(t, core.ControlTopicTimer, gjson.Get(msg, "topic").String())
+			assert.Equal(t, "tick", gjson.Get(msg, "payload.name").String())
+			assert.True(t, gjson.Get(msg, "created_at").Exists())
+		case <-time.After(time.Second):
+			t.Fatal("timer message wasn't delivered")
+		}
+	}
+}
+
+func TestAdapterSchedulePublish(t *testing.T) {
+	bus := NewMockBus()
+	client := NewMockClient(bus)
+
+	outputs := make(chan string)
+	errors := make(chan string)
+	service := NewMockServiceProducer(outputs, errors)
+
+	log := &mockLogger{}
+	adapter := core.NewAdapter(client, client, nil, service, log)
+	adapter.SetSchedules([]core.Schedule{{
+		Name:    "ping",
+		Every:   50 * time.Millisecond,
+		Publish: `{"topic": "root/$SERVICE_NAME/ping", "payload": {"id": "$UUID", "at": "$CREATED_AT"}}`,
+	}}, map[string]string{"SERVICE_NAME": "svc"})
+
+	subscription, _ := client.Subscribe([]string{"root/+/ping"})
+	output := make(chan string, 10)
+	go func() {
+		for msg := range subscription {
+			output <- msg
+		}
+	}()
+
+	_, err := adapter.Start()
+	assert.Nil(t, err)
+
+	var published []string
+	for i := 0; i < 2; i++ {
+		select {
+		case msg := <-output:
+			published = append(published, msg)
+		case <-time.After(time.Second):
+			t.Fatal("template wasn't published")
+		}
+	}
+
+	assert.NotEqual(t, gjson.Get(published[0], "payload.id").String(), gjson.Get(published[1], "payload.id").String())
+	assert.NotEmpty(t, gjson.Get(published[0], "payload.at").String())
+}
@@ -0,0 +1,81 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"gitlab.com/flaneurtv/samm/core"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+)
+
+const topicsKeyword = "x-topics"
+
+type registry struct {
+	schemas []topicSchema
+}
+
+type topicSchema struct {
+	file     string
+	patterns []string
+	schema   *Schema
+}
+
+func NewRegistry(dir string, logger core.Logger) (core.MessageValidator, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("can't list schemas: %s", err)
+	}
+	sort.Strings(files)
+
+	r := &registry{}
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("can't read schema '%s': %s", file, err)
+		}
+
+		var header map[string]json.RawMessage
+		err = json.Unmarshal(content, &header)
+		if err != nil {
+			return nil, fmt.Errorf("can't parse schema '%s': %s", file, err)
+		}
+
+		var patterns []string
+		if raw, ok := header[topicsKeyword]; ok {
+			err = json.Unmarshal(raw, &patterns)
+			if err != nil {
+				return nil, fmt.Errorf("can't parse %s of schema '%s': %s", topicsKeyword, file, err)
+			}
+		}
+		if len(patterns) == 0 {
+			logger.Log(core.LogLevelWarning, fmt.Sprintf("Schema '%s' has no %s, skipping", file, topicsKeyword))
+			continue
+		}
+
+		schema, err := Parse(content)
+		if err != nil {
+			return nil, fmt.Errorf("schema '%s': %s", file, err)
+		}
+
+		r.schemas = append(r.schemas, topicSchema{file: file, patterns: patterns, schema: schema})
+		logger.Log(core.LogLevelInfo, fmt.Sprintf("Schema '%s' loaded for topics: %v", file, patterns))
+	}
+
+	return r, nil
+}
+
+func (r *registry) Validate(topic, message string) error {
+	for _, s := range r.schemas {
+		for _, pattern := range s.patterns {
+			if core.MatchTopic(pattern, topic) {
+				err := s.schema.Validate(message)
+				if err != nil {
+					return err
+				}
+				break
+			}
+		}
+	}
+	return nil
+}
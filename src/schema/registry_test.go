@@ -0,0 +1,48 @@
+package schema_test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/flaneurtv/samm/core"
+	"gitlab.com/flaneurtv/samm/core/logger"
+	"gitlab.com/flaneurtv/samm/core/schema"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(dir)
+
+	_ = ioutil.WriteFile(filepath.Join(dir, "tick.json"), []byte(`{"x-topics": ["+/tick"], "required": ["payload"]}`), 0644)
+	_ = ioutil.WriteFile(filepath.Join(dir, "log.json"), []byte(`{"x-topics": ["default/log/#"], "properties": {"payload": {"type": "object"}}}`), 0644)
+	_ = ioutil.WriteFile(filepath.Join(dir, "unmapped.json"), []byte(`{"required": ["never"]}`), 0644)
+	_ = ioutil.WriteFile(filepath.Join(dir, "notes.txt"), []byte(`not a schema`), 0644)
+
+	validator, err := schema.NewRegistry(dir, logger.NewNoOpLogger())
+	assert.Nil(t, err)
+
+	assert.Nil(t, validator.Validate("default/tick", `{"topic": "default/tick", "payload": {}}`))
+	assert.Nil(t, validator.Validate("default/tock", `{"topic": "default/tock"}`))
+	assert.Nil(t, validator.Validate("default/log/a/b", `{"topic": "default/log/a/b", "payload": {}}`))
+
+	err = validator.Validate("default/tick", `{"topic": "default/tick"}`)
+	assert.NotNil(t, err)
+	assert.Equal(t, "required property missing at '/payload'", err.Error())
+
+	err = validator.Validate("default/log/a", `{"topic": "default/log/a", "payload": 1}`)
+	assert.NotNil(t, err)
+	assert.Equal(t, &core.ValidationError{Pointer: "/payload", Reason: "expected type object, got integer"}, err)
+}
+
+func TestRegistryInvalidSchema(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(dir)
+
+	_ = ioutil.WriteFile(filepath.Join(dir, "tick.json"), []byte(`{"x-topics": "+/tick"}`), 0644)
+
+	_, err := schema.NewRegistry(dir, logger.NewNoOpLogger())
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "can't parse x-topics")
+}
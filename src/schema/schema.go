@@ -0,0 +1,526 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"gitlab.com/flaneurtv/samm/core"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type Schema struct {
+	root     interface{}
+	patterns map[string]*regexp.Regexp
+}
+
+func Parse(content []byte) (*Schema, error) {
+	root, err := decode(content)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse schema: %s", err)
+	}
+
+	s := &Schema{root: root, patterns: make(map[string]*regexp.Regexp)}
+	var nodes []map[string]interface{}
+	err = s.compile(root, "#", &nodes)
+	if err != nil {
+		return nil, err
+	}
+	err = s.checkCycles(nodes)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Schema) Validate(message string) error {
+	value, err := decode([]byte(message))
+	if err != nil {
+		return &core.ValidationError{Pointer: "", Reason: fmt.Sprintf("invalid json: %s", err)}
+	}
+	return s.validate(s.root, value, "")
+}
+
+func decode(content []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+
+	var value interface{}
+	err := decoder.Decode(&value)
+	return value, err
+}
+
+// unsupportedKeywords are rejected when parsing, instead of being ignored
+// when validating.
+var unsupportedKeywords = []string{
+	"format", "patternProperties", "if", "then", "else", "uniqueItems", "contains", "minContains", "maxContains",
+	"dependencies", "dependentRequired", "dependentSchemas", "propertyNames", "minProperties", "maxProperties",
+	"additionalItems", "prefixItems", "unevaluatedItems", "unevaluatedProperties",
+}
+
+// compile checks the schema at the pointer, its subschemas and the schemas it
+// references and compiles their patterns. The schema objects are added to
+// nodes once.
+func (s *Schema) compile(node interface{}, pointer string, nodes *[]map[string]interface{}) error {
+	schema, ok := node.(map[string]interface{})
+	if !ok {
+		if _, ok := node.(bool); ok {
+			return nil
+		}
+		return fmt.Errorf("invalid schema at '%s': expected an object or a boolean", pointer)
+	}
+	for _, compiled := range *nodes {
+		if reflect.ValueOf(compiled).Pointer() == reflect.ValueOf(schema).Pointer() {
+			return nil
+		}
+	}
+	*nodes = append(*nodes, schema)
+
+	for _, keyword := range unsupportedKeywords {
+		if _, ok := schema[keyword]; ok {
+			return fmt.Errorf("unsupported keyword '%s' at '%s'", keyword, pointer)
+		}
+	}
+
+	if pattern, ok := schema["pattern"].(string); ok {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("can't compile pattern '%s': %s", pattern, err)
+		}
+		s.patterns[pattern] = re
+	}
+
+	if ref, ok := schema["$ref"].(string); ok {
+		target, err := s.resolve(ref)
+		if err != nil {
+			return fmt.Errorf("%s at '%s'", err, pointer)
+		}
+		err = s.compile(target, ref, nodes)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, keyword := range []string{"additionalProperties", "items", "not"} {
+		if sub, ok := schema[keyword]; ok {
+			err := s.compile(sub, pointer+"/"+keyword, nodes)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, keyword := range []string{"properties", "definitions", "$defs"} {
+		if subs, ok := schema[keyword].(map[string]interface{}); ok {
+			for _, name := range sortedKeys(subs) {
+				err := s.compile(subs[name], pointer+"/"+keyword+"/"+escape(name), nodes)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	for _, keyword := range []string{"allOf", "anyOf", "oneOf"} {
+		if subs, ok := schema[keyword].([]interface{}); ok {
+			for i, sub := range subs {
+				err := s.compile(sub, pointer+"/"+keyword+"/"+strconv.Itoa(i), nodes)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// checkCycles rejects $ref cycles which apply a schema to the same value
+// again, as validating them would never end.
+func (s *Schema) checkCycles(nodes []map[string]interface{}) error {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[uintptr]int)
+
+	var visit func(schema map[string]interface{}, refs []string) error
+	visit = func(schema map[string]interface{}, refs []string) error {
+		id := reflect.ValueOf(schema).Pointer()
+		switch state[id] {
+		case visiting:
+			return fmt.Errorf("$ref cycle: %s", strings.Join(refs, " -> "))
+		case visited:
+			return nil
+		}
+		state[id] = visiting
+
+		var next []interface{}
+		nextRefs := refs
+		if ref, ok := schema["$ref"].(string); ok {
+			target, _ := s.resolve(ref)
+			next = append(next, target)
+			nextRefs = append(refs[:len(refs):len(refs)], ref)
+		} else {
+			for _, keyword := range []string{"allOf", "anyOf", "oneOf"} {
+				if subs, ok := schema[keyword].([]interface{}); ok {
+					next = append(next, subs...)
+				}
+			}
+			if not, ok := schema["not"]; ok {
+				next = append(next, not)
+			}
+		}
+
+		for _, node := range next {
+			if sub, ok := node.(map[string]interface{}); ok {
+				err := visit(sub, nextRefs)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		state[id] = visited
+		return nil
+	}
+
+	for _, schema := range nodes {
+		err := visit(schema, nil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Schema) validate(schemaNode, value interface{}, pointer string) error {
+	if allowed, ok := schemaNode.(bool); ok {
+		if !allowed {
+			return fail(pointer, "no value allowed")
+		}
+		return nil
+	}
+
+	schema, ok := schemaNode.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	if ref, ok := schema["$ref"].(string); ok {
+		target, err := s.resolve(ref)
+		if err != nil {
+			return fail(pointer, err.Error())
+		}
+		return s.validate(target, value, pointer)
+	}
+
+	if types, ok := schema["type"]; ok && !matchesType(types, value) {
+		return fail(pointer, fmt.Sprintf("expected type %s, got %s", formatTypes(types), typeOf(value)))
+	}
+
+	if expected, ok := schema["const"]; ok && !equal(expected, value) {
+		return fail(pointer, fmt.Sprintf("expected %s", formatValue(expected)))
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, expected := range enum {
+			if equal(expected, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fail(pointer, fmt.Sprintf("expected one of %s", formatValue(enum)))
+		}
+	}
+
+	var err error
+	switch value := value.(type) {
+	case map[string]interface{}:
+		err = s.validateObject(schema, value, pointer)
+	case []interface{}:
+		err = s.validateArray(schema, value, pointer)
+	case string:
+		err = s.validateString(schema, value, pointer)
+	case json.Number:
+		err = validateNumber(schema, value, pointer)
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.validateCombinations(schema, value, pointer)
+}
+
+func (s *Schema) validateObject(schema map[string]interface{}, value map[string]interface{}, pointer string) error {
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, name := range required {
+			if name, ok := name.(string); ok {
+				if _, ok := value[name]; !ok {
+					return fail(pointer+"/"+escape(name), "required property missing")
+				}
+			}
+		}
+	}
+
+	properties, _ := schema["properties"].(map[string]interface{})
+	additional, hasAdditional := schema["additionalProperties"]
+	for _, name := range sortedKeys(value) {
+		if property, ok := properties[name]; ok {
+			err := s.validate(property, value[name], pointer+"/"+escape(name))
+			if err != nil {
+				return err
+			}
+		} else if hasAdditional {
+			if allowed, ok := additional.(bool); ok && !allowed {
+				return fail(pointer+"/"+escape(name), "additional property not allowed")
+			}
+			err := s.validate(additional, value[name], pointer+"/"+escape(name))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Schema) validateArray(schema map[string]interface{}, value []interface{}, pointer string) error {
+	if min, ok := number(schema["minItems"]); ok && float64(len(value)) < min {
+		return fail(pointer, fmt.Sprintf("expected at least %s items", formatValue(schema["minItems"])))
+	}
+	if max, ok := number(schema["maxItems"]); ok && float64(len(value)) > max {
+		return fail(pointer, fmt.Sprintf("expected at most %s items", formatValue(schema["maxItems"])))
+	}
+
+	if items, ok := schema["items"]; ok {
+		for i, item := range value {
+			err := s.validate(items, item, pointer+"/"+strconv.Itoa(i))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Schema) validateString(schema map[string]interface{}, value string, pointer string) error {
+	length := float64(utf8.RuneCountInString(value))
+	if min, ok := number(schema["minLength"]); ok && length < min {
+		return fail(pointer, fmt.Sprintf("expected at least %s characters", formatValue(schema["minLength"])))
+	}
+	if max, ok := number(schema["maxLength"]); ok && length > max {
+		return fail(pointer, fmt.Sprintf("expected at most %s characters", formatValue(schema["maxLength"])))
+	}
+	if pattern, ok := schema["pattern"].(string); ok && !s.patterns[pattern].MatchString(value) {
+		return fail(pointer, fmt.Sprintf("expected to match pattern '%s'", pattern))
+	}
+	return nil
+}
+
+func validateNumber(schema map[string]interface{}, value json.Number, pointer string) error {
+	n, err := value.Float64()
+	if err != nil {
+		return fail(pointer, fmt.Sprintf("invalid number: %s", value))
+	}
+
+	if min, ok := number(schema["minimum"]); ok && n < min {
+		return fail(pointer, fmt.Sprintf("expected minimum %s", formatValue(schema["minimum"])))
+	}
+	if max, ok := number(schema["maximum"]); ok && n > max {
+		return fail(pointer, fmt.Sprintf("expected maximum %s", formatValue(schema["maximum"])))
+	}
+	if min, ok := number(schema["exclusiveMinimum"]); ok && n <= min {
+		return fail(pointer, fmt.Sprintf("expected greater than %s", formatValue(schema["exclusiveMinimum"])))
+	}
+	if max, ok := number(schema["exclusiveMaximum"]); ok && n >= max {
+		return fail(pointer, fmt.Sprintf("expected less than %s", formatValue(schema["exclusiveMaximum"])))
+	}
+	if multiple, ok := number(schema["multipleOf"]); ok && multiple != 0 {
+		quotient := n / multiple
+		if math.Abs(quotient-math.Round(quotient)) > 1e-9 {
+			return fail(pointer, fmt.Sprintf("expected multiple of %s", formatValue(schema["multipleOf"])))
+		}
+	}
+	return nil
+}
+
+func (s *Schema) validateCombinations(schema map[string]interface{}, value interface{}, pointer string) error {
+	if allOf, ok := schema["allOf"].([]interface{}); ok {
+		for _, sub := range allOf {
+			err := s.validate(sub, value, pointer)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if anyOf, ok := schema["anyOf"].([]interface{}); ok {
+		var firstErr error
+		for _, sub := range anyOf {
+			err := s.validate(sub, value, pointer)
+			if err == nil {
+				firstErr = nil
+				break
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		if firstErr != nil {
+			return fail(pointer, fmt.Sprintf("expected any of the schemas to match: %s", firstErr))
+		}
+	}
+
+	if oneOf, ok := schema["oneOf"].([]interface{}); ok {
+		matches := 0
+		for _, sub := range oneOf {
+			if s.validate(sub, value, pointer) == nil {
+				matches++
+			}
+		}
+		if matches != 1 {
+			return fail(pointer, fmt.Sprintf("expected exactly one of the schemas to match, %d matched", matches))
+		}
+	}
+
+	if not, ok := schema["not"]; ok {
+		if s.validate(not, value, pointer) == nil {
+			return fail(pointer, "expected schema not to match")
+		}
+	}
+
+	return nil
+}
+
+func (s *Schema) resolve(ref string) (interface{}, error) {
+	if ref != "#" && !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("unsupported $ref '%s'", ref)
+	}
+
+	node := s.root
+	for _, token := range strings.Split(strings.TrimPrefix(ref, "#"), "/")[1:] {
+		token = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+		switch current := node.(type) {
+		case map[string]interface{}:
+			next, ok := current[token]
+			if !ok {
+				return nil, fmt.Errorf("can't resolve $ref '%s'", ref)
+			}
+			node = next
+		case []interface{}:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(current) {
+				return nil, fmt.Errorf("can't resolve $ref '%s'", ref)
+			}
+			node = current[i]
+		default:
+			return nil, fmt.Errorf("can't resolve $ref '%s'", ref)
+		}
+	}
+	return node, nil
+}
+
+func matchesType(types interface{}, value interface{}) bool {
+	switch types := types.(type) {
+	case string:
+		return matchesSingleType(types, value)
+	case []interface{}:
+		for _, t := range types {
+			if t, ok := t.(string); ok && matchesSingleType(t, value) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func matchesSingleType(t string, value interface{}) bool {
+	actual := typeOf(value)
+	if t == "number" && actual == "integer" {
+		return true
+	}
+	return t == actual
+}
+
+func typeOf(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	case json.Number:
+		if n, err := value.Float64(); err == nil && n == math.Trunc(n) {
+			return "integer"
+		}
+		return "number"
+	}
+	return "unknown"
+}
+
+func formatTypes(types interface{}) string {
+	if list, ok := types.([]interface{}); ok {
+		names := make([]string, 0, len(list))
+		for _, t := range list {
+			names = append(names, fmt.Sprint(t))
+		}
+		return strings.Join(names, " or ")
+	}
+	return fmt.Sprint(types)
+}
+
+func formatValue(value interface{}) string {
+	content, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(content)
+}
+
+func equal(expected, value interface{}) bool {
+	expectedNumber, ok1 := expected.(json.Number)
+	valueNumber, ok2 := value.(json.Number)
+	if ok1 && ok2 {
+		a, err1 := expectedNumber.Float64()
+		b, err2 := valueNumber.Float64()
+		return err1 == nil && err2 == nil && a == b
+	}
+	return reflect.DeepEqual(expected, value)
+}
+
+func number(value interface{}) (float64, bool) {
+	n, ok := value.(json.Number)
+	if !ok {
+		return 0, false
+	}
+	f, err := n.Float64()
+	return f, err == nil
+}
+
+func escape(token string) string {
+	return strings.Replace(strings.Replace(token, "~", "~0", -1), "/", "~1", -1)
+}
+
+func fail(pointer, reason string) error {
+	return &core.ValidationError{Pointer: pointer, Reason: reason}
+}
+
+func sortedKeys(value map[string]interface{}) []string {
+	keys := make([]string, 0, len(value))
+	for key := range value {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
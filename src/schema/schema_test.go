@@ -0,0 +1,141 @@
+package schema_test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/flaneurtv/samm/core"
+	"gitlab.com/flaneurtv/samm/core/schema"
+	"testing"
+)
+
+const tickSchema = `{
+  "type": "object",
+  "required": ["topic", "payload"],
+  "properties": {
+    "topic": {"type": "string", "pattern": "^[^#+]+$"},
+    "created_at": {"type": "string", "minLength": 24, "maxLength": 24},
+    "payload": {
+      "type": "object",
+      "required": ["tick_uuid"],
+      "additionalProperties": false,
+      "properties": {
+        "tick_uuid": {"$ref": "#/definitions/uuid"},
+        "count": {"type": "integer", "minimum": 1, "maximum": 10},
+        "kind": {"enum": ["a", "b"]},
+        "tags": {"type": "array", "maxItems": 2, "items": {"type": "string"}},
+        "a/b": {"type": "boolean"}
+      }
+    }
+  },
+  "definitions": {
+    "uuid": {"type": "string", "pattern": "^[0-9a-f-]{36}$"}
+  }
+}`
+
+func TestSchemaValid(t *testing.T) {
+	s, err := schema.Parse([]byte(tickSchema))
+	assert.Nil(t, err)
+
+	err = s.Validate(`{"topic": "default/tick", "payload": {"tick_uuid": "79b1fedb-90d6-467c-bc6f-09e00cb491e0", "count": 3, "kind": "b", "tags": ["x"], "a/b": true}}`)
+	assert.Nil(t, err)
+}
+
+func TestSchemaInvalid(t *testing.T) {
+	s, err := schema.Parse([]byte(tickSchema))
+	assert.Nil(t, err)
+
+	cases := []struct {
+		message string
+		pointer string
+		reason  string
+	}{
+		{`[]`, "", "expected type object, got array"},
+		{`{"topic": "default/tick"}`, "/payload", "required property missing"},
+		{`{"topic": "default/#", "payload": {"tick_uuid": "79b1fedb-90d6-467c-bc6f-09e00cb491e0"}}`, "/topic", "expected to match pattern '^[^#+]+$'"},
+		{`{"topic": "t", "created_at": "now", "payload": {"tick_uuid": "79b1fedb-90d6-467c-bc6f-09e00cb491e0"}}`, "/created_at", "expected at least 24 characters"},
+		{`{"topic": "t", "payload": {}}`, "/payload/tick_uuid", "required property missing"},
+		{`{"topic": "t", "payload": {"tick_uuid": 5}}`, "/payload/tick_uuid", "expected type string, got integer"},
+		{`{"topic": "t", "payload": {"tick_uuid": "x"}}`, "/payload/tick_uuid", "expected to match pattern '^[0-9a-f-]{36}$'"},
+		{`{"topic": "t", "payload": {"tick_uuid": "79b1fedb-90d6-467c-bc6f-09e00cb491e0", "count": 1.5}}`, "/payload/count", "expected type integer, got number"},
+		{`{"topic": "t", "payload": {"tick_uuid": "79b1fedb-90d6-467c-bc6f-09e00cb491e0", "count": 11}}`, "/payload/count", "expected maximum 10"},
+		{`{"topic": "t", "payload": {"tick_uuid": "79b1fedb-90d6-467c-bc6f-09e00cb491e0", "kind": "c"}}`, "/payload/kind", `expected one of ["a","b"]`},
+		{`{"topic": "t", "payload": {"tick_uuid": "79b1fedb-90d6-467c-bc6f-09e00cb491e0", "tags": ["x", 1]}}`, "/payload/tags/1", "expected type string, got integer"},
+		{`{"topic": "t", "payload": {"tick_uuid": "79b1fedb-90d6-467c-bc6f-09e00cb491e0", "tags": ["x", "y", "z"]}}`, "/payload/tags", "expected at most 2 items"},
+		{`{"topic": "t", "payload": {"tick_uuid": "79b1fedb-90d6-467c-bc6f-09e00cb491e0", "a/b": 1}}`, "/payload/a~1b", "expected type boolean, got integer"},
+		{`{"topic": "t", "payload": {"tick_uuid": "79b1fedb-90d6-467c-bc6f-09e00cb491e0", "extra": 1}}`, "/payload/extra", "additional property not allowed"},
+	}
+
+	for _, c := range cases {
+		err := s.Validate(c.message)
+		if assert.NotNil(t, err, c.message) {
+			validationErr, ok := err.(*core.ValidationError)
+			assert.True(t, ok)
+			assert.Equal(t, c.pointer, validationErr.Pointer, c.message)
+			assert.Equal(t, c.reason, validationErr.Reason, c.message)
+		}
+	}
+}
+
+func TestSchemaCombinations(t *testing.T) {
+	s, err := schema.Parse([]byte(`{
+  "anyOf": [{"type": "string"}, {"type": "integer"}],
+  "not": {"const": "forbidden"},
+  "oneOf": [{"type": "string"}, {"type": "integer", "minimum": 5}]
+}`))
+	assert.Nil(t, err)
+
+	assert.Nil(t, s.Validate(`"text"`))
+	assert.Nil(t, s.Validate(`7`))
+	assert.NotNil(t, s.Validate(`true`))
+	assert.NotNil(t, s.Validate(`"forbidden"`))
+	assert.NotNil(t, s.Validate(`3`))
+}
+
+func TestSchemaParseError(t *testing.T) {
+	_, err := schema.Parse([]byte(`{"type": "object"`))
+	assert.NotNil(t, err)
+
+	_, err = schema.Parse([]byte(`{"properties": {"a": {"pattern": "("}}}`))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "can't compile pattern")
+}
+
+func TestSchemaRefCycle(t *testing.T) {
+	_, err := schema.Parse([]byte(`{"$ref": "#"}`))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "$ref cycle")
+
+	_, err = schema.Parse([]byte(`{"definitions": {"a": {"allOf": [{"$ref": "#/definitions/b"}]}, "b": {"not": {"$ref": "#/definitions/a"}}}, "$ref": "#/definitions/a"}`))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "$ref cycle")
+
+	s, err := schema.Parse([]byte(`{"type": "object", "properties": {"child": {"$ref": "#"}}}`))
+	assert.Nil(t, err)
+	assert.Nil(t, s.Validate(`{"child": {"child": {}}}`))
+	assert.NotNil(t, s.Validate(`{"child": {"child": 1}}`))
+}
+
+func TestSchemaUnsupportedKeyword(t *testing.T) {
+	for _, content := range []string{
+		`{"type": "string", "format": "uuid"}`,
+		`{"patternProperties": {"^a": {"type": "string"}}}`,
+		`{"if": {"type": "string"}, "then": {"minLength": 1}}`,
+		`{"properties": {"tags": {"type": "array", "uniqueItems": true}}}`,
+		`{"items": {"contains": {"type": "string"}}}`,
+		`{"dependencies": {"a": ["b"]}}`,
+		`{"allOf": [{"propertyNames": {"pattern": "^a"}}]}`,
+		`{"items": [{"type": "string"}]}`,
+	} {
+		_, err := schema.Parse([]byte(content))
+		assert.NotNil(t, err, content)
+	}
+
+	_, err := schema.Parse([]byte(`{"type": "string", "format": "uuid"}`))
+	assert.Equal(t, "unsupported keyword 'format' at '#'", err.Error())
+}
+
+func TestSchemaPatternData(t *testing.T) {
+	s, err := schema.Parse([]byte(`{"properties": {"pattern": {"type": "string"}}, "enum": [{"pattern": "("}, {"pattern": "a"}]}`))
+	assert.Nil(t, err)
+	assert.Nil(t, s.Validate(`{"pattern": "a"}`))
+	assert.NotNil(t, s.Validate(`{"pattern": 1}`))
+}
@@ -0,0 +1,165 @@
+package core
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ProcessService is implemented by services running the processor as a
+// child process.
+type ProcessService interface {
+	Service
+	PID() int
+}
+
+// Stats periodically publishes the counters of its metrics, the uptime and
+// the memory usage to $NAMESPACE/stats/$SERVICE_NAME/$SERVICE_UUID.
+type Stats struct {
+	publisher   MessageBusClient
+	topic       string
+	serviceName string
+	serviceUUID string
+	serviceHost string
+	interval    time.Duration
+	metrics     *Metrics
+	logger      Logger
+	startedAt   time.Time
+}
+
+type statsMessage struct {
+	Topic       string       `json:"topic"`
+	ServiceName string       `json:"service_name"`
+	ServiceUUID string       `json:"service_uuid"`
+	ServiceHost string       `json:"service_host"`
+	CreatedAt   string       `json:"created_at"`
+	Payload     statsPayload `json:"payload"`
+}
+
+type statsPayload struct {
+	UptimeSeconds     float64       `json:"uptime_seconds"`
+	Messages          statsMessages `json:"messages"`
+	ProcessorPID      *int          `json:"processor_pid,omitempty"`
+	ProcessorRestarts *int          `json:"processor_restarts,omitempty"`
+	Memory            statsMemory   `json:"memory"`
+}
+
+type statsMessages struct {
+	Received  float64 `json:"received"`
+	Published float64 `json:"published"`
+	Errors    float64 `json:"errors"`
+	Dropped   float64 `json:"dropped"`
+}
+
+type statsMemory struct {
+	HeapAllocBytes    uint64 `json:"heap_alloc_bytes"`
+	SysBytes          uint64 `json:"sys_bytes"`
+	ProcessorRSSBytes *int64 `json:"processor_rss_bytes,omitempty"`
+}
+
+// NewStats publishes stats every interval once the adapter or bridge is
+// started. The metrics should be the ones set on the adapter or bridge.
+func NewStats(publisher MessageBusClient, namespace, serviceName, serviceUUID, serviceHost string, interval time.Duration, metrics *Metrics, logger Logger) *Stats {
+	return &Stats{
+		publisher:   publisher,
+		topic:       fmt.Sprintf("%s/stats/%s/%s", namespace, serviceName, serviceUUID),
+		serviceName: serviceName,
+		serviceUUID: serviceUUID,
+		serviceHost: serviceHost,
+		interval:    interval,
+		metrics:     metrics,
+		logger:      logger,
+		startedAt:   time.Now(),
+	}
+}
+
+// run publishes the stats until done is closed. The service is nil for the
+// bridge.
+func (s *Stats) run(service Service, done <-chan struct{}) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			err := s.publisher.Publish(s.topic, s.message(service, now))
+			if err != nil {
+				s.logger.Log(LogLevelError, fmt.Sprintf("can't publish stats: %s", err))
+			}
+		}
+	}
+}
+
+func (s *Stats) message(service Service, now time.Time) string {
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+
+	payload := statsPayload{
+		UptimeSeconds: now.Sub(s.startedAt).Seconds(),
+		Messages: statsMessages{
+			Received:  s.metrics.Sum(MetricMessagesReceived),
+			Published: s.metrics.Sum(MetricMessagesPublished),
+			Errors:    s.metrics.Sum(MetricInvalidJSON) + s.metrics.Sum(MetricMissingTopic) + s.metrics.Sum(MetricPublishErrors),
+			Dropped:   s.metrics.Sum(MetricMessagesDropped),
+		},
+		Memory: statsMemory{
+			HeapAllocBytes: memStats.HeapAlloc,
+			SysBytes:       memStats.Sys,
+		},
+	}
+
+	if service != nil {
+		restarts := 0
+		if starts := int(s.metrics.Sum(MetricProcessorStarts)); starts > 1 {
+			restarts = starts - 1
+		}
+		payload.ProcessorRestarts = &restarts
+
+		if process, ok := service.(ProcessService); ok && process.PID() > 0 {
+			pid := process.PID()
+			payload.ProcessorPID = &pid
+			if rss, ok := processRSS(pid); ok {
+				payload.Memory.ProcessorRSSBytes = &rss
+			}
+		}
+	}
+
+	msg, _ := json.Marshal(statsMessage{
+		Topic:       s.topic,
+		ServiceName: s.serviceName,
+		ServiceUUID: s.serviceUUID,
+		ServiceHost: s.serviceHost,
+		CreatedAt:   now.UTC().Format(createdAtFormat),
+		Payload:     payload,
+	})
+	return string(msg)
+}
+
+// processRSS reads the resident set size of a process on Linux.
+func processRSS(pid int) (int64, bool) {
+	file, err := os.Open(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return 0, false
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 3 && fields[0] == "VmRSS:" && fields[2] == "kB" {
+			kb, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return 0, false
+			}
+			return kb * 1024, true
+		}
+	}
+	return 0, false
+}
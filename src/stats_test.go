@@ -0,0 +1,110 @@
+package core_test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+	"gitlab.com/flaneurtv/samm/core"
+	"gitlab.com/flaneurtv/samm/core/logger"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestAdapterStats(t *testing.T) {
+	bus := NewMockBus()
+	client := NewMockClient(bus)
+
+	service := &mockProcessService{mockService: NewMockService(func(msg string) string {
+		if !gjson.Valid(msg) {
+			return `{"payload": "missing"}`
+		}
+		return `{"topic": "root/tock"}`
+	}), pid: os.Getpid()}
+
+	metrics := core.NewMetrics().With("service", "first")
+	adapter := core.NewAdapter(client, client, []string{"root/tick"}, service, &mockLogger{})
+	adapter.SetMetrics(metrics)
+	adapter.SetStats(core.NewStats(client, "root", "first", "id1", "host.com", 50*time.Millisecond, metrics, &mockLogger{}))
+
+	subscription, _ := client.Subscribe([]string{"root/stats/+/+"})
+	output := make(chan string, 10)
+	go func() {
+		for msg := range subscription {
+			output <- msg
+		}
+	}()
+
+	_, err := adapter.Start()
+	assert.Nil(t, err)
+
+	client.Publish("root/tick", `{"topic": "root/tick"}`)
+	client.Publish("root/tick", `{"topic": "root/tick"`)
+
+	var msg string
+	select {
+	case msg = <-output:
+	case <-time.After(time.Second):
+		t.Fatal("stats weren't published")
+	}
+
+	assert.Equal(t, "root/stats/first/id1", gjson.Get(msg, "topic").String())
+	assert.Equal(t, "first", gjson.Get(msg, "service_name").String())
+	assert.Equal(t, "id1", gjson.Get(msg, "service_uuid").String())
+	assert.Equal(t, "host.com", gjson.Get(msg, "service_host").String())
+	assert.NotEmpty(t, gjson.Get(msg, "created_at").String())
+	assert.True(t, gjson.Get(msg, "payload.uptime_seconds").Float() > 0)
+	assert.Equal(t, int64(2), gjson.Get(msg, "payload.messages.received").Int())
+	assert.Equal(t, int64(1), gjson.Get(msg, "payload.messages.published").Int())
+	assert.Equal(t, int64(1), gjson.Get(msg, "payload.messages.errors").Int())
+	assert.Equal(t, int64(0), gjson.Get(msg, "payload.messages.dropped").Int())
+	assert.Equal(t, int64(os.Getpid()), gjson.Get(msg, "payload.processor_pid").Int())
+	assert.Equal(t, int64(0), gjson.Get(msg, "payload.processor_restarts").Int())
+	assert.True(t, gjson.Get(msg, "payload.memory.heap_alloc_bytes").Int() > 0)
+	assert.True(t, gjson.Get(msg, "payload.memory.sys_bytes").Int() > 0)
+	assert.True(t, gjson.Get(msg, "payload.memory.processor_rss_bytes").Int() > 0)
+}
+
+func TestBridgeStats(t *testing.T) {
+	bus := NewMockBus()
+	client := NewMockClient(bus)
+
+	metrics := core.NewMetrics()
+	bridge := core.NewBridge(client, client, "tick", "tack", []string{"tick/#"}, logger.NewNoOpLogger())
+	bridge.SetMetrics(metrics)
+	bridge.SetStats(core.NewStats(client, "tack", "bridge", "id1", "host.com", 50*time.Millisecond, metrics, logger.NewNoOpLogger()))
+
+	subscription, _ := client.Subscribe([]string{"tack/stats/+/+"})
+	output := make(chan string, 10)
+	go func() {
+		for msg := range subscription {
+			output <- msg
+		}
+	}()
+
+	_, err := bridge.Start()
+	assert.Nil(t, err)
+
+	client.Publish("tick/first", `{"topic": "tick/first"}`)
+
+	var msg string
+	select {
+	case msg = <-output:
+	case <-time.After(time.Second):
+		t.Fatal("stats weren't published")
+	}
+
+	assert.Equal(t, "tack/stats/bridge/id1", gjson.Get(msg, "topic").String())
+	assert.Equal(t, int64(1), gjson.Get(msg, "payload.messages.received").Int())
+	assert.Equal(t, int64(1), gjson.Get(msg, "payload.messages.published").Int())
+	assert.False(t, gjson.Get(msg, "payload.processor_pid").Exists())
+	assert.False(t, gjson.Get(msg, "payload.processor_restarts").Exists())
+}
+
+type mockProcessService struct {
+	*mockService
+	pid int
+}
+
+func (sp *mockProcessService) PID() int {
+	return sp.pid
+}
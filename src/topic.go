@@ -0,0 +1,47 @@
+package core
+
+import "strings"
+
+func MatchTopic(pattern, topic string) bool {
+	_, ok := MatchTopicCaptures(pattern, topic)
+	return ok
+}
+
+func MatchTopicCaptures(pattern, topic string) ([]string, bool) {
+	patternLevels := strings.Split(pattern, "/")
+	topicLevels := strings.Split(topic, "/")
+
+	var captures []string
+	for i, level := range patternLevels {
+		if level == "#" {
+			if i < len(topicLevels) {
+				captures = append(captures, strings.Join(topicLevels[i:], "/"))
+			} else {
+				captures = append(captures, "")
+			}
+			return captures, true
+		}
+		if i >= len(topicLevels) {
+			return nil, false
+		}
+		if level == "+" {
+			captures = append(captures, topicLevels[i])
+		} else if level != topicLevels[i] {
+			return nil, false
+		}
+	}
+	if len(patternLevels) != len(topicLevels) {
+		return nil, false
+	}
+	return captures, true
+}
+
+func CountTopicWildcards(pattern string) int {
+	count := 0
+	for _, level := range strings.Split(pattern, "/") {
+		if level == "+" || level == "#" {
+			count++
+		}
+	}
+	return count
+}
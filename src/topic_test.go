@@ -0,0 +1,50 @@
+package core_test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/flaneurtv/samm/core"
+	"testing"
+)
+
+func TestMatchTopic(t *testing.T) {
+	assert.True(t, core.MatchTopic("default/tick", "default/tick"))
+	assert.False(t, core.MatchTopic("default/tick", "default/tock"))
+	assert.False(t, core.MatchTopic("default/tick", "default/tick/1"))
+	assert.False(t, core.MatchTopic("default/tick/1", "default/tick"))
+
+	assert.True(t, core.MatchTopic("+/tick", "default/tick"))
+	assert.True(t, core.MatchTopic("default/+/1", "default/tick/1"))
+	assert.False(t, core.MatchTopic("default/+", "default/tick/1"))
+	assert.True(t, core.MatchTopic("default/+", "default/"))
+
+	assert.True(t, core.MatchTopic("#", "default/tick"))
+	assert.True(t, core.MatchTopic("default/#", "default/tick/1"))
+	assert.True(t, core.MatchTopic("default/#", "default"))
+	assert.False(t, core.MatchTopic("default/#", "other/tick"))
+}
+
+func TestMatchTopicCaptures(t *testing.T) {
+	captures, ok := core.MatchTopicCaptures("default/tick", "default/tick")
+	assert.True(t, ok)
+	assert.Equal(t, 0, len(captures))
+
+	captures, ok = core.MatchTopicCaptures("+/tick/+", "default/tick/1")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"default", "1"}, captures)
+
+	captures, ok = core.MatchTopicCaptures("+/log/#", "default/log/service/uuid/error")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"default", "service/uuid/error"}, captures)
+
+	captures, ok = core.MatchTopicCaptures("default/#", "default")
+	assert.True(t, ok)
+	assert.Equal(t, []string{""}, captures)
+
+	_, ok = core.MatchTopicCaptures("+/tick", "default/tock")
+	assert.False(t, ok)
+}
+
+func TestCountTopicWildcards(t *testing.T) {
+	assert.Equal(t, 0, core.CountTopicWildcards("default/tick"))
+	assert.Equal(t, 2, core.CountTopicWildcards("+/tick/#"))
+}
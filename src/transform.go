@@ -0,0 +1,133 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+	"strings"
+)
+
+const redactedValue = "***"
+
+// Transform is a single message transformation. Supported expressions:
+//
+//	del(path)              remove a field
+//	rename(path, newPath)  move a field
+//	redact(path)           replace the value of a field with "***"
+//	set(path, value)       set a field to a JSON value
+//
+// Paths use the gjson dot syntax without wildcards, queries or modifiers.
+type Transform struct {
+	expr string
+	op   string
+	path string
+	arg  string
+}
+
+func ParseTransform(expr string) (Transform, error) {
+	t := Transform{expr: strings.TrimSpace(expr)}
+
+	open := strings.Index(t.expr, "(")
+	if open <= 0 || !strings.HasSuffix(t.expr, ")") {
+		return t, fmt.Errorf("invalid transform '%s': expected op(arguments)", t.expr)
+	}
+	t.op = strings.TrimSpace(t.expr[:open])
+	args := t.expr[open+1 : len(t.expr)-1]
+
+	var hasArg bool
+	if i := strings.Index(args, ","); i >= 0 {
+		t.path, t.arg, hasArg = strings.TrimSpace(args[:i]), strings.TrimSpace(args[i+1:]), true
+	} else {
+		t.path = strings.TrimSpace(args)
+	}
+
+	err := checkTransformPath(t.path)
+	if err != nil {
+		return t, fmt.Errorf("invalid transform '%s': %s", t.expr, err)
+	}
+
+	switch t.op {
+	case "del", "redact":
+		if hasArg {
+			return t, fmt.Errorf("invalid transform '%s': %s expects one argument", t.expr, t.op)
+		}
+	case "rename":
+		if !hasArg {
+			return t, fmt.Errorf("invalid transform '%s': rename expects two arguments", t.expr)
+		}
+		err := checkTransformPath(t.arg)
+		if err != nil {
+			return t, fmt.Errorf("invalid transform '%s': %s", t.expr, err)
+		}
+	case "set":
+		if !hasArg {
+			return t, fmt.Errorf("invalid transform '%s': set expects two arguments", t.expr)
+		}
+		if !gjson.Valid(t.arg) {
+			return t, fmt.Errorf("invalid transform '%s': value isn't valid JSON", t.expr)
+		}
+	default:
+		return t, fmt.Errorf("invalid transform '%s': unknown operation '%s'", t.expr, t.op)
+	}
+
+	return t, nil
+}
+
+func checkTransformPath(path string) error {
+	if path == "" {
+		return errors.New("path can't be empty")
+	}
+	if strings.ContainsAny(path, "*?#|@") {
+		return fmt.Errorf("path '%s' isn't supported", path)
+	}
+	return nil
+}
+
+func (t Transform) String() string {
+	return t.expr
+}
+
+func (t Transform) Apply(msg string) (string, error) {
+	if !gjson.Parse(msg).IsObject() {
+		return "", fmt.Errorf("%s: message isn't a JSON object", t.expr)
+	}
+
+	value := gjson.Get(msg, t.path)
+
+	var err error
+	switch t.op {
+	case "del":
+		msg, err = sjson.Delete(msg, t.path)
+	case "redact":
+		if value.Exists() {
+			msg, err = sjson.Set(msg, t.path, redactedValue)
+		}
+	case "rename":
+		if !value.Exists() {
+			return "", fmt.Errorf("%s: path '%s' doesn't exist", t.expr, t.path)
+		}
+		msg, err = sjson.Delete(msg, t.path)
+		if err == nil {
+			msg, err = sjson.SetRaw(msg, t.arg, value.Raw)
+		}
+	case "set":
+		msg, err = sjson.SetRaw(msg, t.path, t.arg)
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s: %s", t.expr, err)
+	}
+	return msg, nil
+}
+
+// ApplyTransforms applies the transforms in the given order.
+func ApplyTransforms(transforms []Transform, msg string) (string, error) {
+	var err error
+	for _, t := range transforms {
+		msg, err = t.Apply(msg)
+		if err != nil {
+			return "", err
+		}
+	}
+	return msg, nil
+}
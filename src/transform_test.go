@@ -0,0 +1,75 @@
+package core_test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/flaneurtv/samm/core"
+	"testing"
+)
+
+func TestTransform(t *testing.T) {
+	msg := `{"topic":"tick","payload":{"name":"a","email":"a@example.com","phone":"123"}}`
+
+	cases := map[string]string{
+		"del(payload.email)":                  `{"topic":"tick","payload":{"name":"a","phone":"123"}}`,
+		"del(payload.missing)":                msg,
+		"redact(payload.phone)":               `{"topic":"tick","payload":{"name":"a","email":"a@example.com","phone":"***"}}`,
+		"redact(payload.missing)":             msg,
+		"rename(payload.name, payload.title)": `{"topic":"tick","payload":{"email":"a@example.com","phone":"123","title":"a"}}`,
+		`set(payload.source, "bridge")`:       `{"topic":"tick","payload":{"name":"a","email":"a@example.com","phone":"123","source":"bridge"}}`,
+		`set(meta, {"a": 1, "b": [2]})`:       `{"topic":"tick","payload":{"name":"a","email":"a@example.com","phone":"123"},"meta":{"a": 1, "b": [2]}}`,
+	}
+
+	for expr, expected := range cases {
+		transform, err := core.ParseTransform(expr)
+		if assert.Nil(t, err, expr) {
+			result, err := transform.Apply(msg)
+			assert.Nil(t, err, expr)
+			assert.JSONEq(t, expected, result, expr)
+		}
+	}
+}
+
+func TestTransformApplyError(t *testing.T) {
+	transform, _ := core.ParseTransform("rename(payload.missing, payload.name)")
+	_, err := transform.Apply(`{"payload":{}}`)
+	assert.NotNil(t, err)
+	assert.Equal(t, "rename(payload.missing, payload.name): path 'payload.missing' doesn't exist", err.Error())
+
+	transform, _ = core.ParseTransform("del(payload)")
+	_, err = transform.Apply(`[1, 2]`)
+	assert.NotNil(t, err)
+	assert.Equal(t, "del(payload): message isn't a JSON object", err.Error())
+
+	transform, _ = core.ParseTransform("set(payload.x, 1)")
+	_, err = transform.Apply(`{"payload":[1]}`)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "set(payload.x, 1): ")
+}
+
+func TestApplyTransforms(t *testing.T) {
+	del, _ := core.ParseTransform("del(payload.email)")
+	set, _ := core.ParseTransform("set(payload.email, true)")
+	result, err := core.ApplyTransforms([]core.Transform{del, set}, `{"payload":{"email":"a@example.com"}}`)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"payload":{"email":true}}`, result)
+}
+
+func TestParseTransformError(t *testing.T) {
+	cases := map[string]string{
+		"payload.email":             "invalid transform 'payload.email': expected op(arguments)",
+		"drop(payload.email)":       "invalid transform 'drop(payload.email)': unknown operation 'drop'",
+		"del()":                     "invalid transform 'del()': path can't be empty",
+		"del(payload.tags.#)":       "invalid transform 'del(payload.tags.#)': path 'payload.tags.#' isn't supported",
+		"del(payload.a, payload.b)": "invalid transform 'del(payload.a, payload.b)': del expects one argument",
+		"rename(payload.a)":         "invalid transform 'rename(payload.a)': rename expects two arguments",
+		"rename(payload.a, )":       "invalid transform 'rename(payload.a, )': path can't be empty",
+		"set(payload.a, unquoted)":  "invalid transform 'set(payload.a, unquoted)': value isn't valid JSON",
+	}
+
+	for expr, expectedErr := range cases {
+		_, err := core.ParseTransform(expr)
+		if assert.NotNil(t, err, expr) {
+			assert.Equal(t, expectedErr, err.Error(), expr)
+		}
+	}
+}
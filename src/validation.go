@@ -0,0 +1,31 @@
+package core
+
+import "fmt"
+
+type ValidationMode string
+
+const (
+	ValidationModeReject ValidationMode = "reject"
+	ValidationModeTag    ValidationMode = "tag"
+)
+
+type MessageValidator interface {
+	Validate(topic, message string) error
+}
+
+type ValidationError struct {
+	Pointer string
+	Reason  string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s at '%s'", e.Reason, e.Pointer)
+}
+
+func ParseValidationMode(mode string) (ValidationMode, bool) {
+	switch ValidationMode(mode) {
+	case ValidationModeReject, ValidationModeTag:
+		return ValidationMode(mode), true
+	}
+	return ValidationModeReject, false
+}